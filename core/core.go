@@ -18,31 +18,57 @@ const (
 	STATE_SW_WAITING
 )
 
+// Used when no interrupt vector is explicitly configured. Address 0x0000 is where the core starts after reset, so
+// the vector is right after it, leaving room for a single jump to the main program.
+const DEFAULT_INTERRUPT_VECTOR isa.Register = 0x0002
+
 type Core struct {
 	Registers isa.GeneralRegisters
 	Pc        isa.Register
 	Sp        isa.Register
+	Epc       isa.Register // PC saved when the interrupt is taken, restored by RETI.
+	TrapEpc   isa.Register // PC saved when a trap is taken, restored by RETI from the trap handler.
 
 	logger  *slog.Logger
 	verbose bool
 
 	state       State
 	instruction isa.Register
+
+	interruptsEnabled bool
+	interruptVector   isa.Register
+
+	// A trap can be taken inside the interrupt handler, so it doesn't touch EPC. Until its RETI, the core is in the
+	// trap handler, and RETI goes back to TrapEpc with the interrupts enabled or disabled as they were before the trap.
+	inTrap                bool
+	trapInterruptsEnabled bool
 }
 
 type CoreOpts struct {
-	Logger  *slog.Logger
-	Verbose bool
+	Logger          *slog.Logger
+	Verbose         bool
+	InterruptVector *isa.Register // DEFAULT_INTERRUPT_VECTOR is used if nil, 0x0000 is a valid vector.
+	ResetPc         isa.Register
 }
 
 func NewCore(opts *CoreOpts) *Core {
+	interruptVector := DEFAULT_INTERRUPT_VECTOR
+
+	if opts.InterruptVector != nil {
+		interruptVector = *opts.InterruptVector
+	}
+
 	core := &Core{
-		Pc:    isa.Register(0x0000),
+		Pc:    opts.ResetPc,
 		Sp:    isa.Register(0x0000),
+		Epc:   isa.Register(0x0000),
 		state: STATE_READY,
 
 		logger:  opts.Logger,
 		verbose: opts.Verbose,
+
+		interruptsEnabled: false,
+		interruptVector:   interruptVector,
 	}
 
 	for idx := range core.Registers {
@@ -101,139 +127,116 @@ func (c *Core) MultiturnRunInstruction(busValue isa.BusValue) (*isa.BusAccess, [
 		c.state = STATE_READY
 		c.instruction = isa.Register(busValue)
 
-		instrCode := isa.ParseInstructionCode(c.instruction)
-		instrString, err := isa.InstructionToString(instrCode)
+		instr, err := Decode(c.instruction)
 
 		if err != nil {
-			return nil, nil, fmt.Errorf("cannot find the name of the instruction: %w", err)
+			return nil, nil, err
 		}
 
 		if c.verbose {
-			c.logger.Info("[Core] Running instruction", "instruction", instrString, "hex", fmt.Sprintf("%04X", c.instruction))
+			c.logger.Info("[Core] Running instruction", "instruction", instr.Spec.Mnemonic, "hex", fmt.Sprintf("%04X", c.instruction))
 		}
 
-		switch instrCode {
-		case isa.InstructionCode(isa.ADD):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
-			rs2 := isa.ParseRs2(c.instruction)
-			c.Registers[rd] = isa.Register(c.Registers[rs1] + c.Registers[rs2])
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.SUB):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
-			rs2 := isa.ParseRs2(c.instruction)
-			c.Registers[rd] = isa.Register(c.Registers[rs1] - c.Registers[rs2])
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.LW):
-			rs := isa.ParseRs1(c.instruction)
+		switch instr.Opcode {
+		case isa.LW:
 			c.state = STATE_LW_WAITING
 			return &isa.BusAccess{
 				Read: &isa.BusAccessRead{
-					Address: c.Registers[rs],
+					Address: c.Registers[instr.Rs1],
 				},
 			}, []ExecutionSignal{SIGNAL_LOADING_DATA}, nil
-		case isa.InstructionCode(isa.SW):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
+		case isa.SW:
 			c.state = STATE_SW_WAITING
 			return &isa.BusAccess{
 				Write: &isa.BusAccessWrite{
-					Address: c.Registers[rd],
-					Value:   c.Registers[rs1],
+					Address: c.Registers[instr.Rd],
+					Value:   c.Registers[instr.Rs1],
 				},
 			}, []ExecutionSignal{SIGNAL_WRITING_DATA}, nil
-		case isa.InstructionCode(isa.XOR):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
-			rs2 := isa.ParseRs2(c.instruction)
-			c.Registers[rd] = isa.Register(c.Registers[rs1] ^ c.Registers[rs2])
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.AND):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
-			rs2 := isa.ParseRs2(c.instruction)
-			c.Registers[rd] = isa.Register(c.Registers[rs1] & c.Registers[rs2])
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.OR):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
-			rs2 := isa.ParseRs2(c.instruction)
-			c.Registers[rd] = isa.Register(c.Registers[rs1] | c.Registers[rs2])
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.ADDI):
-			rd := isa.ParseRd(c.instruction)
-			imm8 := isa.Imm8(c.instruction)
-			c.Registers[rd] = isa.Register(uint16(c.Registers[rd]) + uint16(imm8))
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.LDHI):
-			rd := isa.ParseRd(c.instruction)
-			imm8 := isa.Imm8(c.instruction)
-			c.Registers[rd] = isa.Register(uint16(uint16(imm8)<<8) | uint16(c.Registers[rd]&0x00FF))
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.BZ):
-			rd := isa.ParseRd(c.instruction)
-			imm8 := isa.Imm8(c.instruction)
-			if c.Registers[rd] == 0 {
-				c.Pc = isa.Register(imm8)
-			} else {
-				c.Pc += isa.INSTRUCTION_SIZE
-			}
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.BNZ):
-			rd := isa.ParseRd(c.instruction)
-			imm8 := isa.Imm8(c.instruction)
-			if c.Registers[rd] != 0 {
-				c.Pc = isa.Register(imm8)
-			} else {
-				c.Pc += isa.INSTRUCTION_SIZE
-			}
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.JAL):
-			rd := isa.ParseRd(c.instruction)
-			imm8 := isa.Imm8(c.instruction)
-			c.Registers[rd] = c.Pc + isa.INSTRUCTION_SIZE
-			c.Pc = isa.Register(imm8)
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.JALR):
-			rd := isa.ParseRd(c.instruction)
-			rs1 := isa.ParseRs1(c.instruction)
-			c.Registers[rd] = c.Pc + isa.INSTRUCTION_SIZE
-			c.Pc = c.Registers[rs1]
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.SHL):
-			rd := isa.ParseRd(c.instruction)
-			imm4 := isa.Imm4(c.instruction)
-			c.Registers[rd] <<= imm4
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.SHR):
-			rd := isa.ParseRd(c.instruction)
-			imm4 := isa.Imm4(c.instruction)
-			c.Registers[rd] = isa.Register(uint16(c.Registers[rd]) >> imm4)
-			c.Pc += isa.INSTRUCTION_SIZE
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		case isa.InstructionCode(isa.SHRA):
-			rd := isa.ParseRd(c.instruction)
-			imm4 := isa.Imm4(c.instruction)
-			c.Pc += isa.INSTRUCTION_SIZE
-			c.Registers[rd] = isa.Register(int16(c.Registers[rd]) >> imm4)
-			return nil, []ExecutionSignal{SIGNAL_DONE}, nil
-		default:
-			return nil, nil, fmt.Errorf("unknown instruction code %#x", instrCode)
 		}
+
+		if err := c.execute(&instr); err != nil {
+			return nil, nil, err
+		}
+
+		return nil, []ExecutionSignal{SIGNAL_DONE}, nil
 	}
 
 	return nil, nil, fmt.Errorf("unknown state") // TODO: better error message
 }
 
+// TakeInterrupt is invoked by the system between instructions while the interrupt line is asserted.
+//
+// If the interrupts are enabled, the current PC is saved to EPC, further interrupts are disabled until RETI, and the
+// execution continues from the interrupt vector. Returns whether the interrupt was taken.
+func (c *Core) TakeInterrupt() bool {
+	if !c.interruptsEnabled || (c.state != STATE_READY) {
+		return false
+	}
+
+	if c.verbose {
+		c.logger.Info("[Core] Taking interrupt", "pc", fmt.Sprintf("%04X", c.Pc), "vector", fmt.Sprintf("%04X", c.interruptVector))
+	}
+
+	c.Epc = c.Pc
+	c.Pc = c.interruptVector
+	c.interruptsEnabled = false
+
+	return true
+}
+
+// TakeTrap is invoked by the system between instructions, after an instruction caused an exception like a bus fault.
+//
+// Traps go to the interrupt vector the same way as the interrupts, but they can't be masked, and they return false
+// only if the core is in the middle of an instruction. The PC is saved to TrapEpc, keeping EPC for returning from the
+// interrupt handler the trap was taken in, if any. A trap in the trap handler overwrites TrapEpc, it can't return.
+func (c *Core) TakeTrap() bool {
+	if c.state != STATE_READY {
+		return false
+	}
+
+	if c.verbose {
+		c.logger.Info("[Core] Taking trap", "pc", fmt.Sprintf("%04X", c.Pc), "vector", fmt.Sprintf("%04X", c.interruptVector))
+	}
+
+	if !c.inTrap {
+		c.trapInterruptsEnabled = c.interruptsEnabled
+	}
+
+	c.TrapEpc = c.Pc
+	c.Pc = c.interruptVector
+	c.interruptsEnabled = false
+	c.inTrap = true
+
+	return true
+}
+
+// returnFromInterrupt runs RETI, returning from the trap handler first if a trap was taken.
+func (c *Core) returnFromInterrupt() {
+	c.Pc = c.ReturnPc()
+
+	if c.inTrap {
+		c.interruptsEnabled = c.trapInterruptsEnabled
+		c.inTrap = false
+		return
+	}
+
+	c.interruptsEnabled = true
+}
+
+// ReturnPc returns where RETI would go, TrapEpc in the trap handler and EPC otherwise.
+func (c *Core) ReturnPc() isa.Register {
+	if c.inTrap {
+		return c.TrapEpc
+	}
+
+	return c.Epc
+}
+
+func (c *Core) InterruptsEnabled() bool {
+	return c.interruptsEnabled
+}
+
 func (c *Core) DebugDump(regsToDump []isa.RegisterId) (string, error) {
 	var buf bytes.Buffer
 
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"fmt"
+
+	"mrav/isa"
+)
+
+// DecodedInstruction holds the fields of an instruction word, so they are parsed only once for the instructions that
+// run many times. All the fields are filled regardless of the instruction format.
+type DecodedInstruction struct {
+	Spec     *isa.InstructionSpec
+	Word     isa.Register
+	Opcode   isa.InstructionCode
+	Function isa.JalrFunction
+	Rd       isa.RegisterId
+	Rs1      isa.RegisterId
+	Rs2      isa.RegisterId
+	Imm8     uint8
+	Imm4     uint8
+}
+
+func Decode(word isa.Register) (DecodedInstruction, error) {
+	spec, err := isa.DecodeSpec(word)
+
+	if err != nil {
+		return DecodedInstruction{}, fmt.Errorf("cannot decode the instruction: %w", err)
+	}
+
+	return DecodedInstruction{
+		Spec:     spec,
+		Word:     word,
+		Opcode:   spec.Opcode,
+		Function: spec.Function,
+		Rd:       isa.ParseRd(word),
+		Rs1:      isa.ParseRs1(word),
+		Rs2:      isa.ParseRs2(word),
+		Imm8:     isa.Imm8(word),
+		Imm4:     isa.Imm4(word),
+	}, nil
+}
+
+// DataBus services the loads and stores of RunDecoded.
+type DataBus interface {
+	ReadData(address isa.Register) (isa.BusValue, error)
+	WriteData(address isa.Register, value isa.Register) error
+}
+
+// RunDecoded runs the whole instruction in one call, including its data access, without going through the multiturn
+// states. It's meant for the fast simulation, where the system fetches and decodes the instructions itself. Bus errors
+// are returned as they come from the data bus.
+func (c *Core) RunDecoded(instr *DecodedInstruction, bus DataBus) error {
+	if c.state != STATE_READY {
+		return fmt.Errorf("cannot run a decoded instruction while another one is in progress")
+	}
+
+	c.instruction = instr.Word
+
+	switch instr.Opcode {
+	case isa.LW:
+		value, err := bus.ReadData(c.Registers[instr.Rs1])
+
+		if err != nil {
+			return err
+		}
+
+		c.Registers[instr.Rd] = isa.Register(value)
+		c.Pc += isa.INSTRUCTION_SIZE
+		return nil
+	case isa.SW:
+		if err := bus.WriteData(c.Registers[instr.Rd], c.Registers[instr.Rs1]); err != nil {
+			return err
+		}
+
+		c.Pc += isa.INSTRUCTION_SIZE
+		return nil
+	}
+
+	return c.execute(instr)
+}
+
+// execute runs the instructions that don't access the bus, shared by the multiturn and the decoded runs.
+func (c *Core) execute(instr *DecodedInstruction) error {
+	switch instr.Opcode {
+	case isa.ADD:
+		c.Registers[instr.Rd] = isa.Register(c.Registers[instr.Rs1] + c.Registers[instr.Rs2])
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.SUB:
+		c.Registers[instr.Rd] = isa.Register(c.Registers[instr.Rs1] - c.Registers[instr.Rs2])
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.XOR:
+		c.Registers[instr.Rd] = isa.Register(c.Registers[instr.Rs1] ^ c.Registers[instr.Rs2])
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.AND:
+		c.Registers[instr.Rd] = isa.Register(c.Registers[instr.Rs1] & c.Registers[instr.Rs2])
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.OR:
+		c.Registers[instr.Rd] = isa.Register(c.Registers[instr.Rs1] | c.Registers[instr.Rs2])
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.ADDI:
+		c.Registers[instr.Rd] = isa.Register(uint16(c.Registers[instr.Rd]) + uint16(instr.Imm8))
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.LDHI:
+		c.Registers[instr.Rd] = isa.Register(uint16(uint16(instr.Imm8)<<8) | uint16(c.Registers[instr.Rd]&0x00FF))
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.BZ:
+		if c.Registers[instr.Rd] == 0 {
+			c.Pc = isa.Register(instr.Imm8)
+		} else {
+			c.Pc += isa.INSTRUCTION_SIZE
+		}
+	case isa.BNZ:
+		if c.Registers[instr.Rd] != 0 {
+			c.Pc = isa.Register(instr.Imm8)
+		} else {
+			c.Pc += isa.INSTRUCTION_SIZE
+		}
+	case isa.JAL:
+		c.Registers[instr.Rd] = c.Pc + isa.INSTRUCTION_SIZE
+		c.Pc = isa.Register(instr.Imm8)
+	case isa.JALR:
+		switch instr.Function {
+		case isa.JALR_JUMP:
+			c.Registers[instr.Rd] = c.Pc + isa.INSTRUCTION_SIZE
+			c.Pc = c.Registers[instr.Rs1]
+		case isa.JALR_RETI:
+			c.returnFromInterrupt()
+		case isa.JALR_EI:
+			c.interruptsEnabled = true
+			c.Pc += isa.INSTRUCTION_SIZE
+		case isa.JALR_DI:
+			c.interruptsEnabled = false
+			c.Pc += isa.INSTRUCTION_SIZE
+		default:
+			return fmt.Errorf("unknown JALR function %#x", instr.Function)
+		}
+	case isa.SHL:
+		c.Registers[instr.Rd] <<= instr.Imm4
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.SHR:
+		c.Registers[instr.Rd] = isa.Register(uint16(c.Registers[instr.Rd]) >> instr.Imm4)
+		c.Pc += isa.INSTRUCTION_SIZE
+	case isa.SHRA:
+		c.Registers[instr.Rd] = isa.Register(int16(c.Registers[instr.Rd]) >> instr.Imm4)
+		c.Pc += isa.INSTRUCTION_SIZE
+	default:
+		return fmt.Errorf("unknown instruction code %#x", instr.Opcode)
+	}
+
+	return nil
+}
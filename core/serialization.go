@@ -11,6 +11,13 @@ import (
 	"mrav/isa"
 )
 
+var stateToProto = map[State]proto.ExecutionState{
+	STATE_READY:         proto.ExecutionState_EXECUTION_STATE_READY,
+	STATE_FETCH_AND_RUN: proto.ExecutionState_EXECUTION_STATE_FETCH_AND_RUN,
+	STATE_LW_WAITING:    proto.ExecutionState_EXECUTION_STATE_LW_WAITING,
+	STATE_SW_WAITING:    proto.ExecutionState_EXECUTION_STATE_SW_WAITING,
+}
+
 func (c *Core) Serialize() *proto.CoreState {
 	regs := make([]uint32, len(c.Registers))
 
@@ -19,17 +26,53 @@ func (c *Core) Serialize() *proto.CoreState {
 	}
 
 	return &proto.CoreState{
-		Pc: uint32(c.Pc),
-		R:  regs,
+		Pc:                uint32(c.Pc),
+		R:                 regs,
+		Sp:                uint32(c.Sp),
+		Epc:               uint32(c.Epc),
+		State:             stateToProto[c.state],
+		Instruction:       uint32(c.instruction),
+		InterruptsEnabled: c.interruptsEnabled,
+		InterruptVector:   protobuf.Uint32(uint32(c.interruptVector)),
+
+		TrapEpc:               uint32(c.TrapEpc),
+		InTrap:                c.inTrap,
+		TrapInterruptsEnabled: c.trapInterruptsEnabled,
 	}
 }
 
-func Deserialize(protoCore *proto.CoreState) (*Core, error) {
+// Deserialize restores the core from the snapshot. Logging options are not a part of the snapshot, they are taken from
+// the given options instead.
+func Deserialize(protoCore *proto.CoreState, opts *CoreOpts) (*Core, error) {
 	if protoCore.Pc > math.MaxUint16 {
 		return nil, fmt.Errorf("cannot deserialize the core, PC too large: %X", protoCore.Pc)
 	}
 
-	regs := make([]isa.Register, 0, isa.RegsNumber)
+	if protoCore.Sp > math.MaxUint16 {
+		return nil, fmt.Errorf("cannot deserialize the core, SP too large: %X", protoCore.Sp)
+	}
+
+	if protoCore.Epc > math.MaxUint16 {
+		return nil, fmt.Errorf("cannot deserialize the core, EPC too large: %X", protoCore.Epc)
+	}
+
+	if protoCore.TrapEpc > math.MaxUint16 {
+		return nil, fmt.Errorf("cannot deserialize the core, trap EPC too large: %X", protoCore.TrapEpc)
+	}
+
+	if protoCore.Instruction > math.MaxUint16 {
+		return nil, fmt.Errorf("cannot deserialize the core, instruction too large: %X", protoCore.Instruction)
+	}
+
+	if protoCore.GetInterruptVector() > math.MaxUint16 {
+		return nil, fmt.Errorf("cannot deserialize the core, interrupt vector too large: %X", protoCore.GetInterruptVector())
+	}
+
+	if len(protoCore.R) != int(isa.RegsNumber) {
+		return nil, fmt.Errorf("cannot deserialize the core, expected %d registers, got %d", isa.RegsNumber, len(protoCore.R))
+	}
+
+	var regs isa.GeneralRegisters
 
 	for i := range protoCore.R {
 		if protoCore.R[i] > math.MaxUint16 {
@@ -39,9 +82,43 @@ func Deserialize(protoCore *proto.CoreState) (*Core, error) {
 		regs[i] = isa.Register(protoCore.R[i])
 	}
 
+	state, found := STATE_READY, false
+
+	for modelState, protoState := range stateToProto {
+		if protoState == protoCore.State {
+			state, found = modelState, true
+			break
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("cannot deserialize the core, unknown state: %v", protoCore.State)
+	}
+
+	interruptVector := DEFAULT_INTERRUPT_VECTOR
+
+	if protoCore.InterruptVector != nil {
+		interruptVector = isa.Register(protoCore.GetInterruptVector())
+	}
+
 	return &Core{
+		Registers: regs,
 		Pc:        isa.Register(protoCore.Pc),
-		Registers: isa.GeneralRegisters(regs),
+		Sp:        isa.Register(protoCore.Sp),
+		Epc:       isa.Register(protoCore.Epc),
+		TrapEpc:   isa.Register(protoCore.TrapEpc),
+
+		logger:  opts.Logger,
+		verbose: opts.Verbose,
+
+		state:       state,
+		instruction: isa.Register(protoCore.Instruction),
+
+		interruptsEnabled: protoCore.InterruptsEnabled,
+		interruptVector:   interruptVector,
+
+		inTrap:                protoCore.InTrap,
+		trapInterruptsEnabled: protoCore.TrapInterruptsEnabled,
 	}, nil
 }
 
@@ -55,14 +132,14 @@ func (c *Core) SerializeToBytes() ([]byte, error) {
 	return coreBytes, nil
 }
 
-func DeserializeFromBytes(coreBytes []byte) (*Core, error) {
+func DeserializeFromBytes(coreBytes []byte, opts *CoreOpts) (*Core, error) {
 	coreProto := &proto.CoreState{}
 
 	if err := protobuf.Unmarshal(coreBytes, coreProto); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal from bytes, proto error: %w", err)
 	}
 
-	modelCore, err := Deserialize(coreProto)
+	modelCore, err := Deserialize(coreProto, opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("cannot unmarshal from bytes, model error: %w", err)
@@ -85,14 +162,14 @@ func (c *Core) SnapshotToFile(filePath string) error {
 	return nil
 }
 
-func ReadSnapshotFromFile(filePath string) (*Core, error) {
+func ReadSnapshotFromFile(filePath string, opts *CoreOpts) (*Core, error) {
 	fileBytes, err := os.ReadFile(filePath)
 
 	if err != nil {
 		return nil, fmt.Errorf("cannot read core from file, file read error: %w", err)
 	}
 
-	modelCore, err := DeserializeFromBytes(fileBytes)
+	modelCore, err := DeserializeFromBytes(fileBytes, opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("cannot read core from file, deserialization error: %w", err)
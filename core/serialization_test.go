@@ -0,0 +1,104 @@
+package core
+
+import (
+	"testing"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"mrav/isa"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	vector := isa.Register(0x0000)
+	opts := &CoreOpts{InterruptVector: &vector}
+	c := NewCore(opts)
+
+	for i := range c.Registers {
+		c.Registers[i] = isa.Register(0x1111 * i)
+	}
+
+	c.Pc = 0x0042
+	c.Sp = 0x00F0
+	c.Epc = 0x0024
+	c.interruptsEnabled = true
+	c.TrapEpc = 0x0030
+	c.inTrap = true
+	c.trapInterruptsEnabled = true
+
+	snapshot, err := c.SerializeToBytes()
+
+	if err != nil {
+		t.Fatalf("cannot snapshot: %v", err)
+	}
+
+	restored, err := DeserializeFromBytes(snapshot, &CoreOpts{})
+
+	if err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	if !protobuf.Equal(c.Serialize(), restored.Serialize()) {
+		t.Fatalf("restored core diverged, expected %v, got %v", c.Serialize(), restored.Serialize())
+	}
+
+	if restored.interruptVector != 0x0000 {
+		t.Fatalf("expected the interrupt vector 0000 to be kept, got %04X", restored.interruptVector)
+	}
+}
+
+// A snapshot taken while the core waits for the data of LW or SW resumes the instruction with the bus value.
+func TestRestoreWaitingForData(t *testing.T) {
+	for _, opcode := range []isa.InstructionCode{isa.LW, isa.SW} {
+		mnemonic, err := isa.InstructionToString(opcode)
+
+		if err != nil {
+			t.Fatalf("cannot name opcode %X: %v", opcode, err)
+		}
+
+		opts := &CoreOpts{}
+		c := NewCore(opts)
+		c.Registers[1] = 0x0080
+		c.Registers[2] = 0x1234
+		instruction := (isa.Register(opcode) << 12) | (1 << 8) | (2 << 4)
+
+		if _, _, err := c.MultiturnRunInstruction(0); err != nil {
+			t.Fatalf("cannot fetch %s: %v", mnemonic, err)
+		}
+
+		if _, _, err := c.MultiturnRunInstruction(isa.BusValue(instruction)); err != nil {
+			t.Fatalf("cannot run %s: %v", mnemonic, err)
+		}
+
+		snapshot, err := c.SerializeToBytes()
+
+		if err != nil {
+			t.Fatalf("cannot snapshot %s: %v", mnemonic, err)
+		}
+
+		restored, err := DeserializeFromBytes(snapshot, opts)
+
+		if err != nil {
+			t.Fatalf("cannot restore %s: %v", mnemonic, err)
+		}
+
+		for _, resumed := range []*Core{c, restored} {
+			_, signals, err := resumed.MultiturnRunInstruction(0xBEEF)
+
+			if err != nil {
+				t.Fatalf("cannot resume %s: %v", mnemonic, err)
+			}
+
+			if (len(signals) != 1) || (signals[0] != SIGNAL_DONE) {
+				t.Fatalf("expected %s to be done after the data, got %v", mnemonic, signals)
+			}
+		}
+
+		if !protobuf.Equal(c.Serialize(), restored.Serialize()) {
+			t.Fatalf("restored %s diverged, expected %v, got %v", mnemonic, c.Serialize(), restored.Serialize())
+		}
+
+		if restored.Pc != 0x0002 {
+			t.Fatalf("expected %s to finish at 0002, got %04X", mnemonic, restored.Pc)
+		}
+	}
+}
@@ -4,24 +4,8 @@ typedef enum logic [1:0] {
     CORE_SW_WRITE = 2'b10
 } state_t;
 
-typedef enum logic [3:0] {
-    MRAV_ADD = 4'h0,
-    MRAV_SUB = 4'h1,
-    MRAV_LW = 4'h2,
-    MRAV_SW = 4'h3,
-    MRAV_XOR = 4'h4,
-    MRAV_AND = 4'h5,
-    MRAV_OR = 4'h6,
-    MRAV_ADDI = 4'h7,
-    MRAV_LDHI = 4'h8,
-    MRAV_BZ = 4'h9,
-    MRAV_BNZ = 4'hA,
-    MRAV_JAL = 4'hB,
-    MRAV_JALR = 4'hC,
-    MRAV_SHL = 4'hD,
-    MRAV_SHR = 4'hE,
-    MRAV_SHRA = 4'hF
-} instruction_t;
+// The opcodes come from the generated ISA package.
+import mrav_isa::*;
 
 function instruction_t decode_instruction(logic[MRAV_DATA_WIDTH-1:0] instruction_value);
     return instruction_t'(instruction_value[15:12]); // TODO: do not hardcode
@@ -181,6 +165,8 @@ module mrav_core(
                             state_d = CORE_READY;
                         end
                         MRAV_JALR: begin
+                            // The lowest 4 bits are ignored, so reti, ei and di run as the plain jump. The
+                            // interrupts are only in the Go simulation for now.
                             pc_d = r_q[rs1];
                             r_d[rd] = pc_q + 2;
                             state_d = CORE_READY;
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"mrav/hardware/rtl/isa/generator"
+)
+
+func main() {
+	rtlFile := flag.String("rtl_file", "", "output RTL file containing the ISA package")
+
+	flag.Parse()
+
+	outputFile, err := os.Create(*rtlFile)
+
+	if err != nil {
+		log.Fatalf("cannot prepare the output RTL file: %v", err)
+	}
+
+	defer outputFile.Close()
+
+	opts, err := generator.NewIsaGenOpts(outputFile)
+
+	if err != nil {
+		log.Fatalf("cannot derive the opcodes from the ISA: %v", err)
+	}
+
+	if err := generator.GenerateIsa(opts); err != nil {
+		log.Fatalf("cannot generate the code: %v", err)
+	}
+}
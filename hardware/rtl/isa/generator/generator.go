@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/template"
+
+	"mrav/isa"
+)
+
+type Encoding struct {
+	Name string
+	Code uint8
+}
+
+type IsaGenOpts struct {
+	Opcodes       []*Encoding
+	JalrFunctions []*Encoding
+	Writer        io.Writer
+}
+
+//go:embed isa_tpl.sv
+var templateFS embed.FS
+
+// NewIsaGenOpts derives the opcodes and the JALR functions from the ISA table. An opcode is named after the
+// instruction with the zero function, which is the only instruction for all the opcodes except JALR.
+func NewIsaGenOpts(writer io.Writer) (*IsaGenOpts, error) {
+	opts := &IsaGenOpts{
+		Opcodes:       make([]*Encoding, 0),
+		JalrFunctions: make([]*Encoding, 0),
+		Writer:        writer,
+	}
+
+	for _, spec := range isa.InstructionSet {
+		name := strings.ToUpper(spec.Mnemonic)
+
+		if spec.Opcode == isa.JALR {
+			opts.JalrFunctions = append(opts.JalrFunctions, &Encoding{Name: name, Code: uint8(spec.Function)})
+		}
+
+		if spec.Function == 0 {
+			opts.Opcodes = append(opts.Opcodes, &Encoding{Name: name, Code: uint8(spec.Opcode)})
+		}
+	}
+
+	byCode := func(a, b *Encoding) int {
+		return int(a.Code) - int(b.Code)
+	}
+
+	slices.SortFunc(opts.Opcodes, byCode)
+	slices.SortFunc(opts.JalrFunctions, byCode)
+
+	for i := 1; i < len(opts.Opcodes); i++ {
+		if opts.Opcodes[i].Code == opts.Opcodes[i-1].Code {
+			return nil, fmt.Errorf("opcode 0x%X is defined by both '%s' and '%s'", opts.Opcodes[i].Code, opts.Opcodes[i-1].Name, opts.Opcodes[i].Name)
+		}
+	}
+
+	return opts, nil
+}
+
+func GenerateIsa(isaOpts *IsaGenOpts) error {
+	funcMap := template.FuncMap{
+		"isLast": func(idx int, encodings []*Encoding) bool {
+			return idx == (len(encodings) - 1)
+		},
+	}
+
+	tpl := template.New("isa_tpl.sv").Funcs(funcMap)
+	tmpl, err := tpl.ParseFS(templateFS, "isa_tpl.sv")
+
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(isaOpts.Writer, *isaOpts); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -49,8 +49,7 @@ def _mrav_bus_rtl_impl(ctx):
     dev_descriptor = ctx.actions.declare_file("%s_descriptor" % ctx.attr.name)
     devs = ctx.attr.devices
 
-    # TODO: ensure there is no address overlap
-
+    # The address overlaps are checked by the codegen.
     devices = []
     for dev in devs:
         dev_info = dev[BusDeviceInfo]
@@ -63,12 +62,19 @@ def _mrav_bus_rtl_impl(ctx):
     ctx.actions.write(dev_descriptor, json.encode({"descriptor": devices}))
 
     output_file = ctx.outputs.out
+    inputs = [dev_descriptor]
+    arguments = ["--devices_file", dev_descriptor.path, "--rtl_file", output_file.path]
+
+    # The devices are checked against the system description shared with the simulator.
+    if ctx.file.system:
+        inputs.append(ctx.file.system)
+        arguments.extend(["--system_file", ctx.file.system.path])
 
     ctx.actions.run(
         outputs = [output_file],
-        inputs = [dev_descriptor],
+        inputs = inputs,
         executable = ctx.executable.codegen,
-        arguments = ["--devices_file", dev_descriptor.path, "--rtl_file", output_file.path],
+        arguments = arguments,
         progress_message = "Running bus codegen",
     )
 
@@ -87,6 +93,10 @@ mrav_bus_rtl = rule(
             doc = "Output label for the bus RTL code",
             mandatory = True,
         ),
+        "system": attr.label(
+            doc = "System description JSON file, the devices have to match its RTL devices.",
+            allow_single_file = [".json"],
+        ),
         "codegen": attr.label(
             default = Label("//hardware/rtl/mravbus/generator/codegen"),
             allow_files = True,
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"mrav/hardware/rtl/mravbus/generator"
+	"mrav/system/description"
 )
 
 type BusDevicesDescriptor struct {
@@ -15,22 +16,41 @@ type BusDevicesDescriptor struct {
 
 func main() {
 	devicesFile := flag.String("devices_file", "", "JSON file describing the devices connecting to the bus")
+	systemFile := flag.String("system_file", "", "system description shared with the simulator, the bus gets its RTL devices (and checks them against --devices_file if given)")
 	rtlFile := flag.String("rtl_file", "", "output RTL file containing Verilog")
 
 	flag.Parse()
 
-	devicesFileHandle, err := os.ReadFile(*devicesFile)
-
-	if err != nil {
-		log.Fatalf("cannot open the devices JSON file: %v", err)
+	if (*devicesFile == "") && (*systemFile == "") {
+		log.Fatalf("either the devices JSON file or the system description is needed")
 	}
 
 	var descriptor BusDevicesDescriptor
 
-	err = json.Unmarshal(devicesFileHandle, &descriptor)
+	if *devicesFile != "" {
+		devicesFileHandle, err := os.ReadFile(*devicesFile)
 
-	if err != nil {
-		log.Fatalf("cannot read the JSON descriptor: %v", err)
+		if err != nil {
+			log.Fatalf("cannot open the devices JSON file: %v", err)
+		}
+
+		err = json.Unmarshal(devicesFileHandle, &descriptor)
+
+		if err != nil {
+			log.Fatalf("cannot read the JSON descriptor: %v", err)
+		}
+	}
+
+	var desc *description.System
+
+	if *systemFile != "" {
+		loaded, err := description.ReadFromFile(*systemFile)
+
+		if err != nil {
+			log.Fatalf("cannot load the system description: %v", err)
+		}
+
+		desc = loaded
 	}
 
 	outputFile, err := os.Create(*rtlFile)
@@ -44,6 +64,7 @@ func main() {
 	opts := &generator.BusGenOpts{
 		Peripherals: descriptor.Descriptor,
 		Writer:      outputFile,
+		System:      desc,
 	}
 
 	if err := generator.GenerateBus(opts); err != nil {
@@ -2,8 +2,12 @@ package generator
 
 import (
 	"embed"
+	"fmt"
 	"io"
+	"slices"
 	"text/template"
+
+	"mrav/system/description"
 )
 
 type Peripheral struct {
@@ -15,12 +19,101 @@ type Peripheral struct {
 type BusGenOpts struct {
 	Peripherals []*Peripheral
 	Writer      io.Writer
+
+	// The RTL devices of the system description are put on the bus when it's set. The peripherals, if any, have to
+	// match them, which catches the Bazel device rules drifting away from the description.
+	System *description.System
 }
 
 //go:embed bus_tpl.sv
 var templateFS embed.FS
 
+// PeripheralsFromDescription returns the devices of the system description that are a part of the RTL.
+func PeripheralsFromDescription(desc *description.System) []*Peripheral {
+	var periphs []*Peripheral
+
+	for _, dev := range desc.Devices {
+		if !dev.In(description.TARGET_RTL) {
+			continue
+		}
+
+		periphs = append(periphs, &Peripheral{
+			DeviceId: dev.Id,
+			AddrLo:   int(dev.Base),
+			AddrHi:   int(dev.Last()),
+		})
+	}
+
+	return periphs
+}
+
+func checkPeripherals(periphs []*Peripheral) error {
+	sorted := slices.Clone(periphs)
+
+	for _, periph := range sorted {
+		if periph.AddrLo > periph.AddrHi {
+			return fmt.Errorf("device '%s' has the low address %04X above the high address %04X", periph.DeviceId, periph.AddrLo, periph.AddrHi)
+		}
+	}
+
+	slices.SortStableFunc(sorted, func(a, b *Peripheral) int {
+		return a.AddrLo - b.AddrLo
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].AddrLo <= sorted[i-1].AddrHi {
+			return fmt.Errorf("devices '%s' and '%s' overlap on the bus", sorted[i-1].DeviceId, sorted[i].DeviceId)
+		}
+	}
+
+	return nil
+}
+
+func matchPeripherals(periphs []*Peripheral, described []*Peripheral) error {
+	byId := make(map[string]*Peripheral)
+
+	for _, periph := range described {
+		byId[periph.DeviceId] = periph
+	}
+
+	for _, periph := range periphs {
+		expected, found := byId[periph.DeviceId]
+
+		if !found {
+			return fmt.Errorf("device '%s' is not in the system description", periph.DeviceId)
+		}
+
+		if (periph.AddrLo != expected.AddrLo) || (periph.AddrHi != expected.AddrHi) {
+			return fmt.Errorf("device '%s' is at %04X-%04X, the system description has it at %04X-%04X", periph.DeviceId, periph.AddrLo, periph.AddrHi, expected.AddrLo, expected.AddrHi)
+		}
+	}
+
+	if len(periphs) != len(described) {
+		return fmt.Errorf("the system description has %d RTL devices, the bus is given %d", len(described), len(periphs))
+	}
+
+	return nil
+}
+
 func GenerateBus(busOpts *BusGenOpts) error {
+	opts := *busOpts
+
+	if opts.System != nil {
+		described := PeripheralsFromDescription(opts.System)
+
+		if len(opts.Peripherals) > 0 {
+			if err := matchPeripherals(opts.Peripherals, described); err != nil {
+				return fmt.Errorf("bus devices don't match the system description: %w", err)
+			}
+		}
+
+		opts.Peripherals = described
+	}
+
+	if err := checkPeripherals(opts.Peripherals); err != nil {
+		return err
+	}
+
 	funcMap := template.FuncMap{
 		"isLast": func(idx int, periphs []*Peripheral) bool {
 			return idx == (len(periphs) - 1)
@@ -34,7 +127,7 @@ func GenerateBus(busOpts *BusGenOpts) error {
 		return err
 	}
 
-	if err := tmpl.Execute(busOpts.Writer, *busOpts); err != nil {
+	if err := tmpl.Execute(opts.Writer, opts); err != nil {
 		return err
 	}
 
@@ -1,89 +1,106 @@
 load("//hardware/rtl/mravbus/build_defs:bus.bzl", "mrav_bus_device", "mrav_bus_rtl", "mrav_bus_stitch_rtl")
 load("//hardware/rtl/mravbus/build_defs:software.bzl", "mrav_bus_addr_module")
 load("//hardware/rtl/mravbus/components/memory/build_defs:generation.bzl", "mrav_imaged_memory")
+load("//hardware/rtl/soc/build_defs:mrav_small_devices.bzl", "DEVICES")
 load("//hardware/rtl/soc/build_defs:top.bzl", "mrav_top")
 
-def mrav_small(name, software, soc_top, gpio_verilog):
-    memory_label = "%s_ram_programmed" % name
-    ram_programmed_rtl = "%s_ram_programmed.sv" % name
+def _address_bits(size):
+    bits = 1
+    for _ in range(16):
+        if (1 << bits) >= size:
+            break
+        bits += 1
+    return bits
+
+def _memory_device(name, dev, device_label, software):
+    if dev["params"].get("image") != "software":
+        fail("memory '%s' has to load the software image" % dev["id"])
+
+    memory_label = "%s_%s_programmed" % (name, dev["id"])
+    programmed_rtl = "%s_%s_programmed.sv" % (name, dev["id"])
+    memory_size = dev["addr_hi"] - dev["addr_lo"] + 1
 
     mrav_imaged_memory(
         name = memory_label,
-        memory_size = 64,
+        memory_size = memory_size,
         image = software,
         top_module = "memory",
-        out = ram_programmed_rtl,
-        internal_address_generation = "5:0",
+        out = programmed_rtl,
+        internal_address_generation = "%d:0" % (_address_bits(memory_size) - 1),
     )
 
-    mem_device_label = "%s_mem" % name
-
     mrav_bus_device(
-        name = mem_device_label,
-        device_id = "mem",
-        addr_lo = 0x0000,
-        addr_hi = 0x005F,
+        name = device_label,
+        device_id = dev["id"],
+        addr_lo = dev["addr_lo"],
+        addr_hi = dev["addr_hi"],
         top = "memory",
-        verilog = ram_programmed_rtl,
+        verilog = programmed_rtl,
     )
 
-    gpio_device_label = "%s_gpio" % name
+    return {
+        "clk": "clk",
+    }
 
+def _gpio_device(name, dev, device_label, gpio_verilog):
     mrav_bus_device(
-        name = gpio_device_label,
-        device_id = "gpio",
-        addr_lo = 0x0070,
-        addr_hi = 0x0070,
+        name = device_label,
+        device_id = dev["id"],
+        addr_lo = dev["addr_lo"],
+        addr_hi = dev["addr_hi"],
         top = "gpio",
         verilog = gpio_verilog,
     )
 
-    gpio_lib_label = "%s_lib" % gpio_device_label
-    gpio_lib_module = "%s_gpio_lib.mrav" % name
-
+    # The software gets the address of the device as <ID>_ADDR.
     mrav_bus_addr_module(
-        name = gpio_lib_label,
-        bus_device = gpio_device_label,
-        symbol_prefix = "GPIO",
-        out = gpio_lib_module,
+        name = "%s_lib" % device_label,
+        bus_device = device_label,
+        symbol_prefix = dev["id"].upper(),
+        out = "%s_%s_lib.mrav" % (name, dev["id"]),
     )
 
+    return {
+        "clk": "clk",
+        "rst_n": "rst_n",
+        "external_output": "gpio",
+    }
+
+# The devices and their addresses come from mrav_small.json, through the generated mrav_small_devices.bzl.
+def mrav_small(name, software, soc_top, gpio_verilog, system = "//hardware/rtl/soc:mrav_small.json"):
+    device_labels = []
+    stitch_labels = []
+
+    for dev in DEVICES:
+        device_label = "%s_%s" % (name, dev["id"])
+
+        if dev["type"] == "memory":
+            connections = _memory_device(name, dev, device_label, software)
+        elif dev["type"] == "gpio":
+            connections = _gpio_device(name, dev, device_label, gpio_verilog)
+        else:
+            fail("mrav_small has no RTL for the device '%s' of type '%s'" % (dev["id"], dev["type"]))
+
+        stitch_label = "%s_stitch" % device_label
+
+        mrav_bus_stitch_rtl(
+            name = stitch_label,
+            device = device_label,
+            out = "%s_stitch.sv" % device_label,
+            additional_connections = connections,
+        )
+
+        device_labels.append(device_label)
+        stitch_labels.append(stitch_label)
+
     simple_bus_label = "%s_simple_bus" % name
     simple_bus_rtl = "%s_simple_bus.sv" % name
 
     mrav_bus_rtl(
         name = simple_bus_label,
-        devices = [
-            gpio_device_label,
-            mem_device_label,
-        ],
+        devices = device_labels,
         out = simple_bus_rtl,
-    )
-
-    mem_stitch_label = "%s_mem_stitch" % name
-    mem_stitch_rtl = "%s_mem_stitch.sv" % name
-
-    mrav_bus_stitch_rtl(
-        name = mem_stitch_label,
-        device = mem_device_label,
-        out = mem_stitch_rtl,
-        additional_connections = {
-            "clk": "clk",
-        },
-    )
-
-    gpio_stitch_label = "%s_gpio_stitch" % name
-    gpio_stitch_rtl = "%s_gpio_stitch.sv" % name
-
-    mrav_bus_stitch_rtl(
-        name = gpio_stitch_label,
-        device = gpio_device_label,
-        out = gpio_stitch_rtl,
-        additional_connections = {
-            "clk": "clk",
-            "rst_n": "rst_n",
-            "external_output": "gpio",
-        },
+        system = system,
     )
 
     bundle_rtl = "%s_bundle.sv" % name
@@ -91,10 +108,7 @@ def mrav_small(name, software, soc_top, gpio_verilog):
     mrav_top(
         name = name,
         bus_rtl = simple_bus_rtl,
-        stitched_devices = [
-            gpio_stitch_label,
-            mem_stitch_label,
-        ],
+        stitched_devices = stitch_labels,
         core_rtl_bundle = "//hardware/rtl:mrav_core.sv",
         top_rtl = soc_top,
         out = bundle_rtl,
@@ -0,0 +1,20 @@
+# Generated from mrav_small.json by //system/description/bzlgen, don't edit.
+
+DEVICES = [
+    {
+        "id": "mem",
+        "type": "memory",
+        "addr_lo": 0x0000,
+        "addr_hi": 0x003F,
+        "params": {
+            "image": "software",
+        },
+    },
+    {
+        "id": "gpio",
+        "type": "gpio",
+        "addr_lo": 0x0070,
+        "addr_hi": 0x0070,
+        "params": {},
+    },
+]
@@ -0,0 +1,117 @@
+from cocotb import triggers
+
+from core.proto import trace_pb2
+
+# Values of state_t in core.sv
+CORE_READY = 0
+CORE_LW_READ = 1
+CORE_SW_WRITE = 2
+
+
+def _read_varint(f):
+    value = 0
+    shift = 0
+
+    while True:
+        b = f.read(1)
+
+        if not b:
+            return None
+
+        value |= (b[0] & 0x7F) << shift
+        shift += 7
+
+        if not (b[0] & 0x80):
+            return value
+
+
+def read_trace(file_path):
+    """Reads the records of a binary trace, like the one written by memonly with --trace_format=binary."""
+    records = []
+
+    with open(file_path, 'rb') as f:
+        while (size := _read_varint(f)) is not None:
+            record = trace_pb2.TraceRecord()
+            record.ParseFromString(f.read(size))
+            records.append(record)
+
+    return records
+
+
+def _varint(value):
+    output = bytearray()
+
+    while True:
+        low_bits = value & 0x7F
+        value >>= 7
+
+        if value:
+            output.append(low_bits | 0x80)
+        else:
+            output.append(low_bits)
+            return bytes(output)
+
+
+class TraceRecorder:
+    """Records the retired instructions of the core in the format of core/proto/trace.proto.
+
+    Each bus transaction of the core takes one clock, so the state of the core and the bus are sampled once per clock.
+    An instruction is done when the core gets back to CORE_READY, and the register writes are taken from the register
+    file changes, as the RTL can't tell a write of the same value apart from no write.
+    """
+
+    def __init__(self, dut):
+        self.dut = dut
+        self.active = True
+        self.records = []
+
+    def _registers(self):
+        return [int(self.dut.r_q[i].value) for i in range(16)]
+
+    def _finish(self, record, regs_before, regs_after):
+        for i, (old_value, new_value) in enumerate(zip(regs_before, regs_after)):
+            if old_value != new_value:
+                record.register_writes.add(register=i, old_value=old_value, new_value=new_value)
+
+        self.records.append(record)
+
+    async def work(self):
+        cycle = 0
+        record = None
+        regs_before = None
+
+        # Started right after the reset, when the first fetch is already on the bus.
+        await triggers.ReadOnly()
+
+        while self.active:
+            state = int(self.dut.state_q.value)
+
+            if state == CORE_READY:
+                regs = self._registers()
+
+                if record is not None:
+                    self._finish(record, regs_before, regs)
+
+                pc = int(self.dut.pc_q.value)
+                instruction = int(self.dut.data_in.value)
+
+                regs_before = regs
+                record = trace_pb2.TraceRecord(cycle=cycle, pc=pc, instruction=instruction)
+                record.bus_accesses.add(kind=trace_pb2.BUS_ACCESS_KIND_FETCH, address=pc, value=instruction)
+            elif (state == CORE_LW_READ) and (record is not None):
+                record.bus_accesses.add(kind=trace_pb2.BUS_ACCESS_KIND_READ, address=int(self.dut.addr.value), value=int(self.dut.data_in.value))
+            elif (state == CORE_SW_WRITE) and (record is not None):
+                record.bus_accesses.add(kind=trace_pb2.BUS_ACCESS_KIND_WRITE, address=int(self.dut.addr.value), value=int(self.dut.data_out.value))
+
+            cycle += 1
+
+            await triggers.FallingEdge(self.dut.clk)
+            await triggers.ReadOnly()
+
+    def write(self, file_path):
+        """Writes the finished records, each prefixed with its size as a varint."""
+        with open(file_path, 'wb') as f:
+            for record in self.records:
+                payload = record.SerializeToString()
+                f.write(_varint(len(payload)))
+                f.write(payload)
@@ -5,23 +5,6 @@ import (
 	"strings"
 )
 
-//     Add: 0, // 0x0, add rd rs1 rs2
-//     Sub: 1, // 0x1, sub rd rs1 rs2
-//     Lw: 2, // 0x2, lw rd rs1 xxxx
-//     Sw: 3, // 0x3, sw rd rs1 xxxx
-//     Xor: 4, // 0x4, xor rd rs1 rs2
-//     And: 5, // 0x5, and rd rs1 rs2
-//     Or: 6, // 0x6, or rd rs1 rs2
-//     Addi: 7, // 0x7, addi rd imm8
-//     Ldhi: 8, // 0x8, ldhi rd imm8
-//     Bz: 9, // 0x9, bz rd imm8
-//     Bnz: 10, // 0xA, bnz rd imm8
-//     Jal: 11, // 0xB, jal rd imm8
-//     Jalr: 12, // 0xC, jalr rd rs1 xxxx
-//     Shl: 13, // 0xD, shl rd imm4 xxxx
-//     Shr: 14, // 0xE, shr rd imm4 xxxx
-//     Shra: 15, // 0xF, shra rd imm4 xxxx
-
 const (
 	RegsNumber uint8      = 16
 	MinRegId   RegisterId = 0
@@ -32,6 +15,7 @@ type RegisterId uint8
 type Register uint16
 type GeneralRegisters [RegsNumber]Register
 
+// Opcodes, the instructions themselves are defined in InstructionSet.
 type InstructionCode uint8
 
 const (
@@ -54,85 +38,38 @@ const (
 )
 
 func StringToInstruction(instruction string) (InstructionCode, error) {
-	uppered := strings.ToUpper(instruction)
-
-	switch uppered {
-	case "ADD":
-		return ADD, nil
-	case "SUB":
-		return SUB, nil
-	case "LW":
-		return LW, nil
-	case "SW":
-		return SW, nil
-	case "XOR":
-		return XOR, nil
-	case "AND":
-		return AND, nil
-	case "OR":
-		return OR, nil
-	case "ADDI":
-		return ADDI, nil
-	case "LDHI":
-		return LDHI, nil
-	case "BZ":
-		return BZ, nil
-	case "BNZ":
-		return BNZ, nil
-	case "JAL":
-		return JAL, nil
-	case "JALR":
-		return JALR, nil
-	case "SHL":
-		return SHL, nil
-	case "SHR":
-		return SHR, nil
-	case "SHRA":
-		return SHRA, nil
-	default:
-		return 0, fmt.Errorf("unknown instruction: '%s'", uppered)
+	spec, err := SpecByMnemonic(instruction)
+
+	if (err != nil) || (spec.Function != JALR_JUMP) {
+		return 0, fmt.Errorf("unknown instruction: '%s'", strings.ToUpper(instruction))
 	}
+
+	return spec.Opcode, nil
 }
 
 func InstructionToString(instruction InstructionCode) (string, error) {
-	switch instruction {
-	case ADD:
-		return "ADD", nil
-	case SUB:
-		return "SUB", nil
-	case LW:
-		return "LW", nil
-	case SW:
-		return "SW", nil
-	case XOR:
-		return "XOR", nil
-	case AND:
-		return "AND", nil
-	case OR:
-		return "OR", nil
-	case ADDI:
-		return "ADDI", nil
-	case LDHI:
-		return "LDHI", nil
-	case BZ:
-		return "BZ", nil
-	case BNZ:
-		return "BNZ", nil
-	case JAL:
-		return "JAL", nil
-	case JALR:
-		return "JALR", nil
-	case SHL:
-		return "SHL", nil
-	case SHR:
-		return "SHR", nil
-	case SHRA:
-		return "SHRA", nil
-	default:
+	spec, err := SpecByOpcode(instruction, JALR_JUMP)
+
+	if err != nil {
 		return "", fmt.Errorf("unknown instruction: '0x%02X'", instruction)
 	}
+
+	return strings.ToUpper(spec.Mnemonic), nil
 }
 
+// JALR does not use the lowest 4 bits of the instruction, so they select between the plain jump and the interrupt control instructions.
+// The other values are reserved, and run as the plain jump.
+//
+// The RTL core doesn't implement the interrupts yet, and runs all of them as the plain jump, including RETI, EI and DI.
+type JalrFunction uint8
+
+const (
+	JALR_JUMP JalrFunction = 0x0
+	JALR_RETI JalrFunction = 0x1
+	JALR_EI   JalrFunction = 0x2
+	JALR_DI   JalrFunction = 0x3
+)
+
 type BusAccessRead struct {
 	Address Register
 }
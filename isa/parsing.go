@@ -23,3 +23,7 @@ func Imm8(instructionRegister Register) uint8 {
 func Imm4(instructionRegister Register) uint8 {
 	return uint8((instructionRegister & 0x00F0) >> 4)
 }
+
+func ParseJalrFunction(instructionRegister Register) JalrFunction {
+	return JalrFunction(instructionRegister & 0x000F)
+}
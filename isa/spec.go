@@ -0,0 +1,149 @@
+package isa
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operand formats, named after the assembly syntax. The opcode is always in the top 4 bits and rd (if used) in the 4
+// bits below it, the rest of the operands follow from the top.
+type OperandFormat uint8
+
+const (
+	FORMAT_RD_RS1_RS2  OperandFormat = iota // rd rs1 rs2
+	FORMAT_RD_RS1                           // rd rs1 xxxx
+	FORMAT_RD_IMM8                          // rd imm8
+	FORMAT_RD_IMM4                          // rd imm4 xxxx
+	FORMAT_NO_OPERANDS                      // xxxx xxxx function
+)
+
+// Semantics classes group the instructions by what they do, for the tools that don't care about the exact operation.
+type SemanticsClass uint8
+
+const (
+	SEMANTICS_ALU               SemanticsClass = iota // rd = rs1 op rs2
+	SEMANTICS_IMMEDIATE                               // rd is changed by imm8
+	SEMANTICS_LOAD                                    // rd = mem[rs1]
+	SEMANTICS_STORE                                   // mem[rd] = rs1
+	SEMANTICS_BRANCH                                  // conditional jump to imm8
+	SEMANTICS_JUMP                                    // unconditional jump, the return address goes to rd
+	SEMANTICS_SHIFT                                   // rd shifted by imm4
+	SEMANTICS_INTERRUPT_CONTROL                       // no operands
+)
+
+type InstructionSpec struct {
+	Mnemonic  string // Lowercase, as in the assembly
+	Opcode    InstructionCode
+	Function  JalrFunction // Selects the JALR variant from the lowest 4 bits, zero for all the other instructions
+	Format    OperandFormat
+	Semantics SemanticsClass
+	WritesRd  bool
+}
+
+// InstructionSet is the definition of the Mrav ISA, everything else about the instructions (assembly syntax, encoding,
+// decoding and the RTL opcode package) is derived from it.
+var InstructionSet = []InstructionSpec{
+	{Mnemonic: "add", Opcode: ADD, Format: FORMAT_RD_RS1_RS2, Semantics: SEMANTICS_ALU, WritesRd: true},
+	{Mnemonic: "sub", Opcode: SUB, Format: FORMAT_RD_RS1_RS2, Semantics: SEMANTICS_ALU, WritesRd: true},
+	{Mnemonic: "lw", Opcode: LW, Format: FORMAT_RD_RS1, Semantics: SEMANTICS_LOAD, WritesRd: true},
+	{Mnemonic: "sw", Opcode: SW, Format: FORMAT_RD_RS1, Semantics: SEMANTICS_STORE},
+	{Mnemonic: "xor", Opcode: XOR, Format: FORMAT_RD_RS1_RS2, Semantics: SEMANTICS_ALU, WritesRd: true},
+	{Mnemonic: "and", Opcode: AND, Format: FORMAT_RD_RS1_RS2, Semantics: SEMANTICS_ALU, WritesRd: true},
+	{Mnemonic: "or", Opcode: OR, Format: FORMAT_RD_RS1_RS2, Semantics: SEMANTICS_ALU, WritesRd: true},
+	{Mnemonic: "addi", Opcode: ADDI, Format: FORMAT_RD_IMM8, Semantics: SEMANTICS_IMMEDIATE, WritesRd: true},
+	{Mnemonic: "ldhi", Opcode: LDHI, Format: FORMAT_RD_IMM8, Semantics: SEMANTICS_IMMEDIATE, WritesRd: true},
+	{Mnemonic: "bz", Opcode: BZ, Format: FORMAT_RD_IMM8, Semantics: SEMANTICS_BRANCH},
+	{Mnemonic: "bnz", Opcode: BNZ, Format: FORMAT_RD_IMM8, Semantics: SEMANTICS_BRANCH},
+	{Mnemonic: "jal", Opcode: JAL, Format: FORMAT_RD_IMM8, Semantics: SEMANTICS_JUMP, WritesRd: true},
+	{Mnemonic: "jalr", Opcode: JALR, Function: JALR_JUMP, Format: FORMAT_RD_RS1, Semantics: SEMANTICS_JUMP, WritesRd: true},
+	{Mnemonic: "reti", Opcode: JALR, Function: JALR_RETI, Format: FORMAT_NO_OPERANDS, Semantics: SEMANTICS_INTERRUPT_CONTROL},
+	{Mnemonic: "ei", Opcode: JALR, Function: JALR_EI, Format: FORMAT_NO_OPERANDS, Semantics: SEMANTICS_INTERRUPT_CONTROL},
+	{Mnemonic: "di", Opcode: JALR, Function: JALR_DI, Format: FORMAT_NO_OPERANDS, Semantics: SEMANTICS_INTERRUPT_CONTROL},
+	{Mnemonic: "shl", Opcode: SHL, Format: FORMAT_RD_IMM4, Semantics: SEMANTICS_SHIFT, WritesRd: true},
+	{Mnemonic: "shr", Opcode: SHR, Format: FORMAT_RD_IMM4, Semantics: SEMANTICS_SHIFT, WritesRd: true},
+	{Mnemonic: "shra", Opcode: SHRA, Format: FORMAT_RD_IMM4, Semantics: SEMANTICS_SHIFT, WritesRd: true},
+}
+
+func SpecByMnemonic(mnemonic string) (*InstructionSpec, error) {
+	lowered := strings.ToLower(mnemonic)
+
+	for i := range InstructionSet {
+		if InstructionSet[i].Mnemonic == lowered {
+			return &InstructionSet[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown instruction: '%s'", strings.ToUpper(mnemonic))
+}
+
+func SpecByOpcode(opcode InstructionCode, function JalrFunction) (*InstructionSpec, error) {
+	for i := range InstructionSet {
+		if (InstructionSet[i].Opcode == opcode) && (InstructionSet[i].Function == function) {
+			return &InstructionSet[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown instruction: opcode '0x%X', function '0x%X'", opcode, function)
+}
+
+// DecodeSpec finds the instruction for the instruction word. The JALR functions without an instruction of their own
+// decode as the plain jump, the same as in the RTL core.
+func DecodeSpec(instructionRegister Register) (*InstructionSpec, error) {
+	opcode := ParseInstructionCode(instructionRegister)
+	function := JalrFunction(0)
+
+	if opcode == JALR {
+		function = ParseJalrFunction(instructionRegister)
+	}
+
+	spec, err := SpecByOpcode(opcode, function)
+
+	if (err != nil) && (opcode == JALR) {
+		return SpecByOpcode(opcode, JALR_JUMP)
+	}
+
+	return spec, err
+}
+
+// Operands holds the instruction fields, the format of the instruction says which of them are used. Imm is either
+// imm8 or imm4.
+type Operands struct {
+	Rd  RegisterId
+	Rs1 RegisterId
+	Rs2 RegisterId
+	Imm uint8
+}
+
+func (spec *InstructionSpec) Encode(ops Operands) Register {
+	word := Register(spec.Opcode) << 12
+
+	switch spec.Format {
+	case FORMAT_RD_RS1_RS2:
+		word |= Register(ops.Rd&0xF)<<8 | Register(ops.Rs1&0xF)<<4 | Register(ops.Rs2&0xF)
+	case FORMAT_RD_RS1:
+		word |= Register(ops.Rd&0xF)<<8 | Register(ops.Rs1&0xF)<<4 | Register(spec.Function)
+	case FORMAT_RD_IMM8:
+		word |= Register(ops.Rd&0xF)<<8 | Register(ops.Imm)
+	case FORMAT_RD_IMM4:
+		word |= Register(ops.Rd&0xF)<<8 | Register(ops.Imm&0xF)<<4
+	case FORMAT_NO_OPERANDS:
+		word |= Register(spec.Function)
+	}
+
+	return word
+}
+
+func (spec *InstructionSpec) DecodeOperands(instructionRegister Register) Operands {
+	switch spec.Format {
+	case FORMAT_RD_RS1_RS2:
+		return Operands{Rd: ParseRd(instructionRegister), Rs1: ParseRs1(instructionRegister), Rs2: ParseRs2(instructionRegister)}
+	case FORMAT_RD_RS1:
+		return Operands{Rd: ParseRd(instructionRegister), Rs1: ParseRs1(instructionRegister)}
+	case FORMAT_RD_IMM8:
+		return Operands{Rd: ParseRd(instructionRegister), Imm: Imm8(instructionRegister)}
+	case FORMAT_RD_IMM4:
+		return Operands{Rd: ParseRd(instructionRegister), Imm: Imm4(instructionRegister)}
+	}
+
+	return Operands{}
+}
@@ -12,6 +12,7 @@ import (
 
 	"mrav/software/asm"
 	"mrav/software/format"
+	"mrav/software/symbols"
 )
 
 func readTextFiles(paths []string) ([]string, error) {
@@ -34,6 +35,7 @@ func main() {
 	debug := flag.Bool("debug", false, "enable debug output")
 	outputFile := flag.String("output", "", "path to the output program file")
 	outputFormat := flag.String("format", "human", "output format for the assembler")
+	symbolsOutputFile := flag.String("symbols_output", "", "(optional) path to the output symbol map, used by the debugging tools")
 
 	flag.Parse()
 
@@ -101,5 +103,11 @@ func main() {
 
 	outputProducer()
 
+	if *symbolsOutputFile != "" {
+		if err := symbols.FromModule(program, inputFiles).WriteToFile(*symbolsOutputFile); err != nil {
+			log.Fatalf("Cannot write the symbol map: %v", err)
+		}
+	}
+
 	logger.Info("Successfully assembled")
 }
@@ -5,13 +5,14 @@ import (
 	"mrav/isa"
 	"mrav/software/asm/parsing"
 	"mrav/software/model"
-	"slices"
+	"strings"
 )
 
 func ModuleFirstPass(m *parsing.Module) (*model.MravModule, error) {
 	assignments := make([]model.MravDefinition, 0)
 	labels := make([]model.MravLabel, 0)
 	instructions := make([]model.MravInstruction, 0)
+	sourceLines := make([]model.MravSourceLine, 0)
 
 	var runningPc isa.Register = 0
 
@@ -57,6 +58,7 @@ func ModuleFirstPass(m *parsing.Module) (*model.MravModule, error) {
 				}
 
 				instructions = append(instructions, instr)
+				sourceLines = append(sourceLines, model.MravSourceLine{Line: line.Number})
 				runningPc += 2
 				return parsing.AssemblyBlankLine() // This should do nothing
 			},
@@ -74,6 +76,7 @@ func ModuleFirstPass(m *parsing.Module) (*model.MravModule, error) {
 				}
 
 				instructions = append(instructions, instr)
+				sourceLines = append(sourceLines, model.MravSourceLine{Line: line.Number})
 				runningPc += 2
 				return parsing.AssemblyBlankLine() // This should do nothing
 			},
@@ -88,42 +91,38 @@ func ModuleFirstPass(m *parsing.Module) (*model.MravModule, error) {
 		Labels:          labels,
 		AssignedSymbols: assignments,
 		Instructions:    instructions,
+		SourceLines:     sourceLines,
 	}, nil
 }
 
 func processInstruction(inst parsing.Instruction) (model.MravInstruction, error) {
-	switch inst.CpuInstruction {
-	case isa.ADD, isa.SUB, isa.XOR, isa.AND, isa.OR:
-		instr, err := processRdRs1Rs2Instruction(inst)
-
-		if err != nil {
-			return model.MravInstruction{}, err
-		}
-
-		return instr, nil
-	case isa.ADDI, isa.LDHI, isa.BZ, isa.BNZ, isa.JAL:
-		instr, err := processRdImm8(inst)
+	spec := inst.Spec
+	stringInstruction := strings.ToUpper(spec.Mnemonic)
+	ops := model.Operands{
+		Rd: inst.Rd,
+	}
 
-		if err != nil {
-			return model.MravInstruction{}, err
+	switch spec.Format {
+	case isa.FORMAT_RD_RS1_RS2:
+		if len(inst.Args) != 2 {
+			return model.MravInstruction{}, fmt.Errorf("%s instruction should have arguments rd, rs1, rs2", stringInstruction)
 		}
 
-		return instr, nil
-	case isa.SHL, isa.SHR, isa.SHRA:
-		instr, err := processRdImm4(inst)
+		rs1, err := parsing.ParseRegister(inst.Args[0].UnprocessedValue)
 
 		if err != nil {
-			return model.MravInstruction{}, err
+			return model.MravInstruction{}, fmt.Errorf("cannot parse rs1 of %s instruction: %w", stringInstruction, err)
 		}
 
-		return instr, nil
-	case isa.LW, isa.SW, isa.JALR:
-		stringInstruction, err := isa.InstructionToString(inst.CpuInstruction)
+		rs2, err := parsing.ParseRegister(inst.Args[1].UnprocessedValue)
 
 		if err != nil {
-			return model.MravInstruction{}, err
+			return model.MravInstruction{}, fmt.Errorf("cannot parse rs2 of %s instruction: %w", stringInstruction, err)
 		}
 
+		ops.Rs1 = rs1
+		ops.Rs2 = rs2
+	case isa.FORMAT_RD_RS1:
 		if len(inst.Args) != 1 {
 			return model.MravInstruction{}, fmt.Errorf("%s instruction should have arguments rd, rs1,", stringInstruction)
 		}
@@ -134,253 +133,65 @@ func processInstruction(inst parsing.Instruction) (model.MravInstruction, error)
 			return model.MravInstruction{}, fmt.Errorf("cannot parse rs1 of %s instruction: %w", stringInstruction, err)
 		}
 
-		if inst.CpuInstruction == isa.JALR {
-			return model.MravInstruction{
-				Jalr: &model.MravJalr{
-					Rd:  inst.Rd,
-					Rs1: rs1,
-				},
-			}, nil
-		}
-
-		if inst.CpuInstruction == isa.LW {
-			return model.MravInstruction{
-				Lw: &model.MravLw{
-					Rd:  inst.Rd,
-					Rs1: rs1,
-				},
-			}, nil
-		}
-
-		return model.MravInstruction{
-			Sw: &model.MravSw{
-				Rd:  inst.Rd,
-				Rs1: rs1,
-			},
-		}, nil
-	default:
-		return model.MravInstruction{}, fmt.Errorf("unknown instruction (this should absolutely never happen!)")
-	}
-}
-
-func processRdRs1Rs2Instruction(inst parsing.Instruction) (model.MravInstruction, error) {
-	instructions := []isa.InstructionCode{isa.ADD, isa.SUB, isa.XOR, isa.AND, isa.OR}
+		ops.Rs1 = rs1
+	case isa.FORMAT_RD_IMM8:
+		immOrSymb, err := processImm8(stringInstruction, inst.Args)
 
-	stringInstruction, err := isa.InstructionToString(inst.CpuInstruction)
-
-	if err != nil {
-		return model.MravInstruction{}, err
-	}
-
-	if !slices.Contains(instructions, inst.CpuInstruction) {
-		return model.MravInstruction{}, fmt.Errorf("%s is not a 'rd rs1 rs2' instruction", stringInstruction)
-	}
-
-	if len(inst.Args) != 2 {
-		return model.MravInstruction{}, fmt.Errorf("%s instruction should have arguments rd, rs1, rs2", stringInstruction)
-	}
-
-	rs1, err := parsing.ParseRegister(inst.Args[0].UnprocessedValue)
-
-	if err != nil {
-		return model.MravInstruction{}, fmt.Errorf("cannot parse rs1 of %s instruction: %w", stringInstruction, err)
-	}
-
-	rs2, err := parsing.ParseRegister(inst.Args[1].UnprocessedValue)
-
-	if err != nil {
-		return model.MravInstruction{}, fmt.Errorf("cannot parse rs2 of %s instruction: %w", stringInstruction, err)
-	}
-
-	var mravInstruction model.MravInstruction
-
-	switch inst.CpuInstruction {
-	case isa.ADD:
-		mravInstruction = model.MravInstruction{
-			Add: &model.MravAdd{
-				Rd:  inst.Rd,
-				Rs1: rs1,
-				Rs2: rs2,
-			},
-		}
-	case isa.SUB:
-		mravInstruction = model.MravInstruction{
-			Sub: &model.MravSub{
-				Rd:  inst.Rd,
-				Rs1: rs1,
-				Rs2: rs2,
-			},
-		}
-	case isa.XOR:
-		mravInstruction = model.MravInstruction{
-			Xor: &model.MravXor{
-				Rd:  inst.Rd,
-				Rs1: rs1,
-				Rs2: rs2,
-			},
-		}
-	case isa.AND:
-		mravInstruction = model.MravInstruction{
-			And: &model.MravAnd{
-				Rd:  inst.Rd,
-				Rs1: rs1,
-				Rs2: rs2,
-			},
-		}
-	case isa.OR:
-		mravInstruction = model.MravInstruction{
-			Or: &model.MravOr{
-				Rd:  inst.Rd,
-				Rs1: rs1,
-				Rs2: rs2,
-			},
+		if err != nil {
+			return model.MravInstruction{}, err
 		}
-	default:
-		return mravInstruction, fmt.Errorf("cannot process a 'rd rs1 rs2' instruction, though this should never happen!")
-	}
-
-	return mravInstruction, nil
-}
 
-func processRdImm8(inst parsing.Instruction) (model.MravInstruction, error) {
-	instructions := []isa.InstructionCode{isa.ADDI, isa.LDHI, isa.BZ, isa.BNZ, isa.JAL}
-
-	stringInstruction, err := isa.InstructionToString(inst.CpuInstruction)
-
-	if err != nil {
-		return model.MravInstruction{}, err
-	}
-
-	if !slices.Contains(instructions, inst.CpuInstruction) {
-		return model.MravInstruction{}, fmt.Errorf("%s is not a 'rd imm8' instruction", stringInstruction)
-	}
-
-	if len(inst.Args) != 1 {
-		return model.MravInstruction{}, fmt.Errorf("%s instruction should have arguments rd, imm8", stringInstruction)
-	}
-
-	var immOrSymb model.ImmOrSymb
-
-	if inst.Args[0].ArgType == parsing.INSTRUCTION_ARG_TYPE_IDENTIFIER {
-		if _, err := parsing.ParseRegister(inst.Args[0].UnprocessedValue); err == nil {
-			// Weird condition, but this is what we need: if this actually parses as a register reference, we want to raise an error.
-			return model.MravInstruction{}, fmt.Errorf("%s instruction cannot use a reigster as its second argument", stringInstruction)
+		ops.Imm8 = immOrSymb
+	case isa.FORMAT_RD_IMM4:
+		if len(inst.Args) != 1 {
+			return model.MravInstruction{}, fmt.Errorf("%s instruction should have arguments rd, imm4", stringInstruction)
 		}
 
-		immOrSymb = model.ImmOrSymbFromSymb(model.MravSymbol(inst.Args[0].UnprocessedValue))
-	} else {
-		imm8, err := parsing.NumberValue(inst.Args[0].UnprocessedValue)
+		imm4, err := parsing.NumberValue(inst.Args[0].UnprocessedValue)
 
 		if err != nil {
-			return model.MravInstruction{}, fmt.Errorf("cannot parse imm8 of %s instruction: %w", stringInstruction, err)
+			return model.MravInstruction{}, fmt.Errorf("cannot parse imm4 of %s instruction: %w", stringInstruction, err)
 		}
 
-		if imm8 > 0xFF {
-			return model.MravInstruction{}, fmt.Errorf("cannot parse imm8 of %s instruction, value too large: %w", stringInstruction, err)
+		if imm4 > 0xF {
+			return model.MravInstruction{}, fmt.Errorf("cannot parse imm4 of %s instruction, value too large: %w", stringInstruction, err)
 		}
 
-		immOrSymb = model.ImmOrSymbFromImm(uint8(imm8))
-	}
-
-	var mravInstruction model.MravInstruction
-
-	switch inst.CpuInstruction {
-	case isa.ADDI:
-		mravInstruction = model.MravInstruction{
-			Addi: &model.MravAddi{
-				Rd:    inst.Rd,
-				Value: immOrSymb,
-			},
-		}
-	case isa.LDHI:
-		mravInstruction = model.MravInstruction{
-			Ldhi: &model.MravLdhi{
-				Rd:    inst.Rd,
-				Value: immOrSymb,
-			},
-		}
-	case isa.BZ:
-		mravInstruction = model.MravInstruction{
-			Bz: &model.MravBz{
-				Rd:   inst.Rd,
-				Addr: immOrSymb,
-			},
-		}
-	case isa.BNZ:
-		mravInstruction = model.MravInstruction{
-			Bnz: &model.MravBnz{
-				Rd:   inst.Rd,
-				Addr: immOrSymb,
-			},
-		}
-	case isa.JAL:
-		mravInstruction = model.MravInstruction{
-			Jal: &model.MravJal{
-				Rd:   inst.Rd,
-				Addr: immOrSymb,
-			},
+		ops.Imm4 = uint8(imm4)
+	case isa.FORMAT_NO_OPERANDS:
+		if len(inst.Args) != 0 {
+			return model.MravInstruction{}, fmt.Errorf("%s instruction takes no arguments", stringInstruction)
 		}
 	default:
-		return mravInstruction, fmt.Errorf("cannot process a 'rd imm8' instruction, though this should never happen!")
+		return model.MravInstruction{}, fmt.Errorf("unknown operand format (this should absolutely never happen!)")
 	}
 
-	return mravInstruction, nil
+	return model.NewInstruction(spec, ops)
 }
 
-func processRdImm4(inst parsing.Instruction) (model.MravInstruction, error) {
-	instructions := []isa.InstructionCode{isa.SHL, isa.SHR, isa.SHRA}
-
-	stringInstruction, err := isa.InstructionToString(inst.CpuInstruction)
-
-	if err != nil {
-		return model.MravInstruction{}, err
+func processImm8(stringInstruction string, args []parsing.InstructionArg) (model.ImmOrSymb, error) {
+	if len(args) != 1 {
+		return model.ImmOrSymb{}, fmt.Errorf("%s instruction should have arguments rd, imm8", stringInstruction)
 	}
 
-	if !slices.Contains(instructions, inst.CpuInstruction) {
-		return model.MravInstruction{}, fmt.Errorf("%s is not a 'rd imm4' instruction", stringInstruction)
-	}
+	if args[0].ArgType == parsing.INSTRUCTION_ARG_TYPE_IDENTIFIER {
+		if _, err := parsing.ParseRegister(args[0].UnprocessedValue); err == nil {
+			// Weird condition, but this is what we need: if this actually parses as a register reference, we want to raise an error.
+			return model.ImmOrSymb{}, fmt.Errorf("%s instruction cannot use a reigster as its second argument", stringInstruction)
+		}
 
-	if len(inst.Args) != 1 {
-		return model.MravInstruction{}, fmt.Errorf("%s instruction should have arguments rd, imm4", stringInstruction)
+		return model.ImmOrSymbFromSymb(model.MravSymbol(args[0].UnprocessedValue)), nil
 	}
 
-	imm4, err := parsing.NumberValue(inst.Args[0].UnprocessedValue)
+	imm8, err := parsing.NumberValue(args[0].UnprocessedValue)
 
 	if err != nil {
-		return model.MravInstruction{}, fmt.Errorf("cannot parse imm4 of %s instruction: %w", stringInstruction, err)
-	}
-
-	if imm4 > 0xF {
-		return model.MravInstruction{}, fmt.Errorf("cannot parse imm4 of %s instruction, value too large: %w", stringInstruction, err)
+		return model.ImmOrSymb{}, fmt.Errorf("cannot parse imm8 of %s instruction: %w", stringInstruction, err)
 	}
 
-	var mravInstruction model.MravInstruction
-
-	switch inst.CpuInstruction {
-	case isa.SHL:
-		mravInstruction = model.MravInstruction{
-			Shl: &model.MravShl{
-				Rd:   inst.Rd,
-				Imm4: uint8(imm4),
-			},
-		}
-	case isa.SHR:
-		mravInstruction = model.MravInstruction{
-			Shr: &model.MravShr{
-				Rd:   inst.Rd,
-				Imm4: uint8(imm4),
-			},
-		}
-	case isa.SHRA:
-		mravInstruction = model.MravInstruction{
-			Shra: &model.MravShra{
-				Rd:   inst.Rd,
-				Imm4: uint8(imm4),
-			},
-		}
-	default:
-		return mravInstruction, fmt.Errorf("cannot process a 'rd imm4' instruction, though this should never happen!")
+	if imm8 > 0xFF {
+		return model.ImmOrSymb{}, fmt.Errorf("cannot parse imm8 of %s instruction, value too large: %w", stringInstruction, err)
 	}
 
-	return mravInstruction, nil
+	return model.ImmOrSymbFromImm(uint8(imm8)), nil
 }
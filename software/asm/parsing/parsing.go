@@ -71,9 +71,9 @@ type LabeledInstructionLine struct {
 }
 
 type Instruction struct {
-	CpuInstruction isa.InstructionCode
-	Rd             isa.RegisterId   // First arg is always rd, a register
-	Args           []InstructionArg // These are yet unprocessed in this first phase of parsing
+	Spec *isa.InstructionSpec
+	Rd   isa.RegisterId   // First arg is always rd, a register (if the instruction has any arguments)
+	Args []InstructionArg // These are yet unprocessed in this first phase of parsing
 }
 
 type Symbol string
@@ -187,7 +187,14 @@ func parseAsmLine(lineNum int, line string) (Line, error) {
 	}
 
 	if len(tokens) == 1 {
-		return Line{}, fmt.Errorf("incomplete and possibly malformed line %d", lineNum)
+		// Only the instructions without arguments can take up a single token.
+		instr, err := parseInstructionTokens(tokens)
+
+		if err != nil {
+			return Line{}, fmt.Errorf("incomplete and possibly malformed line %d: %w", lineNum, err)
+		}
+
+		return lineMaker(AssemblyInstructionLine(instr)), nil
 	}
 
 	if tokens[0].tokenType != scanner.Ident {
@@ -234,13 +241,37 @@ func parseAsmLine(lineNum int, line string) (Line, error) {
 	return lineMaker(AssemblyInstructionLine(instr)), nil
 }
 
+// Maps the operand formats to argument token types (excluding first argument which is always rd, a register; it has
+// already been checked). It's a list of lists: each element of this list is one of the options that the parser can
+// accept.
+var formatToArgTokens = map[isa.OperandFormat][][]rune{
+	isa.FORMAT_RD_RS1_RS2: {{scanner.Ident, scanner.Ident}},
+	isa.FORMAT_RD_RS1:     {{scanner.Ident}},
+	isa.FORMAT_RD_IMM8:    {{scanner.Ident}, {scanner.Int}},
+	isa.FORMAT_RD_IMM4:    {{scanner.Int}},
+}
+
 func parseInstructionTokens(tokens []lineToken) (Instruction, error) {
-	instr, err := isa.StringToInstruction(tokens[0].text)
+	spec, err := isa.SpecByMnemonic(tokens[0].text)
 
 	if err != nil {
 		return Instruction{}, fmt.Errorf("column %d, instruction parsing error: %w", tokens[0].position.Column, err)
 	}
 
+	if spec.Format == isa.FORMAT_NO_OPERANDS {
+		if len(tokens) != 1 {
+			return Instruction{}, fmt.Errorf("column %d, %s takes no arguments", tokens[1].position.Column, tokens[0].text)
+		}
+
+		return Instruction{
+			Spec: spec,
+		}, nil
+	}
+
+	if len(tokens) < 2 {
+		return Instruction{}, fmt.Errorf("column %d, expected a destination register", tokens[0].position.Column)
+	}
+
 	rdToken := tokens[1]
 
 	if rdToken.tokenType != scanner.Ident {
@@ -253,29 +284,8 @@ func parseInstructionTokens(tokens []lineToken) (Instruction, error) {
 		return Instruction{}, fmt.Errorf("column %d, cannot parse destination register: %w", rdToken.position.Column, err)
 	}
 
-	// Maps instructions to argument token types (excluding first argument which is always rd, a register; it has already been checked).
-	// It's a list of lists: each element of this list is one of the options that the parser can accept.
-	instrToArgTokens := map[isa.InstructionCode][][]rune{
-		isa.ADD:  {{scanner.Ident, scanner.Ident}},
-		isa.SUB:  {{scanner.Ident, scanner.Ident}},
-		isa.LW:   {{scanner.Ident}},
-		isa.SW:   {{scanner.Ident}},
-		isa.XOR:  {{scanner.Ident, scanner.Ident}},
-		isa.AND:  {{scanner.Ident, scanner.Ident}},
-		isa.OR:   {{scanner.Ident, scanner.Ident}},
-		isa.ADDI: {{scanner.Ident}, {scanner.Int}},
-		isa.LDHI: {{scanner.Ident}, {scanner.Int}},
-		isa.BZ:   {{scanner.Ident}, {scanner.Int}},
-		isa.BNZ:  {{scanner.Ident}, {scanner.Int}},
-		isa.JAL:  {{scanner.Ident}, {scanner.Int}},
-		isa.JALR: {{scanner.Ident}},
-		isa.SHL:  {{scanner.Int}},
-		isa.SHR:  {{scanner.Int}},
-		isa.SHRA: {{scanner.Int}},
-	}
-
 	remainingTokens := tokens[2:]
-	remainingTokenOptions, ok := instrToArgTokens[instr]
+	remainingTokenOptions, ok := formatToArgTokens[spec.Format]
 
 	if !ok {
 		// This should really never happen.
@@ -333,9 +343,9 @@ func parseInstructionTokens(tokens []lineToken) (Instruction, error) {
 	}
 
 	return Instruction{
-		CpuInstruction: instr,
-		Rd:             rd,
-		Args:           args,
+		Spec: spec,
+		Rd:   rd,
+		Args: args,
 	}, nil
 }
 
@@ -2,6 +2,7 @@ package secondpass
 
 import (
 	"fmt"
+	"mrav/isa"
 	"mrav/software/model"
 )
 
@@ -32,29 +33,15 @@ func BuildObject(m *model.MravModule) (MravObject, error) {
 	referencedSymbols := make([]model.MravSymbol, 0)
 
 	for _, instr := range m.Instructions {
-		if (instr.Addi != nil) && (instr.Addi.Value.IsRight()) {
-			referencedSymbols = append(referencedSymbols, instr.Addi.Value.MustRight())
-			continue
-		}
-
-		if (instr.Ldhi != nil) && (instr.Ldhi.Value.IsRight()) {
-			referencedSymbols = append(referencedSymbols, instr.Ldhi.Value.MustRight())
-			continue
-		}
-
-		if (instr.Bz != nil) && (instr.Bz.Addr.IsRight()) {
-			referencedSymbols = append(referencedSymbols, instr.Bz.Addr.MustRight())
-			continue
-		}
+		spec, ops, err := instr.Spec()
 
-		if (instr.Bnz != nil) && (instr.Bnz.Addr.IsRight()) {
-			referencedSymbols = append(referencedSymbols, instr.Bnz.Addr.MustRight())
-			continue
+		if err != nil {
+			return MravObject{}, err
 		}
 
-		if (instr.Jal != nil) && (instr.Jal.Addr.IsRight()) {
-			referencedSymbols = append(referencedSymbols, instr.Jal.Addr.MustRight())
-			continue
+		// Only the imm8 operands can refer to symbols.
+		if (spec.Format == isa.FORMAT_RD_IMM8) && ops.Imm8.IsRight() {
+			referencedSymbols = append(referencedSymbols, ops.Imm8.MustRight())
 		}
 	}
 
@@ -55,16 +55,23 @@ def _mrav_binary_impl(ctx):
                     all_srcs.append(module)
                     seen_files.add(module.path)
 
+    outputs = [output_image]
+    arguments = ["--output", output_image.path, "--format", format]
+
+    if ctx.outputs.symbols:
+        outputs.append(ctx.outputs.symbols)
+        arguments += ["--symbols_output", ctx.outputs.symbols.path]
+
     ctx.actions.run(
         inputs = all_srcs,
-        outputs = [output_image],
-        arguments = ["--output", output_image.path, "--format", format] + [m.path for m in all_srcs],
+        outputs = outputs,
+        arguments = arguments + [m.path for m in all_srcs],
         executable = assembler,
         progress_message = "Running Mrav assembler",
     )
 
     return [
-        DefaultInfo(files = depset([output_image])),
+        DefaultInfo(files = depset(outputs)),
     ]
 
 mrav_binary = rule(
@@ -86,6 +93,9 @@ mrav_binary = rule(
             doc = "Output label for the Mrav image",
             mandatory = True,
         ),
+        "symbols": attr.output(
+            doc = "Optional output label for the symbol map, used by the debugging tools",
+        ),
         "format": attr.string(
             default = "binary",
             values = ["human", "binary"],
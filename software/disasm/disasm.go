@@ -0,0 +1,88 @@
+package disasm
+
+import (
+	"fmt"
+
+	"mrav/isa"
+	"mrav/software/model"
+	"mrav/software/symbols"
+)
+
+// Decode turns the instruction word back into the assembler model. Immediate values are always decoded as numbers.
+func Decode(word isa.Register) (model.MravInstruction, error) {
+	spec, err := isa.DecodeSpec(word)
+
+	if err != nil {
+		return model.MravInstruction{}, fmt.Errorf("cannot decode instruction %04X: %w", word, err)
+	}
+
+	ops := spec.DecodeOperands(word)
+
+	return model.NewInstruction(spec, model.Operands{
+		Rd:   ops.Rd,
+		Rs1:  ops.Rs1,
+		Rs2:  ops.Rs2,
+		Imm8: model.ImmOrSymbFromImm(ops.Imm),
+		Imm4: ops.Imm,
+	})
+}
+
+// Disassemble decodes the instruction word into the assembly text. If the symbol map is given, the branch and jump
+// targets that have a label are shown with it.
+func Disassemble(word isa.Register, syms *symbols.SymbolMap) (string, error) {
+	instr, err := Decode(word)
+
+	if err != nil {
+		return "", err
+	}
+
+	if syms != nil {
+		// Decoding has already checked the instruction.
+		spec, _ := isa.DecodeSpec(word)
+		isTarget := (spec.Semantics == isa.SEMANTICS_BRANCH) || (spec.Semantics == isa.SEMANTICS_JUMP)
+
+		if isTarget && (spec.Format == isa.FORMAT_RD_IMM8) {
+			if label, found := syms.LabelAt(isa.Register(isa.Imm8(word))); found {
+				instr, err = instr.WithImm8(model.ImmOrSymbFromSymb(model.MravSymbol(label)))
+
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+
+	return Format(instr)
+}
+
+func formatImmOrSymb(value model.ImmOrSymb) string {
+	if imm, isImm := value.Left(); isImm {
+		return fmt.Sprintf("0x%02X", imm)
+	}
+
+	return string(value.MustRight())
+}
+
+// Format prints the instruction the way the assembler accepts it.
+func Format(instr model.MravInstruction) (string, error) {
+	spec, ops, err := instr.Spec()
+
+	if err != nil {
+		return "", err
+	}
+
+	switch spec.Format {
+	case isa.FORMAT_RD_RS1_RS2:
+		return fmt.Sprintf("%s r%d r%d r%d", spec.Mnemonic, ops.Rd, ops.Rs1, ops.Rs2), nil
+	case isa.FORMAT_RD_RS1:
+		return fmt.Sprintf("%s r%d r%d", spec.Mnemonic, ops.Rd, ops.Rs1), nil
+	case isa.FORMAT_RD_IMM8:
+		return fmt.Sprintf("%s r%d %s", spec.Mnemonic, ops.Rd, formatImmOrSymb(ops.Imm8)), nil
+	case isa.FORMAT_RD_IMM4:
+		return fmt.Sprintf("%s r%d %d", spec.Mnemonic, ops.Rd, ops.Imm4), nil
+	case isa.FORMAT_NO_OPERANDS:
+		return spec.Mnemonic, nil
+	}
+
+	return "", fmt.Errorf("unexpected instruction: %v", instr)
+}
@@ -0,0 +1,175 @@
+package disasm
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"mrav/isa"
+	"mrav/software/asm"
+	"mrav/software/machinecode"
+	"mrav/software/model"
+	"mrav/software/symbols"
+)
+
+// Every instruction, written the way the disassembler prints it.
+const cAllInstructions = `add r1 r2 r3
+sub r4 r5 r6
+lw r7 r8
+sw r9 r10
+xor r11 r12 r13
+and r14 r15 r0
+or r1 r1 r1
+addi r2 0x7F
+ldhi r3 0xFF
+bz r4 0x10
+bnz r5 0x00
+jal r6 0x20
+jalr r7 r8
+shl r9 1
+shr r10 15
+shra r11 0
+reti
+ei
+di
+`
+
+// The operands of the format, the other fields are not encoded.
+func formatOperands(format isa.OperandFormat, ops isa.Operands) isa.Operands {
+	switch format {
+	case isa.FORMAT_RD_RS1_RS2:
+		return isa.Operands{Rd: ops.Rd, Rs1: ops.Rs1, Rs2: ops.Rs2}
+	case isa.FORMAT_RD_RS1:
+		return isa.Operands{Rd: ops.Rd, Rs1: ops.Rs1}
+	case isa.FORMAT_RD_IMM8:
+		return isa.Operands{Rd: ops.Rd, Imm: ops.Imm}
+	case isa.FORMAT_RD_IMM4:
+		return isa.Operands{Rd: ops.Rd, Imm: ops.Imm & 0xF}
+	}
+
+	return isa.Operands{}
+}
+
+func assemble(t *testing.T, source string) (*model.MravModule, []byte) {
+	t.Helper()
+
+	program, err := asm.AssembleModules([]string{source})
+
+	if err != nil {
+		t.Fatalf("cannot assemble: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := machinecode.GenerateMachineCode(*program, &buf); err != nil {
+		t.Fatalf("cannot generate the machine code: %v", err)
+	}
+
+	return program, buf.Bytes()
+}
+
+func disassembleAll(t *testing.T, code []byte, syms *symbols.SymbolMap) []string {
+	t.Helper()
+
+	lines := make([]string, 0, len(code)/isa.INSTRUCTION_SIZE)
+
+	for offset := 0; offset < len(code); offset += isa.INSTRUCTION_SIZE {
+		word := isa.Register(code[offset])<<8 | isa.Register(code[offset+1])
+		text, err := Disassemble(word, syms)
+
+		if err != nil {
+			t.Fatalf("cannot disassemble %04X at %04X: %v", word, offset, err)
+		}
+
+		lines = append(lines, text)
+	}
+
+	return lines
+}
+
+// The disassembly of every instruction is the source it was assembled from, and assembles to the same code.
+func TestAssemblerRoundTrip(t *testing.T) {
+	_, code := assemble(t, cAllInstructions)
+	source := strings.Join(disassembleAll(t, code, nil), "\n") + "\n"
+
+	if source != cAllInstructions {
+		t.Fatalf("unexpected disassembly\nexpected:\n%s\ngot:\n%s", cAllInstructions, source)
+	}
+
+	if _, reassembled := assemble(t, source); !bytes.Equal(reassembled, code) {
+		t.Fatalf("the disassembly assembled to %X, expected %X", reassembled, code)
+	}
+}
+
+// The branch and jump targets with a label are shown with it, the other immediates stay numbers.
+func TestDisassembleWithLabels(t *testing.T) {
+	program, code := assemble(t, `
+start: addi r1 4
+loop: bnz r1 done
+addi r1 0xFF
+jal r0 loop
+done: bz r0 0x40
+jal r2 start
+`)
+	expected := []string{
+		"addi r1 0x04",
+		"bnz r1 done",
+		"addi r1 0xFF",
+		"jal r0 loop",
+		"bz r0 0x40",
+		"jal r2 start",
+	}
+
+	if lines := disassembleAll(t, code, symbols.FromModule(program, nil)); !slices.Equal(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
+
+// The reserved JALR functions run as the plain jump, so they are shown as one.
+func TestDisassembleReservedJalrFunction(t *testing.T) {
+	if text, err := Disassemble(0xC124, nil); (err != nil) || (text != "jalr r1 r2") {
+		t.Fatalf("expected 'jalr r1 r2' for the reserved JALR function, got '%s' (%v)", text, err)
+	}
+}
+
+// Every instruction of the ISA table goes through the encoding, the decoding, the disassembly and the assembler back to
+// the same word.
+func TestInstructionSetRoundTrip(t *testing.T) {
+	operands := []isa.Operands{
+		{},
+		{Rd: 1, Rs1: 2, Rs2: 3, Imm: 0x5A},
+		{Rd: 15, Rs1: 14, Rs2: 13, Imm: 0xFF},
+	}
+
+	for i := range isa.InstructionSet {
+		spec := &isa.InstructionSet[i]
+
+		for _, ops := range operands {
+			word := spec.Encode(ops)
+			decoded, err := isa.DecodeSpec(word)
+
+			if err != nil {
+				t.Fatalf("cannot decode %s (%04X): %v", spec.Mnemonic, word, err)
+			}
+
+			if decoded != spec {
+				t.Fatalf("%s (%04X) decoded as %s", spec.Mnemonic, word, decoded.Mnemonic)
+			}
+
+			if got, want := decoded.DecodeOperands(word), formatOperands(spec.Format, ops); got != want {
+				t.Fatalf("%s (%04X) decoded with the operands %+v, expected %+v", spec.Mnemonic, word, got, want)
+			}
+
+			text, err := Disassemble(word, nil)
+
+			if err != nil {
+				t.Fatalf("cannot disassemble %s (%04X): %v", spec.Mnemonic, word, err)
+			}
+
+			if _, code := assemble(t, text); !bytes.Equal(code, []byte{byte(word >> 8), byte(word)}) {
+				t.Fatalf("'%s' assembled to %X, expected %04X", text, code, word)
+			}
+		}
+	}
+}
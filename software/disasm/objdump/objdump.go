@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"mrav/isa"
+	"mrav/software/disasm"
+	"mrav/software/symbols"
+)
+
+// dump writes the listing of the program, an instruction per line with its address and word, and the labels from the
+// symbol map if it's given.
+func dump(program []byte, syms *symbols.SymbolMap, out io.Writer) {
+	for offset := 0; offset < len(program); offset += isa.INSTRUCTION_SIZE {
+		addr := isa.Register(offset)
+
+		if syms != nil {
+			if label, found := syms.LabelAt(addr); found {
+				fmt.Fprintf(out, "%s:\n", label)
+			}
+		}
+
+		if offset+1 >= len(program) {
+			fmt.Fprintf(out, "%04X:  %02X    <incomplete instruction>\n", addr, program[offset])
+			break
+		}
+
+		word := isa.Register(program[offset])<<8 | isa.Register(program[offset+1])
+		text, err := disasm.Disassemble(word, syms)
+
+		if err != nil {
+			text = fmt.Sprintf("<%v>", err)
+		}
+
+		fmt.Fprintf(out, "%04X:  %04X  %s\n", addr, word, text)
+	}
+}
+
+func main() {
+	symbolsFile := flag.String("symbols", "", "(optional) path to the symbol map from the assembler, for showing the labels")
+
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatalf("expected exactly one binary to disassemble (produced with 'as --format binary'), got %d", flag.NArg())
+	}
+
+	binaryPath := flag.Arg(0)
+	program, err := os.ReadFile(binaryPath)
+
+	if err != nil {
+		log.Fatalf("cannot read the binary: %v", err)
+	}
+
+	var syms *symbols.SymbolMap
+
+	if *symbolsFile != "" {
+		syms, err = symbols.ReadFromFile(*symbolsFile)
+
+		if err != nil {
+			log.Fatalf("cannot load the symbol map: %v", err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	dump(program, syms, out)
+}
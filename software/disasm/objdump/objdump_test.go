@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mrav/software/asm"
+	"mrav/software/machinecode"
+	"mrav/software/symbols"
+)
+
+func TestDump(t *testing.T) {
+	program, err := asm.AssembleModules([]string{`
+start: addi r1 4
+loop: bnz r1 start
+jal r0 loop
+`})
+
+	if err != nil {
+		t.Fatalf("cannot assemble: %v", err)
+	}
+
+	var code bytes.Buffer
+
+	if err := machinecode.GenerateMachineCode(*program, &code); err != nil {
+		t.Fatalf("cannot generate the machine code: %v", err)
+	}
+
+	// A reserved JALR function, shown as the jump it runs as, and a trailing odd byte.
+	binary := append(code.Bytes(), 0xC1, 0x24, 0x7F)
+
+	tests := []struct {
+		name     string
+		syms     *symbols.SymbolMap
+		expected []string
+	}{
+		{
+			name: "plain",
+			expected: []string{
+				"0000:  7104  addi r1 0x04",
+				"0002:  A100  bnz r1 0x00",
+				"0004:  B002  jal r0 0x02",
+				"0006:  C124  jalr r1 r2",
+				"0008:  7F    <incomplete instruction>",
+			},
+		},
+		{
+			name: "symbols",
+			syms: symbols.FromModule(program, nil),
+			expected: []string{
+				"start:",
+				"0000:  7104  addi r1 0x04",
+				"loop:",
+				"0002:  A100  bnz r1 start",
+				"0004:  B002  jal r0 loop",
+				"0006:  C124  jalr r1 r2",
+				"0008:  7F    <incomplete instruction>",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		var out bytes.Buffer
+		dump(binary, tc.syms, &out)
+
+		if want := strings.Join(tc.expected, "\n") + "\n"; out.String() != want {
+			t.Fatalf("%s: unexpected listing\nexpected:\n%s\ngot:\n%s", tc.name, want, out.String())
+		}
+	}
+}
@@ -64,110 +64,68 @@ func Link(objects []*secondpass.MravObject) (*model.MravModule, error) {
 		totalInstructions += objectInstructions
 	}
 
+	// Labels and symbols are kept in the linked module with their final values, for the debugging tools.
+	linkedLabels := make([]model.MravLabel, 0)
+	linkedSymbols := make([]model.MravDefinition, 0)
+
+	for i, obj := range objects {
+		linkedSymbols = append(linkedSymbols, obj.Module.AssignedSymbols...)
+
+		for _, label := range obj.Module.Labels {
+			linkedLabels = append(linkedLabels, model.MravLabel{
+				Symbol:  label.Symbol,
+				Address: label.Address + model.MravValue(objectsToOffset[i]),
+			})
+		}
+	}
+
 	linkedInstructions := make([]model.MravInstruction, 0, totalInstructions)
+	linkedSourceLines := make([]model.MravSourceLine, 0, totalInstructions)
+
+	for i, obj := range objects {
+		for _, sourceLine := range obj.Module.SourceLines {
+			linkedSourceLines = append(linkedSourceLines, model.MravSourceLine{
+				Module: i,
+				Line:   sourceLine.Line,
+			})
+		}
 
-	for _, obj := range objects {
 		for _, instr := range obj.Module.Instructions {
-			if (instr.Addi != nil) && (instr.Addi.Value.IsRight()) {
-				symb := instr.Addi.Value.MustRight()
-				objMeta := symbolsToObjects[symb]
-				finalValue := objMeta.value
-
-				if objMeta.symbolType == 1 {
-					symbObjOffset := objectsToOffset[objMeta.module]
-					finalValue += uint8(symbObjOffset)
-				}
-
-				linkedInstructions = append(linkedInstructions, model.MravInstruction{
-					Addi: &model.MravAddi{
-						Rd:    instr.Addi.Rd,
-						Value: model.ImmOrSymbFromImm(uint8(finalValue)),
-					},
-				})
-				continue
-			}
+			spec, ops, err := instr.Spec()
 
-			if (instr.Ldhi != nil) && (instr.Ldhi.Value.IsRight()) {
-				symb := instr.Ldhi.Value.MustRight()
-				objMeta := symbolsToObjects[symb]
-				finalValue := objMeta.value
-
-				if objMeta.symbolType == 1 {
-					symbObjOffset := objectsToOffset[objMeta.module]
-					finalValue += uint8(symbObjOffset)
-				}
-
-				linkedInstructions = append(linkedInstructions, model.MravInstruction{
-					Ldhi: &model.MravLdhi{
-						Rd:    instr.Ldhi.Rd,
-						Value: model.ImmOrSymbFromImm(uint8(finalValue)),
-					},
-				})
-				continue
+			if err != nil {
+				return nil, err
 			}
 
-			if (instr.Bz != nil) && (instr.Bz.Addr.IsRight()) {
-				symb := instr.Bz.Addr.MustRight()
-				objMeta := symbolsToObjects[symb]
-				finalValue := objMeta.value
-
-				if objMeta.symbolType == 1 {
-					symbObjOffset := objectsToOffset[objMeta.module]
-					finalValue += uint8(symbObjOffset)
-				}
-
-				linkedInstructions = append(linkedInstructions, model.MravInstruction{
-					Bz: &model.MravBz{
-						Rd:   instr.Bz.Rd,
-						Addr: model.ImmOrSymbFromImm(uint8(finalValue)),
-					},
-				})
+			// Only the imm8 operands can refer to symbols.
+			if (spec.Format != isa.FORMAT_RD_IMM8) || ops.Imm8.IsLeft() {
+				linkedInstructions = append(linkedInstructions, instr)
 				continue
 			}
 
-			if (instr.Bnz != nil) && (instr.Bnz.Addr.IsRight()) {
-				symb := instr.Bnz.Addr.MustRight()
-				objMeta := symbolsToObjects[symb]
-				finalValue := objMeta.value
-
-				if objMeta.symbolType == 1 {
-					symbObjOffset := objectsToOffset[objMeta.module]
-					finalValue += uint8(symbObjOffset)
-				}
-
-				linkedInstructions = append(linkedInstructions, model.MravInstruction{
-					Bnz: &model.MravBnz{
-						Rd:   instr.Bnz.Rd,
-						Addr: model.ImmOrSymbFromImm(uint8(finalValue)),
-					},
-				})
-				continue
+			symb := ops.Imm8.MustRight()
+			objMeta := symbolsToObjects[symb]
+			finalValue := objMeta.value
+
+			if objMeta.symbolType == 1 {
+				symbObjOffset := objectsToOffset[objMeta.module]
+				finalValue += uint8(symbObjOffset)
 			}
 
-			if (instr.Jal != nil) && (instr.Jal.Addr.IsRight()) {
-				symb := instr.Jal.Addr.MustRight()
-				objMeta := symbolsToObjects[symb]
-				finalValue := objMeta.value
-
-				if objMeta.symbolType == 1 {
-					symbObjOffset := objectsToOffset[objMeta.module]
-					finalValue += uint8(symbObjOffset)
-				}
-
-				linkedInstructions = append(linkedInstructions, model.MravInstruction{
-					Jal: &model.MravJal{
-						Rd:   instr.Jal.Rd,
-						Addr: model.ImmOrSymbFromImm(uint8(finalValue)),
-					},
-				})
-				continue
+			linkedInstr, err := instr.WithImm8(model.ImmOrSymbFromImm(uint8(finalValue)))
+
+			if err != nil {
+				return nil, err
 			}
 
-			linkedInstructions = append(linkedInstructions, instr)
+			linkedInstructions = append(linkedInstructions, linkedInstr)
 		}
 	}
 
 	return &model.MravModule{
-		Instructions: linkedInstructions,
+		Labels:          linkedLabels,
+		AssignedSymbols: linkedSymbols,
+		Instructions:    linkedInstructions,
+		SourceLines:     linkedSourceLines,
 	}, nil
 }
@@ -100,3 +100,11 @@ type MravShra struct {
 	Rd   isa.RegisterId
 	Imm4 uint8
 }
+
+// Interrupt control instructions, encoded as JALR with a non-zero function.
+
+type MravReti struct{}
+
+type MravEi struct{}
+
+type MravDi struct{}
@@ -8,6 +8,13 @@ type MravModule struct {
 	Labels          []MravLabel
 	AssignedSymbols []MravDefinition
 	Instructions    []MravInstruction
+	SourceLines     []MravSourceLine // Where each of the instructions comes from, empty if not known
+}
+
+// MravSourceLine points to the line of the assembly source, the module is its index in the assembler input.
+type MravSourceLine struct {
+	Module int
+	Line   int
 }
 
 type MravLabel struct {
@@ -38,4 +45,7 @@ type MravInstruction struct {
 	Shl  *MravShl
 	Shr  *MravShr
 	Shra *MravShra
+	Reti *MravReti
+	Ei   *MravEi
+	Di   *MravDi
 }
@@ -0,0 +1,291 @@
+package model
+
+import (
+	"fmt"
+
+	"mrav/isa"
+)
+
+// Operands holds the instruction fields in a form common to all the instructions, the format of the instruction says
+// which of them are used.
+type Operands struct {
+	Rd   isa.RegisterId
+	Rs1  isa.RegisterId
+	Rs2  isa.RegisterId
+	Imm8 ImmOrSymb
+	Imm4 uint8
+}
+
+// Connects the instructions from the ISA definition to the model types, in both directions.
+type binding struct {
+	build  func(ops Operands) MravInstruction
+	unpack func(instr MravInstruction) (Operands, bool)
+}
+
+var bindings = map[string]binding{
+	"add": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Add: &MravAdd{Rd: ops.Rd, Rs1: ops.Rs1, Rs2: ops.Rs2}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Add == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Add.Rd, Rs1: instr.Add.Rs1, Rs2: instr.Add.Rs2}, true
+		},
+	},
+	"sub": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Sub: &MravSub{Rd: ops.Rd, Rs1: ops.Rs1, Rs2: ops.Rs2}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Sub == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Sub.Rd, Rs1: instr.Sub.Rs1, Rs2: instr.Sub.Rs2}, true
+		},
+	},
+	"lw": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Lw: &MravLw{Rd: ops.Rd, Rs1: ops.Rs1}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Lw == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Lw.Rd, Rs1: instr.Lw.Rs1}, true
+		},
+	},
+	"sw": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Sw: &MravSw{Rd: ops.Rd, Rs1: ops.Rs1}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Sw == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Sw.Rd, Rs1: instr.Sw.Rs1}, true
+		},
+	},
+	"xor": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Xor: &MravXor{Rd: ops.Rd, Rs1: ops.Rs1, Rs2: ops.Rs2}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Xor == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Xor.Rd, Rs1: instr.Xor.Rs1, Rs2: instr.Xor.Rs2}, true
+		},
+	},
+	"and": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{And: &MravAnd{Rd: ops.Rd, Rs1: ops.Rs1, Rs2: ops.Rs2}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.And == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.And.Rd, Rs1: instr.And.Rs1, Rs2: instr.And.Rs2}, true
+		},
+	},
+	"or": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Or: &MravOr{Rd: ops.Rd, Rs1: ops.Rs1, Rs2: ops.Rs2}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Or == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Or.Rd, Rs1: instr.Or.Rs1, Rs2: instr.Or.Rs2}, true
+		},
+	},
+	"addi": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Addi: &MravAddi{Rd: ops.Rd, Value: ops.Imm8}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Addi == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Addi.Rd, Imm8: instr.Addi.Value}, true
+		},
+	},
+	"ldhi": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Ldhi: &MravLdhi{Rd: ops.Rd, Value: ops.Imm8}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Ldhi == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Ldhi.Rd, Imm8: instr.Ldhi.Value}, true
+		},
+	},
+	"bz": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Bz: &MravBz{Rd: ops.Rd, Addr: ops.Imm8}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Bz == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Bz.Rd, Imm8: instr.Bz.Addr}, true
+		},
+	},
+	"bnz": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Bnz: &MravBnz{Rd: ops.Rd, Addr: ops.Imm8}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Bnz == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Bnz.Rd, Imm8: instr.Bnz.Addr}, true
+		},
+	},
+	"jal": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Jal: &MravJal{Rd: ops.Rd, Addr: ops.Imm8}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Jal == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Jal.Rd, Imm8: instr.Jal.Addr}, true
+		},
+	},
+	"jalr": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Jalr: &MravJalr{Rd: ops.Rd, Rs1: ops.Rs1}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Jalr == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Jalr.Rd, Rs1: instr.Jalr.Rs1}, true
+		},
+	},
+	"reti": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Reti: &MravReti{}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			return Operands{}, instr.Reti != nil
+		},
+	},
+	"ei": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Ei: &MravEi{}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			return Operands{}, instr.Ei != nil
+		},
+	},
+	"di": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Di: &MravDi{}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			return Operands{}, instr.Di != nil
+		},
+	},
+	"shl": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Shl: &MravShl{Rd: ops.Rd, Imm4: ops.Imm4}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Shl == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Shl.Rd, Imm4: instr.Shl.Imm4}, true
+		},
+	},
+	"shr": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Shr: &MravShr{Rd: ops.Rd, Imm4: ops.Imm4}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Shr == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Shr.Rd, Imm4: instr.Shr.Imm4}, true
+		},
+	},
+	"shra": {
+		build: func(ops Operands) MravInstruction {
+			return MravInstruction{Shra: &MravShra{Rd: ops.Rd, Imm4: ops.Imm4}}
+		},
+		unpack: func(instr MravInstruction) (Operands, bool) {
+			if instr.Shra == nil {
+				return Operands{}, false
+			}
+
+			return Operands{Rd: instr.Shra.Rd, Imm4: instr.Shra.Imm4}, true
+		},
+	},
+}
+
+// NewInstruction builds the model of the instruction from the ISA definition and its operands.
+func NewInstruction(spec *isa.InstructionSpec, ops Operands) (MravInstruction, error) {
+	b, found := bindings[spec.Mnemonic]
+
+	if !found {
+		return MravInstruction{}, fmt.Errorf("no model for instruction '%s'", spec.Mnemonic)
+	}
+
+	return b.build(ops), nil
+}
+
+// Spec finds the ISA definition of the instruction, and returns its operands.
+func (instr MravInstruction) Spec() (*isa.InstructionSpec, Operands, error) {
+	for mnemonic, b := range bindings {
+		ops, matches := b.unpack(instr)
+
+		if !matches {
+			continue
+		}
+
+		spec, err := isa.SpecByMnemonic(mnemonic)
+
+		if err != nil {
+			return nil, Operands{}, err
+		}
+
+		return spec, ops, nil
+	}
+
+	return nil, Operands{}, fmt.Errorf("unexpected instruction: %v", instr)
+}
+
+// WithImm8 returns the same instruction with the imm8 operand replaced, for resolving the symbols.
+func (instr MravInstruction) WithImm8(imm8 ImmOrSymb) (MravInstruction, error) {
+	spec, ops, err := instr.Spec()
+
+	if err != nil {
+		return MravInstruction{}, err
+	}
+
+	if spec.Format != isa.FORMAT_RD_IMM8 {
+		return MravInstruction{}, fmt.Errorf("%s has no imm8 operand", spec.Mnemonic)
+	}
+
+	ops.Imm8 = imm8
+
+	return NewInstruction(spec, ops)
+}
@@ -0,0 +1,199 @@
+package symbols
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"mrav/isa"
+	"mrav/software/model"
+)
+
+type Symbol struct {
+	Name    string `json:"name"`
+	Address uint16 `json:"address"`
+}
+
+// SymbolMap describes where the labels of the linked program ended up, it's produced by the assembler for the
+// debugging tools.
+type Constant struct {
+	Name  string `json:"name"`
+	Value uint16 `json:"value"`
+}
+
+// SourceLine is where the instruction at the address was assembled from.
+type SourceLine struct {
+	Address uint16 `json:"address"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+}
+
+type SymbolMap struct {
+	Symbols   []Symbol     `json:"symbols"`         // Labels, sorted by the address
+	Constants []Constant   `json:"constants"`       // Symbols assigned with '='
+	Lines     []SourceLine `json:"lines,omitempty"` // One for each instruction, sorted by the address
+}
+
+// FromModule builds the symbol map of the linked program. The source paths are the assembler inputs, in the order of
+// the modules, used for the source lines.
+func FromModule(m *model.MravModule, sourcePaths []string) *SymbolMap {
+	syms := make([]Symbol, 0, len(m.Labels))
+
+	for _, label := range m.Labels {
+		syms = append(syms, Symbol{
+			Name:    string(label.Symbol),
+			Address: uint16(label.Address),
+		})
+	}
+
+	slices.SortStableFunc(syms, func(a, b Symbol) int {
+		return int(a.Address) - int(b.Address)
+	})
+
+	consts := make([]Constant, 0, len(m.AssignedSymbols))
+
+	for _, def := range m.AssignedSymbols {
+		consts = append(consts, Constant{
+			Name:  string(def.Symbol),
+			Value: uint16(def.Value),
+		})
+	}
+
+	lines := make([]SourceLine, 0, len(m.SourceLines))
+
+	for i, sourceLine := range m.SourceLines {
+		file := fmt.Sprintf("module%d.mrav", sourceLine.Module)
+
+		if sourceLine.Module < len(sourcePaths) {
+			file = sourcePaths[sourceLine.Module]
+		}
+
+		lines = append(lines, SourceLine{
+			Address: uint16(i * int(isa.INSTRUCTION_SIZE)),
+			File:    file,
+			Line:    sourceLine.Line,
+		})
+	}
+
+	return &SymbolMap{
+		Symbols:   syms,
+		Constants: consts,
+		Lines:     lines,
+	}
+}
+
+func (sm *SymbolMap) WriteToFile(filePath string) error {
+	symsBytes, err := json.MarshalIndent(sm, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("cannot encode the symbol map: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, append(symsBytes, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write the symbol map: %w", err)
+	}
+
+	return nil
+}
+
+func ReadFromFile(filePath string) (*SymbolMap, error) {
+	symsBytes, err := os.ReadFile(filePath)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the symbol map: %w", err)
+	}
+
+	var sm SymbolMap
+
+	if err := json.Unmarshal(symsBytes, &sm); err != nil {
+		return nil, fmt.Errorf("cannot decode the symbol map: %w", err)
+	}
+
+	slices.SortStableFunc(sm.Symbols, func(a, b Symbol) int {
+		return int(a.Address) - int(b.Address)
+	})
+
+	slices.SortStableFunc(sm.Lines, func(a, b SourceLine) int {
+		return int(a.Address) - int(b.Address)
+	})
+
+	return &sm, nil
+}
+
+// Lookup returns the address of the label, or the value of the constant with the given name.
+func (sm *SymbolMap) Lookup(name string) (isa.Register, bool) {
+	for _, sym := range sm.Symbols {
+		if sym.Name == name {
+			return isa.Register(sym.Address), true
+		}
+	}
+
+	for _, constant := range sm.Constants {
+		if constant.Name == name {
+			return isa.Register(constant.Value), true
+		}
+	}
+
+	return 0, false
+}
+
+// SourceLineAt returns where the instruction at the address comes from.
+func (sm *SymbolMap) SourceLineAt(address isa.Register) (*SourceLine, bool) {
+	idx, found := slices.BinarySearchFunc(sm.Lines, address, func(line SourceLine, target isa.Register) int {
+		return int(line.Address) - int(target)
+	})
+
+	if !found {
+		return nil, false
+	}
+
+	return &sm.Lines[idx], true
+}
+
+// LabelAt returns the label placed exactly at the address.
+func (sm *SymbolMap) LabelAt(address isa.Register) (string, bool) {
+	for _, sym := range sm.Symbols {
+		if isa.Register(sym.Address) == address {
+			return sym.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// Enclosing returns the closest label at or before the address, the first one if there are several at the same
+// address.
+func (sm *SymbolMap) Enclosing(address isa.Register) (*Symbol, bool) {
+	var closest *Symbol
+
+	for i := range sm.Symbols {
+		if isa.Register(sm.Symbols[i].Address) > address {
+			break
+		}
+
+		if (closest == nil) || (closest.Address != sm.Symbols[i].Address) {
+			closest = &sm.Symbols[i]
+		}
+	}
+
+	return closest, closest != nil
+}
+
+// Describe returns the address relative to the closest label before it, like 'loop+4'. Empty if there is no label
+// before the address.
+func (sm *SymbolMap) Describe(address isa.Register) string {
+	closest, found := sm.Enclosing(address)
+
+	if !found {
+		return ""
+	}
+
+	offset := address - isa.Register(closest.Address)
+
+	if offset == 0 {
+		return closest.Name
+	}
+
+	return fmt.Sprintf("%s+%d", closest.Name, offset)
+}
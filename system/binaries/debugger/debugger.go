@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"mrav/core/proto"
+	"mrav/isa"
+	"mrav/software/asm/parsing"
+	"mrav/software/disasm"
+	"mrav/software/symbols"
+	"mrav/system"
+	"mrav/system/easybus"
+	"mrav/system/easybus/standard"
+)
+
+const helpText = `Commands:
+  step [N]                      run N instructions (1 by default), stopping early on breakpoints and watchpoints
+  continue                      run until a breakpoint or a watchpoint is hit, or the program halts
+  regs                          show the registers
+  mem ADDR LEN                  show LEN bytes of memory starting at ADDR
+  break LABEL|ADDR              stop when the PC reaches the address
+  watch rN                      stop when the register changes
+  watch rN OP VALUE             stop when the register condition holds, like 'watch r3 == 0x10'
+  watch ADDR[-HI] [read|write|access]
+                                stop after a data access to the address range (write by default)
+  delete ID                     remove a breakpoint or a watchpoint
+  info                          list the breakpoints and the watchpoints
+  set rN|pc VALUE               change a register
+  disasm [ADDR] [N]             disassemble N instructions (8 by default) starting at ADDR (PC by default)
+  reset                         restart the program, breakpoints and watchpoints are kept
+  help                          show this text
+  quit                          exit the debugger
+
+Addresses can be numbers in any format the assembler accepts, or labels from the symbol map like 'loop+4'.
+An empty line repeats the last command.`
+
+type debugger struct {
+	sys        *easybus.EasyBusSystem
+	syms       *symbols.SymbolMap
+	initial    *proto.SystemState
+	maxRun     int
+	out        io.Writer
+	instrsDone int
+}
+
+// newDebugger loads the software into the standard system and checkpoints its initial state for 'reset'.
+func newDebugger(opts *system.SystemOpts, software []byte, syms *symbols.SymbolMap, maxRun int, out io.Writer) (*debugger, error) {
+	regions, err := standard.Regions(standard.DefaultOpts(), software)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the devices: %w", err)
+	}
+
+	sys, err := easybus.NewEasyBusSystem(opts, regions)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a system: %w", err)
+	}
+
+	// Running on after the program halted doesn't change anything.
+	sys.AddStopCondition(&easybus.HaltCondition{})
+
+	initial, err := sys.Checkpoint()
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot checkpoint the initial state: %w", err)
+	}
+
+	return &debugger{
+		sys:     sys,
+		syms:    syms,
+		initial: initial,
+		maxRun:  maxRun,
+		out:     out,
+	}, nil
+}
+
+func (d *debugger) resolveAddress(spec string) (isa.Register, error) {
+	if spec == "" {
+		return 0, fmt.Errorf("missing address")
+	}
+
+	if val, err := parsing.NumberValue(spec); err == nil {
+		return isa.Register(val), nil
+	}
+
+	if d.syms == nil {
+		return 0, fmt.Errorf("cannot parse the address '%s' (labels need a symbol map)", spec)
+	}
+
+	name, offsetSpec, hasOffset := strings.Cut(spec, "+")
+	addr, found := d.syms.Lookup(name)
+
+	if !found {
+		return 0, fmt.Errorf("unknown label '%s'", name)
+	}
+
+	if hasOffset {
+		offset, err := parsing.NumberValue(offsetSpec)
+
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse the label offset: %w", err)
+		}
+
+		addr += isa.Register(offset)
+	}
+
+	return addr, nil
+}
+
+func (d *debugger) describeAddress(addr isa.Register) string {
+	if d.syms == nil {
+		return fmt.Sprintf("%04X", addr)
+	}
+
+	if desc := d.syms.Describe(addr); desc != "" {
+		return fmt.Sprintf("%04X <%s>", addr, desc)
+	}
+
+	return fmt.Sprintf("%04X", addr)
+}
+
+func (d *debugger) disassembleAt(addr isa.Register) string {
+	wordBytes, err := d.sys.ReadMemory(addr, isa.INSTRUCTION_SIZE)
+
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+
+	word := isa.Register(wordBytes[0])<<8 | isa.Register(wordBytes[1])
+	text, err := disasm.Disassemble(word, d.syms)
+
+	if err != nil {
+		return fmt.Sprintf("%04X  <%v>", word, err)
+	}
+
+	return fmt.Sprintf("%04X  %s", word, text)
+}
+
+func (d *debugger) showLocation() {
+	pc := d.sys.GetCore().Pc
+	fmt.Fprintf(d.out, "%s: %s\n", d.describeAddress(pc), d.disassembleAt(pc))
+}
+
+func (d *debugger) run(maxInstructions int) error {
+	events, done, err := d.sys.RunUntilStop(maxInstructions)
+	d.instrsDone += done
+
+	if err != nil {
+		return fmt.Errorf("simulation failed after %d instructions: %w", done, err)
+	}
+
+	for _, event := range events {
+		fmt.Fprintf(d.out, "Stopped at %s\n", event)
+	}
+
+	if (len(events) == 0) && (maxInstructions == d.maxRun) {
+		fmt.Fprintf(d.out, "Limit of %d instructions reached\n", d.maxRun)
+	}
+
+	d.showLocation()
+
+	return nil
+}
+
+func (d *debugger) cmdStep(args []string) error {
+	count := 1
+
+	if len(args) > 0 {
+		var err error
+		count, err = strconv.Atoi(args[0])
+
+		if (err != nil) || (count < 1) {
+			return fmt.Errorf("the instruction count should be a positive number, got '%s'", args[0])
+		}
+	}
+
+	return d.run(count)
+}
+
+func (d *debugger) cmdContinue(args []string) error {
+	return d.run(d.maxRun)
+}
+
+func (d *debugger) cmdRegs(args []string) error {
+	regs, err := d.sys.CoreDebug([]isa.RegisterId{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+
+	if err != nil {
+		return err
+	}
+
+	c := d.sys.GetCore()
+	fmt.Fprintln(d.out, regs)
+	fmt.Fprintf(d.out, "EPC = %04X, trap EPC = %04X, interrupts enabled = %t, instructions = %d, cycles = %d\n", c.Epc, c.TrapEpc, c.InterruptsEnabled(), d.instrsDone, d.sys.Cycles())
+
+	return nil
+}
+
+func (d *debugger) cmdMem(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: mem ADDR LEN")
+	}
+
+	addr, err := d.resolveAddress(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	length, err := parsing.NumberValue(args[1])
+
+	if err != nil {
+		return fmt.Errorf("cannot parse the length: %w", err)
+	}
+
+	data, err := d.sys.ReadMemory(addr, int(length))
+
+	if err != nil {
+		return err
+	}
+
+	for lineStart := 0; lineStart < len(data); lineStart += 16 {
+		line := data[lineStart:min(lineStart+16, len(data))]
+		hexBytes := make([]string, 0, len(line))
+
+		for _, b := range line {
+			hexBytes = append(hexBytes, fmt.Sprintf("%02X", b))
+		}
+
+		fmt.Fprintf(d.out, "%04X: %s\n", addr+isa.Register(lineStart), strings.Join(hexBytes, " "))
+	}
+
+	return nil
+}
+
+func (d *debugger) addCondition(cond easybus.StopCondition) {
+	id := d.sys.AddStopCondition(cond)
+	fmt.Fprintf(d.out, "#%d: %s\n", id, cond.Describe())
+}
+
+func (d *debugger) cmdBreak(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: break LABEL|ADDR")
+	}
+
+	pc, err := d.resolveAddress(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	d.addCondition(&easybus.PcBreakpoint{Pc: pc})
+
+	return nil
+}
+
+func (d *debugger) cmdWatch(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: watch rN | watch rN OP VALUE | watch ADDR[-HI] [read|write|access]")
+	}
+
+	if reg, err := parsing.ParseRegister(args[0]); err == nil {
+		if len(args) == 1 {
+			d.addCondition(&easybus.RegisterWatchpoint{Register: reg})
+			return nil
+		}
+
+		cond, err := easybus.ParseRegisterCondition(strings.Join(args, " "))
+
+		if err != nil {
+			return err
+		}
+
+		d.addCondition(cond)
+
+		return nil
+	}
+
+	loSpec, hiSpec, isRange := strings.Cut(args[0], "-")
+	lo, err := d.resolveAddress(loSpec)
+
+	if err != nil {
+		return err
+	}
+
+	hi := lo
+
+	if isRange {
+		hi, err = d.resolveAddress(hiSpec)
+
+		if err != nil {
+			return err
+		}
+
+		if hi < lo {
+			return fmt.Errorf("low address %04X is above the high address %04X", lo, hi)
+		}
+	}
+
+	kind := "write"
+
+	if len(args) > 1 {
+		kind = args[1]
+	}
+
+	watch := &easybus.AddressWatchpoint{Lo: lo, Hi: hi}
+
+	switch kind {
+	case "read":
+		watch.OnRead = true
+	case "write":
+		watch.OnWrite = true
+	case "access":
+		watch.OnRead = true
+		watch.OnWrite = true
+	default:
+		return fmt.Errorf("unknown watch kind '%s', should be read, write or access", kind)
+	}
+
+	d.addCondition(watch)
+
+	return nil
+}
+
+func (d *debugger) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: delete ID")
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+
+	if err != nil {
+		return fmt.Errorf("cannot parse the ID: %w", err)
+	}
+
+	return d.sys.RemoveStopCondition(id)
+}
+
+func (d *debugger) cmdInfo(args []string) error {
+	conditions := d.sys.StopConditions()
+
+	if len(conditions) == 0 {
+		fmt.Fprintln(d.out, "No breakpoints or watchpoints")
+		return nil
+	}
+
+	ids := make([]int, 0, len(conditions))
+
+	for id := range conditions {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		fmt.Fprintf(d.out, "#%d: %s\n", id, conditions[id].Describe())
+	}
+
+	return nil
+}
+
+func (d *debugger) cmdSet(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: set rN|pc VALUE")
+	}
+
+	value, err := parsing.NumberValue(args[1])
+
+	if err != nil {
+		// Labels are handy for setting the PC.
+		addr, labelErr := d.resolveAddress(args[1])
+
+		if labelErr != nil {
+			return fmt.Errorf("cannot parse the value: %w", err)
+		}
+
+		value = uint16(addr)
+	}
+
+	c := d.sys.GetCore()
+
+	if strings.ToLower(args[0]) == "pc" {
+		c.Pc = isa.Register(value)
+		d.showLocation()
+
+		return nil
+	}
+
+	reg, err := parsing.ParseRegister(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	c.Registers[reg] = isa.Register(value)
+
+	return nil
+}
+
+func (d *debugger) cmdDisasm(args []string) error {
+	addr := d.sys.GetCore().Pc
+	count := 8
+
+	if len(args) > 0 {
+		var err error
+		addr, err = d.resolveAddress(args[0])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 1 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+
+		if (err != nil) || (count < 1) {
+			return fmt.Errorf("the instruction count should be a positive number, got '%s'", args[1])
+		}
+	}
+
+	pc := d.sys.GetCore().Pc
+
+	for i := 0; i < count; i++ {
+		instrAddr := addr + isa.Register(i*isa.INSTRUCTION_SIZE)
+
+		if d.syms != nil {
+			if label, found := d.syms.LabelAt(instrAddr); found {
+				fmt.Fprintf(d.out, "%s:\n", label)
+			}
+		}
+
+		marker := "  "
+
+		if instrAddr == pc {
+			marker = "=>"
+		}
+
+		fmt.Fprintf(d.out, "%s %04X: %s\n", marker, instrAddr, d.disassembleAt(instrAddr))
+	}
+
+	return nil
+}
+
+func (d *debugger) cmdReset(args []string) error {
+	if err := d.sys.Restore(d.initial); err != nil {
+		return fmt.Errorf("cannot reset the system: %w", err)
+	}
+
+	d.instrsDone = 0
+	d.showLocation()
+
+	return nil
+}
+
+// repl reads the commands from the input until it ends or the debugger is told to quit.
+func (d *debugger) repl(in io.Reader) {
+	commands := map[string]func([]string) error{
+		"step":     d.cmdStep,
+		"s":        d.cmdStep,
+		"continue": d.cmdContinue,
+		"c":        d.cmdContinue,
+		"regs":     d.cmdRegs,
+		"mem":      d.cmdMem,
+		"break":    d.cmdBreak,
+		"b":        d.cmdBreak,
+		"watch":    d.cmdWatch,
+		"delete":   d.cmdDelete,
+		"info":     d.cmdInfo,
+		"set":      d.cmdSet,
+		"disasm":   d.cmdDisasm,
+		"reset":    d.cmdReset,
+	}
+
+	input := bufio.NewScanner(in)
+	lastLine := ""
+
+	for {
+		fmt.Fprint(d.out, "(mrav) ")
+
+		if !input.Scan() {
+			fmt.Fprintln(d.out)
+			break
+		}
+
+		line := strings.TrimSpace(input.Text())
+
+		if line == "" {
+			line = lastLine
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		lastLine = line
+
+		switch fields[0] {
+		case "quit", "q":
+			return
+		case "help", "h":
+			fmt.Fprintln(d.out, helpText)
+			continue
+		}
+
+		cmd, found := commands[fields[0]]
+
+		if !found {
+			fmt.Fprintf(d.out, "Unknown command '%s', try 'help'\n", fields[0])
+			continue
+		}
+
+		if err := cmd(fields[1:]); err != nil {
+			fmt.Fprintf(d.out, "Error: %v\n", err)
+		}
+	}
+}
+
+func main() {
+	softwareBinary := flag.String("software", "", "path to the software file")
+	symbolsFile := flag.String("symbols", "", "(optional) path to the symbol map from the assembler, for using labels")
+	verbose := flag.Bool("verbose", false, "whether to produce verbose output")
+	maxRun := flag.Int("max_continue", 1000000, "maximum number of instructions to run with a single continue")
+
+	flag.Parse()
+
+	softwareBytes, err := os.ReadFile(*softwareBinary)
+
+	if err != nil {
+		log.Fatalf("cannot load the software binary: %v", err)
+	}
+
+	var syms *symbols.SymbolMap
+
+	if *symbolsFile != "" {
+		syms, err = symbols.ReadFromFile(*symbolsFile)
+
+		if err != nil {
+			log.Fatalf("cannot load the symbol map: %v", err)
+		}
+	}
+
+	logger := slog.Default()
+	opts := &system.SystemOpts{
+		Logger:  logger,
+		Verbose: *verbose,
+	}
+
+	d, err := newDebugger(opts, softwareBytes, syms, *maxRun, os.Stdout)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d.showLocation()
+	d.repl(os.Stdin)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mrav/software/asm"
+	"mrav/software/symbols"
+	"mrav/system/easybus/easybustest"
+)
+
+// Counts in r2 and stores the count to the address 100.
+const cStoreProgram = `
+xor r1 r1 r1
+addi r1 100
+loop: addi r2 1
+sw r1 r2
+jal r0 loop
+`
+
+// newTestDebugger loads the program into the standard system, with the symbols of its labels.
+func newTestDebugger(t *testing.T, source string) (*debugger, *bytes.Buffer) {
+	t.Helper()
+
+	program, err := asm.AssembleModules([]string{source})
+
+	if err != nil {
+		t.Fatalf("cannot assemble the program: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	d, err := newDebugger(easybustest.Opts(), easybustest.Assemble(t, source), symbols.FromModule(program, nil), 100, out)
+
+	if err != nil {
+		t.Fatalf("cannot create the debugger: %v", err)
+	}
+
+	return d, out
+}
+
+// expectSession feeds the commands to the REPL and checks everything it printed, with the prompts.
+func expectSession(t *testing.T, source string, commands []string, expected []string) {
+	t.Helper()
+
+	d, out := newTestDebugger(t, source)
+	d.repl(strings.NewReader(strings.Join(commands, "\n") + "\n"))
+
+	if want := strings.Join(expected, "\n"); out.String() != want {
+		t.Fatalf("unexpected output\nexpected:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestBreakpointSession(t *testing.T) {
+	expectSession(t, cStoreProgram, []string{
+		"break loop+2",
+		"continue",
+		"", // Repeats the last command.
+		"regs",
+		"mem 100 2",
+		"info",
+		"delete 2",
+		"info",
+	}, []string{
+		"(mrav) #2: breakpoint at 0006",
+		"(mrav) Stopped at #2 (breakpoint at 0006): reached 0006",
+		"0006 <loop+2>: 3120  sw r1 r2",
+		"(mrav) Stopped at #2 (breakpoint at 0006): reached 0006",
+		"0006 <loop+2>: 3120  sw r1 r2",
+		"(mrav) PC = 0006, [ r0 = 000A r1 = 0064 r2 = 0002 r3 = 0000 r4 = 0000 r5 = 0000 r6 = 0000 r7 = 0000 r8 = 0000 r9 = 0000 r10 = 0000 r11 = 0000 r12 = 0000 r13 = 0000 r14 = 0000 r15 = 0000 ]",
+		"EPC = 0000, trap EPC = 0000, interrupts enabled = false, instructions = 6, cycles = 7",
+		"(mrav) 0064: 00 01",
+		"(mrav) #1: halt",
+		"#2: breakpoint at 0006",
+		"(mrav) (mrav) #1: halt",
+		"(mrav) ", // The end of the input.
+		"",
+	})
+}
+
+func TestWatchpointSession(t *testing.T) {
+	expectSession(t, cStoreProgram, []string{
+		"watch r2 == 4",
+		"c",
+		"watch 100 write",
+		"step 5",
+		"set pc loop",
+		"disasm loop 2",
+		"reset",
+		"info",
+	}, []string{
+		"(mrav) #2: r2 == 0004",
+		"(mrav) Stopped at #2 (r2 == 0004): r2 = 0004",
+		"0006 <loop+2>: 3120  sw r1 r2",
+		"(mrav) #3: watch write of 0064-0064",
+		"(mrav) Stopped at #2 (r2 == 0004): r2 = 0004",
+		"Stopped at #3 (watch write of 0064-0064): write of 0004 to 0064 at PC 0006",
+		"0008 <loop+4>: B004  jal r0 loop",
+		"(mrav) 0004 <loop>: 7201  addi r2 0x01",
+		"(mrav) loop:",
+		"=> 0004: 7201  addi r2 0x01",
+		"   0006: 3120  sw r1 r2",
+		"(mrav) 0000: 4111  xor r1 r1 r1",
+		"(mrav) #1: halt",
+		"#2: r2 == 0004",
+		"#3: watch write of 0064-0064",
+		"(mrav) ",
+		"",
+	})
+}
+
+func TestBadCommands(t *testing.T) {
+	expectSession(t, cStoreProgram, []string{
+		"bogus",
+		"step x",
+		"break nowhere",
+		"watch 0x20-0x10",
+		"quit",
+		"regs", // Not run after quitting.
+	}, []string{
+		"(mrav) Unknown command 'bogus', try 'help'",
+		"(mrav) Error: the instruction count should be a positive number, got 'x'",
+		"(mrav) Error: unknown label 'nowhere'",
+		"(mrav) Error: low address 0020 is above the high address 0010",
+		"(mrav) ",
+	})
+}
+
+// The debugger always stops when the program halts, without a breakpoint. The jump links, so it halts on its second run.
+func TestHaltSession(t *testing.T) {
+	program := `
+xor r1 r1 r1
+addi r1 1
+done: jal r0 done
+`
+
+	expectSession(t, program, []string{
+		"continue",
+		"regs",
+	}, []string{
+		"(mrav) Stopped at #1 (halt): halted in a loop at PC 0004",
+		"0004 <done>: B004  jal r0 done",
+		"(mrav) PC = 0004, [ r0 = 0006 r1 = 0001 r2 = 0000 r3 = 0000 r4 = 0000 r5 = 0000 r6 = 0000 r7 = 0000 r8 = 0000 r9 = 0000 r10 = 0000 r11 = 0000 r12 = 0000 r13 = 0000 r14 = 0000 r15 = 0000 ]",
+		"EPC = 0000, trap EPC = 0000, interrupts enabled = false, instructions = 4, cycles = 4",
+		"(mrav) ",
+		"",
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+
+	"mrav/system"
+	"mrav/system/easybus"
+	"mrav/system/easybus/gdbstub"
+	"mrav/system/easybus/standard"
+)
+
+func main() {
+	softwareBinary := flag.String("software", "", "path to the software file")
+	verbose := flag.Bool("verbose", false, "whether to produce verbose output")
+	port := flag.Int("port", 1234, "local TCP port for the debugger to connect to")
+
+	flag.Parse()
+
+	softwareBytes, err := os.ReadFile(*softwareBinary)
+
+	if err != nil {
+		log.Fatalf("cannot load the software binary: %v", err)
+	}
+
+	logger := slog.Default()
+	opts := &system.SystemOpts{
+		Logger:  logger,
+		Verbose: *verbose,
+	}
+
+	regions, err := standard.Regions(standard.DefaultOpts(), softwareBytes)
+
+	if err != nil {
+		log.Fatalf("cannot create the devices: %v", err)
+	}
+
+	sys, err := easybus.NewEasyBusSystem(opts, regions)
+
+	if err != nil {
+		log.Fatalf("cannot create a system: %v", err)
+	}
+
+	stub := gdbstub.NewStub(sys, &gdbstub.StubOpts{
+		Logger:  logger,
+		Verbose: *verbose,
+	})
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", *port))
+
+	if err != nil {
+		log.Fatalf("cannot listen for the debugger: %v", err)
+	}
+
+	defer listener.Close()
+
+	logger.Info("[GDB stub] Waiting for the debugger", "address", listener.Addr().String())
+
+	// The system is kept between the sessions, so the debugger can detach and attach again.
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			log.Fatalf("cannot accept the debugger connection: %v", err)
+		}
+
+		logger.Info("[GDB stub] Debugger connected", "remote", conn.RemoteAddr().String())
+
+		if err := stub.Serve(conn); err != nil {
+			logger.Error("[GDB stub] Session failed", "error", err)
+		}
+
+		conn.Close()
+		logger.Info("[GDB stub] Debugger disconnected")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log/slog"
 	"syscall/js"
@@ -8,8 +9,8 @@ import (
 	"mrav/isa"
 	"mrav/system"
 	"mrav/system/easybus"
-	"mrav/system/easybus/device"
 	"mrav/system/easybus/device/memory"
+	"mrav/system/easybus/trace"
 )
 
 type ErrorWrapper struct {
@@ -49,6 +50,9 @@ func simulateSystem(this js.Value, args []js.Value) interface{} {
 
 	instructionsToSim := args[1].Int()
 
+	// Optional third argument asks for the execution trace, returned as JSON Lines.
+	withTrace := (len(args) > 2) && args[2].Truthy()
+
 	logger := slog.Default()
 	opts := &system.SystemOpts{
 		Logger:  logger,
@@ -61,11 +65,18 @@ func simulateSystem(this js.Value, args []js.Value) interface{} {
 	}
 
 	// Note: Timer is intentionally omitted for browser version
-	sys, err := easybus.NewEasyBusSystem(opts, []device.Device{mem})
+	sys, err := easybus.NewEasyBusSystem(opts, []easybus.Region{easybus.MapDevice(0, mem)})
 	if err != nil {
 		return wrapError(fmt.Errorf("cannot create system: %w", err))
 	}
 
+	var traceBuf bytes.Buffer
+	traceWriter := trace.NewJsonLinesWriter(&traceBuf)
+
+	if withTrace {
+		sys.SetTracer(traceWriter)
+	}
+
 	instructionCount := 0
 	for i := 0; i < instructionsToSim; i++ {
 		if err := sys.RunInstruction(); err != nil {
@@ -84,6 +95,14 @@ func simulateSystem(this js.Value, args []js.Value) interface{} {
 	result["instructions"] = instructionCount
 	result["error"] = nil
 
+	if withTrace {
+		if err := traceWriter.Flush(); err != nil {
+			return wrapError(fmt.Errorf("cannot produce the trace: %w", err))
+		}
+
+		result["trace"] = traceBuf.String()
+	}
+
 	// Add memory contents to result
 	memBytes := mem.GetMemoryBytes()
 	for i, b := range memBytes {
@@ -1,85 +1,605 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 
+	"mrav/core"
 	"mrav/isa"
+	"mrav/software/asm/parsing"
+	"mrav/software/symbols"
 	"mrav/system"
+	"mrav/system/description"
 	"mrav/system/easybus"
-	"mrav/system/easybus/device"
+	"mrav/system/easybus/coverage"
+	"mrav/system/easybus/device/exit"
+	"mrav/system/easybus/device/gpio"
 	"mrav/system/easybus/device/memory"
 	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/device/uart"
+	"mrav/system/easybus/loader"
+	"mrav/system/easybus/profile"
+	"mrav/system/easybus/standard"
+	"mrav/system/easybus/trace"
+	"mrav/system/easybus/vcd"
 )
 
 func main() {
-	softwareBinary := flag.String("software", "", "path to the software file")
+	softwareBinary := flag.String("software", "", "path to the software file, loaded into the RAM")
 	verbose := flag.Bool("verbose", false, "whether to produce verbose output")
 	instructionsToSim := flag.Int("instructions_to_sim", 20, "number of instructions to simulate")
 	coreStateOutput := flag.String("core_state_output", "", "path to the file where the state of the core should be output after the simulation")
 	coreStateProtoOutput := flag.String("core_state_proto_output", "", "path to the file where the state of the core should be output after the simulation (proto format)")
+	clockHz := flag.Uint64("clock_hz", 0, "clock frequency of the simulated core, used for reporting the simulated time if set")
+	checkpointInput := flag.String("checkpoint_input", "", "path to the system checkpoint to resume the simulation from, the software binary is not needed in that case")
+	checkpointOutput := flag.String("checkpoint_output", "", "path to the file where the system checkpoint should be written after the simulation")
+	traceOutput := flag.String("trace_output", "", "path to the file where the per-instruction execution trace should be written")
+	traceFormat := flag.String("trace_format", "jsonl", "format of the execution trace, jsonl or binary")
+	vcdOutput := flag.String("vcd_output", "", "path to the file where the waveforms of the core, the bus and the devices should be written as a VCD, one timestamp per clock cycle")
+	profileOutput := flag.String("profile_output", "", "path to the file where the pprof profile of the program should be written")
+	coverageOutput := flag.String("coverage_output", "", "path to the file where the LCOV coverage of the program should be written, needs --symbols")
+	coverageSummary := flag.String("coverage_summary", "", "path to the file where the human-readable coverage summary should be written, - for the standard output")
+	symbolsFile := flag.String("symbols", "", "(optional) path to the symbol map from the assembler, for naming the functions in the profile and mapping the coverage to the source lines")
+	runUntilHalt := flag.Bool("run_until_halt", false, "run until the program halts (jumps in place or writes to the exit address), up to --max_instructions, exiting with the program's exit code; 1, 2, 124 and 125 are reserved for the simulator (see the README)")
+	maxInstructions := flag.Int("max_instructions", 1000000, "safety limit on the number of instructions with --run_until_halt, the run times out after it")
+	exitAddress := flag.Uint("exit_address", uint(exit.DEFAULT_ADDRESS), "address the program writes its exit code to")
+	ramBase := flag.Uint("ram_base", 0, "bus address where the RAM starts, the software binary is loaded there")
+	ramSize := flag.Int("ram_size", standard.RAM_SIZE, "size of the RAM in bytes")
+	romImage := flag.String("rom_image", "", "(optional) path to the image of a ROM, loaded independently of the software in the RAM")
+	romBase := flag.Uint("rom_base", 0, "bus address where the ROM starts, the RAM has to be moved with --ram_base if they overlap")
+	romSize := flag.Int("rom_size", 0, "size of the ROM in bytes, the size of the image if 0")
+	romWritePolicy := flag.String("rom_write_policy", "fault", "what the writes to the ROM do: fault (handled by --bus_fault) or ignore")
+	ramWaitStates := flag.Int("ram_wait_states", 0, "extra clock cycles every RAM access takes, including the instruction fetches")
+	timerBase := flag.Uint("timer_base", uint(timer.DEFAULT_BASE), "bus address of the timer registers (counter, control, status, reload, compare and prescaler)")
+	uartBackend := flag.String("uart", "", "(optional) adds a UART with the backend: stdio, pty (prints the terminal to connect to), file or none")
+	uartInput := flag.String("uart_input", "", "file the UART receives with --uart=file")
+	uartOutput := flag.String("uart_output", "", "file the UART sends to with --uart=file")
+	uartBase := flag.Uint("uart_base", uint(uart.DEFAULT_BASE), "bus address of the UART registers (data, status, control and divider)")
+	uartDivider := flag.Uint("uart_divider", 0, "clock cycles per bit of the UART, like the clock frequency over the baud rate, 0 sends and receives a byte per cycle")
+	gpioEnabled := flag.Bool("gpio", false, "adds the GPIO of the RTL SoC, with the output pins in the low byte of its register and the simulator-only input pins in the high byte")
+	gpioAddress := flag.Uint("gpio_address", uint(gpio.DEFAULT_ADDRESS), "bus address of the GPIO register")
+	gpioInputs := flag.String("gpio_inputs", "", "(optional) script of the GPIO input changes, a line with the cycle and the value for each, like '1000 0x01'")
+	gpioLog := flag.String("gpio_log", "", "(optional) path to the file where the GPIO output changes are logged, in the same format as the input script")
+	systemFile := flag.String("system", "", "(optional) system description JSON file with the devices to simulate, instead of the RAM, the timer and the peripherals placed with the flags")
+	busFault := flag.String("bus_fault", "abort", "what happens on accesses to unmapped addresses and the refused ones, like the writes to a ROM: abort, ignore (read 0, drop writes) or trap")
+	fast := flag.Bool("fast", false, "run the pre-decoded fast simulation, without checking the stop conditions")
+	interruptVector := flag.Uint("interrupt_vector", uint(core.DEFAULT_INTERRUPT_VECTOR), "address the core jumps to when taking an interrupt")
+	arbitration := flag.String("arbitration", "round_robin", "how the cores share the bus: round_robin or fixed_priority (the lowest hart ID first)")
+
+	var resetPcs []isa.Register
+
+	flag.Func("reset_pcs", "comma-separated reset PCs, one for each simulated core (a single core starting from 0 by default)", func(spec string) error {
+		for _, pcSpec := range strings.Split(spec, ",") {
+			pc, err := parsing.NumberValue(strings.TrimSpace(pcSpec))
+
+			if err != nil {
+				return err
+			}
+
+			resetPcs = append(resetPcs, isa.Register(pc))
+		}
+
+		return nil
+	})
+
+	var stopConditions []easybus.StopCondition
+
+	flag.Func("break_pc", "stop when the PC reaches the given address (can be repeated)", func(spec string) error {
+		pc, err := parsing.NumberValue(spec)
+
+		if err != nil {
+			return err
+		}
+
+		stopConditions = append(stopConditions, &easybus.PcBreakpoint{Pc: isa.Register(pc)})
+		return nil
+	})
+
+	watchAddress := func(onRead bool, onWrite bool) func(string) error {
+		return func(spec string) error {
+			lo, hi, err := easybus.ParseAddressRange(spec)
+
+			if err != nil {
+				return err
+			}
+
+			stopConditions = append(stopConditions, &easybus.AddressWatchpoint{Lo: lo, Hi: hi, OnRead: onRead, OnWrite: onWrite})
+			return nil
+		}
+	}
+
+	flag.Func("watch_read", "stop after reading from the address or the 'lo-hi' address range (can be repeated)", watchAddress(true, false))
+	flag.Func("watch_write", "stop after writing to the address or the 'lo-hi' address range (can be repeated)", watchAddress(false, true))
+	flag.Func("watch_access", "stop after reading from or writing to the address or the 'lo-hi' address range (can be repeated)", watchAddress(true, true))
+
+	var requiredRanges [][2]isa.Register
+
+	flag.Func("require_mapped", "fail unless every address in the 'lo-hi' address range is mapped to a device (can be repeated)", func(spec string) error {
+		lo, hi, err := easybus.ParseAddressRange(spec)
+
+		if err != nil {
+			return err
+		}
+
+		requiredRanges = append(requiredRanges, [2]isa.Register{lo, hi})
+		return nil
+	})
+
+	flag.Func("watch_reg", "stop when the register changes its value (can be repeated)", func(spec string) error {
+		reg, err := parsing.ParseRegister(spec)
+
+		if err != nil {
+			return err
+		}
+
+		stopConditions = append(stopConditions, &easybus.RegisterWatchpoint{Register: reg})
+		return nil
+	})
+
+	flag.Func("stop_when", "stop when the register condition like 'r3 == 0x10' holds (can be repeated)", func(spec string) error {
+		cond, err := easybus.ParseRegisterCondition(spec)
+
+		if err != nil {
+			return err
+		}
+
+		stopConditions = append(stopConditions, cond)
+		return nil
+	})
 
 	flag.Parse()
 
-	softwareBytes, err := os.ReadFile(*softwareBinary)
+	if *fast && (len(stopConditions) > 0) {
+		log.Fatalf("stop conditions are not checked in the fast simulation")
+	}
 
-	if err != nil {
-		log.Fatalf("cannot load the software binary: %v", err)
+	// The checkpoint has the interrupt vector of the cores, restoring it would silently override the flag.
+	if *checkpointInput != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "interrupt_vector" {
+				log.Fatalf("the interrupt vector comes from the checkpoint, --interrupt_vector can't be used with --checkpoint_input")
+			}
+		})
+	}
+
+	// The profile and the coverage take the PCs as the offsets into the software binary.
+	if ((*profileOutput != "") || (*coverageOutput != "") || (*coverageSummary != "")) && ((*ramBase != 0) || (*romImage != "")) {
+		log.Fatalf("the profile and the coverage need the software binary at address 0, without --ram_base or --rom_image")
+	}
+
+	var softwareBytes []byte
+
+	if *softwareBinary != "" {
+		var err error
+		softwareBytes, err = os.ReadFile(*softwareBinary)
+
+		if err != nil {
+			log.Fatalf("cannot load the software binary: %v", err)
+		}
+	} else if (*checkpointInput == "") && (*romImage == "") {
+		log.Fatalf("either the software binary, the ROM image or the checkpoint to resume from is needed")
 	}
 
 	logger := slog.Default()
+	vector := isa.Register(*interruptVector)
 	opts := &system.SystemOpts{
-		Logger:  logger,
-		Verbose: *verbose,
+		Logger:          logger,
+		Verbose:         *verbose,
+		InterruptVector: &vector,
+		ResetPcs:        resetPcs,
+	}
+
+	var sys *easybus.EasyBusSystem
+
+	if *systemFile != "" {
+		desc, err := description.ReadFromFile(*systemFile)
+
+		if err != nil {
+			log.Fatalf("cannot load the system description: %v", err)
+		}
+
+		sys, err = loader.NewSystem(desc, opts, softwareBytes)
+
+		if err != nil {
+			log.Fatalf("cannot create a system: %v", err)
+		}
+	} else {
+		regions, err := standard.Regions(&standard.Opts{
+			RamBase:       isa.Register(*ramBase),
+			RamSize:       *ramSize,
+			RamWaitStates: *ramWaitStates,
+			TimerBase:     isa.Register(*timerBase),
+			ExitAddress:   isa.Register(*exitAddress),
+		}, softwareBytes)
+
+		if err != nil {
+			log.Fatalf("cannot create the devices: %v", err)
+		}
+
+		if (*romImage != "") || (*romSize > 0) {
+			rom, err := newRom(*romImage, *romSize, *romWritePolicy)
+
+			if err != nil {
+				log.Fatalf("cannot set up the ROM: %v", err)
+			}
+
+			regions = append(regions, easybus.MapDevice(isa.Register(*romBase), rom))
+		}
+
+		if *uartBackend != "" {
+			backend, err := uart.OpenBackend(*uartBackend, *uartInput, *uartOutput)
+
+			if err != nil {
+				log.Fatalf("cannot set up the UART: %v", err)
+			}
+
+			if pty, ok := backend.(*uart.PtyBackend); ok {
+				logger.Info("[System] UART connected to a pseudo-terminal", "path", pty.Path)
+			}
+
+			regions = append(regions, easybus.MapDevice(isa.Register(*uartBase), uart.NewUart(backend, isa.Register(*uartDivider))))
+		}
+
+		if *gpioEnabled {
+			gpioDev, err := gpio.NewGpioFromFiles(*gpioInputs, *gpioLog)
+
+			if err != nil {
+				log.Fatalf("cannot set up the GPIO: %v", err)
+			}
+
+			regions = append(regions, easybus.MapDevice(isa.Register(*gpioAddress), gpioDev))
+		}
+
+		sys, err = easybus.NewEasyBusSystem(opts, regions)
+
+		if err != nil {
+			log.Fatalf("cannot create a system: %v", err)
+		}
+	}
+
+	if *verbose {
+		for _, region := range sys.MemoryMap().Regions() {
+			logger.Info("[System] Mapped", "device", region.Device.Name(), "base", fmt.Sprintf("%04X", region.Base), "size", region.Size)
+		}
+	}
+
+	for _, required := range requiredRanges {
+		if err := sys.MemoryMap().CheckMapped(required[0], required[1]); err != nil {
+			log.Fatalf("invalid memory map: %v", err)
+		}
 	}
 
-	mem, err := memory.NewMem(1024, softwareBytes)
+	faultPolicy, err := easybus.ParseBusFaultPolicy(*busFault)
 
 	if err != nil {
-		log.Fatalf("cannot create the memory devices: %v", err)
+		log.Fatalf("cannot set up the bus: %v", err)
 	}
 
-	tim := &timer.Timer{}
+	if err := sys.SetBusFaultPolicy(faultPolicy); err != nil {
+		log.Fatalf("cannot set up the bus: %v", err)
+	}
 
-	sys, err := easybus.NewEasyBusSystem(opts, []device.Device{mem, tim})
+	arbitrationPolicy, err := easybus.ParseArbitrationPolicy(*arbitration)
 
 	if err != nil {
-		log.Fatalf("cannot create a system: %v", err)
+		log.Fatalf("cannot set up the bus: %v", err)
 	}
 
-	for i := 0; i < *instructionsToSim; i++ {
-		if err := sys.RunInstruction(); err != nil {
-			log.Fatalf("cannot run a system instruction: %v", err)
+	sys.SetArbitration(arbitrationPolicy)
+
+	if *checkpointInput != "" {
+		if err := sys.RestoreFromFile(*checkpointInput); err != nil {
+			log.Fatalf("cannot resume from the checkpoint: %v", err)
+		}
+	}
+
+	for _, cond := range stopConditions {
+		sys.AddStopCondition(cond)
+	}
+
+	limit := *instructionsToSim
+
+	if *runUntilHalt {
+		limit = *maxInstructions
+		sys.AddStopCondition(&easybus.HaltCondition{})
+	}
+
+	var traceWriter trace.Writer
+
+	if *traceOutput != "" {
+		traceFile, err := os.Create(*traceOutput)
+
+		if err != nil {
+			log.Fatalf("cannot create the trace file: %v", err)
 		}
 
-		snap, err := sys.CoreDebug([]isa.RegisterId{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+		defer traceFile.Close()
+
+		traceWriter, err = trace.NewWriter(*traceFormat, traceFile)
 
 		if err != nil {
-			log.Fatalf("cannot snapshot the core: %v", err)
+			log.Fatalf("cannot create the trace writer: %v", err)
 		}
 
-		if *verbose {
-			logger.Info("[Core] Snapshot", "state", snap)
+		sys.SetTracer(traceWriter)
+	}
+
+	var vcdWriter *vcd.Writer
+
+	if *vcdOutput != "" {
+		vcdFile, err := os.Create(*vcdOutput)
+
+		if err != nil {
+			log.Fatalf("cannot create the VCD file: %v", err)
+		}
+
+		defer vcdFile.Close()
+
+		vcdWriter = vcd.NewWriter(vcdFile)
+
+		if err := sys.SetWaveform(vcdWriter); err != nil {
+			log.Fatalf("cannot record the waveforms: %v", err)
 		}
 	}
 
+	var syms *symbols.SymbolMap
+
+	if *symbolsFile != "" {
+		syms, err = symbols.ReadFromFile(*symbolsFile)
+
+		if err != nil {
+			log.Fatalf("cannot load the symbols: %v", err)
+		}
+	}
+
+	var profilers easybus.Profilers
+	var profiler *profile.Profiler
+	var collector *coverage.Collector
+
+	if *profileOutput != "" {
+		profiler = profile.NewProfiler(syms)
+		profilers = append(profilers, profiler)
+	}
+
+	if (*coverageOutput != "") || (*coverageSummary != "") {
+		if softwareBytes == nil {
+			log.Fatalf("the coverage needs the software binary")
+		}
+
+		collector = coverage.NewCollector()
+		profilers = append(profilers, collector)
+	}
+
+	if len(profilers) > 0 {
+		sys.SetProfiler(profilers)
+	}
+
+	instructionsDone := 0
+
+	if *fast {
+		if *runUntilHalt {
+			instructionsDone, err = sys.RunFastUntilHalt(limit)
+		} else {
+			instructionsDone, err = sys.RunFast(limit)
+		}
+
+		if err != nil {
+			if traceWriter != nil {
+				traceWriter.Flush()
+			}
+
+			if vcdWriter != nil {
+				vcdWriter.Flush()
+			}
+
+			log.Fatalf("cannot run a system instruction: %v", err)
+		}
+	} else {
+		for instructionsDone < limit {
+			events, done, err := sys.RunUntilStop(1)
+
+			if err != nil {
+				// Keep the trace up to the failure, it's the most interesting part.
+				if traceWriter != nil {
+					traceWriter.Flush()
+				}
+
+				if vcdWriter != nil {
+					vcdWriter.Flush()
+				}
+
+				log.Fatalf("cannot run a system instruction: %v", err)
+			}
+
+			instructionsDone += done
+
+			snap, err := sys.CoreDebug([]isa.RegisterId{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+
+			if err != nil {
+				log.Fatalf("cannot snapshot the core: %v", err)
+			}
+
+			if *verbose {
+				logger.Info("[Core] Snapshot", "state", snap)
+			}
+
+			if len(events) > 0 {
+				for _, event := range events {
+					logger.Info("[System] Stopped", "condition", event.String())
+				}
+
+				break
+			}
+		}
+	}
+
+	if traceWriter != nil {
+		if err := traceWriter.Flush(); err != nil {
+			log.Fatalf("unable to write the trace: %v", err)
+		}
+	}
+
+	if vcdWriter != nil {
+		if err := vcdWriter.Flush(); err != nil {
+			log.Fatalf("unable to write the VCD: %v", err)
+		}
+	}
+
+	if profiler != nil {
+		if err := profiler.WriteToFile(*profileOutput); err != nil {
+			log.Fatalf("unable to write the profile: %v", err)
+		}
+	}
+
+	if collector != nil {
+		if err := writeCoverage(collector, softwareBytes, syms, *coverageOutput, *coverageSummary); err != nil {
+			log.Fatalf("unable to write the coverage: %v", err)
+		}
+	}
+
+	if *clockHz != 0 {
+		logger.Info("[System] Simulation finished", "instructions", instructionsDone, "cycles", sys.Cycles(), "seconds", float64(sys.Cycles())/float64(*clockHz))
+	} else {
+		logger.Info("[System] Simulation finished", "instructions", instructionsDone, "cycles", sys.Cycles())
+	}
+
 	if *coreStateOutput != "" {
 		coreState, err := sys.CoreDebug([]isa.RegisterId{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
 
 		if err != nil {
-			log.Fatalf("unable to generate the core state string: %w", err)
+			log.Fatalf("unable to generate the core state string: %v", err)
 		}
 
 		if err := os.WriteFile(*coreStateOutput, []byte(coreState), 0644); err != nil {
-			log.Fatalf("unable to dump the core state string: %w", err)
+			log.Fatalf("unable to dump the core state string: %v", err)
 		}
 	}
 
 	if *coreStateProtoOutput != "" {
 		if err := sys.ProtoCoreDebugFile(*coreStateProtoOutput); err != nil {
-			log.Fatalf("unable to dump core proto: %w", err)
+			log.Fatalf("unable to dump core proto: %v", err)
+		}
+	}
+
+	if *checkpointOutput != "" {
+		if err := sys.CheckpointToFile(*checkpointOutput); err != nil {
+			log.Fatalf("unable to write the checkpoint: %v", err)
 		}
 	}
+
+	// Not deferred, os.Exit doesn't run the deferred calls.
+	if err := sys.Close(); err != nil {
+		log.Fatalf("unable to close the devices: %v", err)
+	}
+
+	if *runUntilHalt {
+		os.Exit(haltExitCode(sys, instructionsDone >= limit, logger))
+	}
+}
+
+// Process exit codes with --run_until_halt, besides the exit code passed by the program itself. They're reserved, the
+// program's codes that collide with them are reported as cExitReserved instead.
+const (
+	cExitFailed   = 1   // The simulation failed, from log.Fatalf
+	cExitStopped  = 2   // Stopped by another stop condition before halting
+	cExitTimedOut = 124 // Same as the coreutils timeout
+	cExitReserved = 125 // The program's exit code is one of the reserved ones, or has only the high byte set
+)
+
+// haltExitCode is 0 for a program jumping in place, or the low byte of the code written to the exit device. The codes
+// reserved for the simulator, and the ones with only the high byte set, are mapped to cExitReserved, so the failure is
+// not lost or mistaken for one of the simulator.
+func haltExitCode(sys *easybus.EasyBusSystem, limitReached bool, logger *slog.Logger) int {
+	halt := sys.Halted()
+
+	if halt == nil {
+		if limitReached {
+			logger.Info("[System] Timed out before the program halted")
+			return cExitTimedOut
+		}
+
+		return cExitStopped
+	}
+
+	logger.Info("[System] Program halted", "halt", halt.String())
+
+	if (halt.Reason != easybus.HALT_EXIT) || (halt.ExitCode == 0) {
+		return 0
+	}
+
+	switch code := int(halt.ExitCode & 0xFF); code {
+	case 0, cExitFailed, cExitStopped, cExitTimedOut, cExitReserved:
+		logger.Info("[System] Exit code not passed through, reserved or only in the high byte", "code", halt.ExitCode, "reported", cExitReserved)
+		return cExitReserved
+	default:
+		return code
+	}
+}
+
+// newRom loads the image into a ROM of the size, or of the size of the image if the size is 0.
+func newRom(imagePath string, size int, writePolicy string) (*memory.Rom, error) {
+	policy, err := memory.ParseRomWritePolicy(writePolicy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var image []byte
+
+	if imagePath != "" {
+		image, err = os.ReadFile(imagePath)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the ROM image: %w", err)
+		}
+	}
+
+	if size == 0 {
+		size = len(image)
+	}
+
+	return memory.NewRom(size, image, policy)
+}
+
+func writeCoverage(collector *coverage.Collector, image []byte, syms *symbols.SymbolMap, lcovPath string, summaryPath string) error {
+	report, err := collector.Report(image, syms)
+
+	if err != nil {
+		return err
+	}
+
+	if lcovPath != "" {
+		var buf bytes.Buffer
+
+		if err := report.WriteLcov(&buf); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(lcovPath, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("cannot write the LCOV file: %w", err)
+		}
+	}
+
+	if summaryPath == "-" {
+		return report.WriteSummary(os.Stdout)
+	}
+
+	if summaryPath != "" {
+		var buf bytes.Buffer
+
+		if err := report.WriteSummary(&buf); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(summaryPath, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("cannot write the coverage summary: %w", err)
+		}
+	}
+
+	return nil
 }
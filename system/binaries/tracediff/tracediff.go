@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"mrav/core/proto"
+	"mrav/system/easybus/trace"
+)
+
+func loadTrace(path string, format string) []*proto.TraceRecord {
+	if format == "" {
+		format = trace.FormatFromPath(path)
+	}
+
+	records, err := trace.ReadFile(path, format)
+
+	if err != nil {
+		log.Fatalf("cannot load the trace %s: %v", path, err)
+	}
+
+	return records
+}
+
+func printContext(name string, records []*proto.TraceRecord, skip int, from int, to int, divergent int) {
+	fmt.Printf("%s:\n", name)
+
+	for i := max(from, 0); i < min(to, len(records)-skip); i++ {
+		marker := "  "
+
+		if i == divergent {
+			marker = ">>"
+		}
+
+		fmt.Printf("%s #%-6d %s\n", marker, i+skip, trace.FormatRecord(records[i+skip]))
+	}
+}
+
+func main() {
+	leftPath := flag.String("left", "", "path to the first trace, e.g. from the Go simulation")
+	rightPath := flag.String("right", "", "path to the second trace, e.g. from the RTL simulation")
+	leftFormat := flag.String("left_format", "", "format of the first trace, jsonl or binary (by default from the file extension, .jsonl or anything else for binary)")
+	rightFormat := flag.String("right_format", "", "format of the second trace, jsonl or binary (by default from the file extension, .jsonl or anything else for binary)")
+	leftSkip := flag.Int("left_skip", 0, "number of records to drop from the start of the first trace before aligning")
+	rightSkip := flag.Int("right_skip", 0, "number of records to drop from the start of the second trace before aligning")
+	alignWindow := flag.Int("align_window", 100, "number of records from the start of each trace (after the skips) searched for the first instruction both traces run, 0 to align them as they are")
+	ignoreCycles := flag.Bool("ignore_cycles", false, "whether to ignore the cycle counts when comparing")
+	context := flag.Int("context", 5, "number of records to show around the divergence")
+
+	flag.Parse()
+
+	if (*leftPath == "") || (*rightPath == "") {
+		log.Fatalf("both traces are needed")
+	}
+
+	left := loadTrace(*leftPath, *leftFormat)
+	right := loadTrace(*rightPath, *rightFormat)
+
+	if (*leftSkip > len(left)) || (*rightSkip > len(right)) {
+		log.Fatalf("cannot skip more records than the traces have (%d and %d)", len(left), len(right))
+	}
+
+	if *alignWindow > 0 {
+		leftAlign, rightAlign, err := trace.Align(left[*leftSkip:], right[*rightSkip:], *alignWindow)
+
+		if err != nil {
+			log.Fatalf("cannot align the traces: %v", err)
+		}
+
+		*leftSkip += leftAlign
+		*rightSkip += rightAlign
+
+		fmt.Printf("Aligned at left record #%d and right record #%d (offset %d)\n", *leftSkip, *rightSkip, *rightSkip-*leftSkip)
+	}
+
+	div, err := trace.Diff(left, right, &trace.DiffOpts{
+		LeftSkip:     *leftSkip,
+		RightSkip:    *rightSkip,
+		IgnoreCycles: *ignoreCycles,
+	})
+
+	if err != nil {
+		log.Fatalf("cannot compare the traces: %v", err)
+	}
+
+	leftLen := len(left) - *leftSkip
+	rightLen := len(right) - *rightSkip
+
+	if div == nil {
+		fmt.Printf("Traces match for %d instructions\n", min(leftLen, rightLen))
+
+		if leftLen != rightLen {
+			fmt.Printf("Lengths differ after the alignment: %d vs %d records, the rest is not compared\n", leftLen, rightLen)
+		}
+
+		return
+	}
+
+	fmt.Printf("Traces diverge at instruction %d (left record #%d, right record #%d):\n", div.Index, div.Index+*leftSkip, div.Index+*rightSkip)
+
+	for _, diff := range div.Differences {
+		fmt.Printf("  %s\n", diff)
+	}
+
+	fmt.Println()
+	printContext("Left "+*leftPath, left, *leftSkip, div.Index-*context, div.Index+*context+1, div.Index)
+	fmt.Println()
+	printContext("Right "+*rightPath, right, *rightSkip, div.Index-*context, div.Index+*context+1, div.Index)
+
+	os.Exit(1)
+}
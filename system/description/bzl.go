@@ -0,0 +1,69 @@
+package description
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// WriteBzl writes the RTL devices as a Starlark list named DEVICES, for the Bazel macros that create the bus device
+// rules. Bazel can't read the description while loading the macros, so the output is checked in next to them, and the
+// source is the name of the description mentioned in its header.
+func (s *System) WriteBzl(w io.Writer, source string) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Generated from %s by //system/description/bzlgen, don't edit.\n\n", source)
+	sb.WriteString("DEVICES = [\n")
+
+	for _, dev := range s.Devices {
+		if !dev.In(TARGET_RTL) {
+			continue
+		}
+
+		sb.WriteString("    {\n")
+		fmt.Fprintf(&sb, "        \"id\": %s,\n", starlarkString(dev.Id))
+		fmt.Fprintf(&sb, "        \"type\": %s,\n", starlarkString(dev.Type))
+		fmt.Fprintf(&sb, "        \"addr_lo\": 0x%04X,\n", uint16(dev.Base))
+		fmt.Fprintf(&sb, "        \"addr_hi\": 0x%04X,\n", uint16(dev.Last()))
+
+		if len(dev.Params) == 0 {
+			sb.WriteString("        \"params\": {},\n")
+		} else {
+			sb.WriteString("        \"params\": {\n")
+
+			names := make([]string, 0, len(dev.Params))
+
+			for name := range dev.Params {
+				names = append(names, name)
+			}
+
+			slices.Sort(names)
+
+			for _, name := range names {
+				fmt.Fprintf(&sb, "            %s: %s,\n", starlarkString(name), starlarkString(dev.Params[name]))
+			}
+
+			sb.WriteString("        },\n")
+		}
+
+		sb.WriteString("    },\n")
+	}
+
+	sb.WriteString("]\n")
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// The JSON strings without the HTML escaping are valid Starlark strings.
+func starlarkString(text string) string {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(text)
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
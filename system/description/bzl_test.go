@@ -0,0 +1,72 @@
+package description
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestWriteBzl(t *testing.T) {
+	desc, err := Parse([]byte(cDescription))
+
+	if err != nil {
+		t.Fatalf("cannot parse the description: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := desc.WriteBzl(&buf, "test.json"); err != nil {
+		t.Fatalf("cannot write the devices: %v", err)
+	}
+
+	expected := `# Generated from test.json by //system/description/bzlgen, don't edit.
+
+DEVICES = [
+    {
+        "id": "ram",
+        "type": "memory",
+        "addr_lo": 0x0000,
+        "addr_hi": 0x03FF,
+        "params": {
+            "image": "software",
+        },
+    },
+    {
+        "id": "gpio",
+        "type": "gpio",
+        "addr_lo": 0x0400,
+        "addr_hi": 0x0400,
+        "params": {},
+    },
+]
+`
+
+	if buf.String() != expected {
+		t.Fatalf("expected the RTL devices\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+// The checked-in devices of mrav_small have to be regenerated with bzlgen whenever the description changes.
+func TestMravSmallBzlUpToDate(t *testing.T) {
+	desc, err := ReadFromFile("../../hardware/rtl/soc/mrav_small.json")
+
+	if err != nil {
+		t.Fatalf("cannot load the description: %v", err)
+	}
+
+	checkedIn, err := os.ReadFile("../../hardware/rtl/soc/build_defs/mrav_small_devices.bzl")
+
+	if err != nil {
+		t.Fatalf("cannot read the checked-in devices: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := desc.WriteBzl(&buf, "mrav_small.json"); err != nil {
+		t.Fatalf("cannot write the devices: %v", err)
+	}
+
+	if buf.String() != string(checkedIn) {
+		t.Fatalf("mrav_small_devices.bzl is out of date, regenerate it with //system/description/bzlgen")
+	}
+}
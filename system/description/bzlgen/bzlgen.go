@@ -0,0 +1,39 @@
+// The bzlgen tool writes the RTL devices of a system description for the Bazel macros, like mrav_small. Run it after
+// changing the description:
+//
+//	bazel run //system/description/bzlgen -- --system_file=$PWD/hardware/rtl/soc/mrav_small.json --bzl_file=$PWD/hardware/rtl/soc/build_defs/mrav_small_devices.bzl
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"mrav/system/description"
+)
+
+func main() {
+	systemFile := flag.String("system_file", "", "system description JSON file")
+	bzlFile := flag.String("bzl_file", "", "output Starlark file with the RTL devices")
+
+	flag.Parse()
+
+	desc, err := description.ReadFromFile(*systemFile)
+
+	if err != nil {
+		log.Fatalf("cannot load the system description: %v", err)
+	}
+
+	outputFile, err := os.Create(*bzlFile)
+
+	if err != nil {
+		log.Fatalf("cannot prepare the output Starlark file: %v", err)
+	}
+
+	defer outputFile.Close()
+
+	if err := desc.WriteBzl(outputFile, filepath.Base(*systemFile)); err != nil {
+		log.Fatalf("cannot write the devices: %v", err)
+	}
+}
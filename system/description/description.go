@@ -0,0 +1,172 @@
+package description
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+const (
+	TARGET_SIMULATION = "simulation"
+	TARGET_RTL        = "rtl"
+)
+
+const cBusAddresses = 1 << 16
+
+// Device IDs end up in the names of the RTL signals.
+var deviceIdPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Address is a bus address, written either as a JSON number or as a string like "0xFFF0".
+type Address uint16
+
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var text string
+
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+
+	value, err := strconv.ParseUint(text, 0, 16)
+
+	if err != nil {
+		return fmt.Errorf("invalid bus address %s: %w", string(data), err)
+	}
+
+	*a = Address(value)
+
+	return nil
+}
+
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%04X", uint16(a)))
+}
+
+// Device is one of the devices on the bus. The type tells the simulator which model to build, and the parameters
+// are specific to the type.
+type Device struct {
+	Id      string            `json:"id"`
+	Type    string            `json:"type"`
+	Base    Address           `json:"base"`
+	Size    int               `json:"size"`
+	Params  map[string]string `json:"params,omitempty"`
+	Targets []string          `json:"targets,omitempty"` // Both the simulation and the RTL without it
+}
+
+// Last is the highest bus address of the device.
+func (d *Device) Last() Address {
+	return d.Base + Address(d.Size-1)
+}
+
+// In tells if the device is a part of the system built for the target.
+func (d *Device) In(target string) bool {
+	return (len(d.Targets) == 0) || slices.Contains(d.Targets, target)
+}
+
+func (d *Device) Param(name string) (string, bool) {
+	value, found := d.Params[name]
+	return value, found
+}
+
+// System describes the devices of a SoC, for both the Go simulator and the RTL bus generator, so the two don't drift
+// apart.
+type System struct {
+	Devices []*Device `json:"devices"`
+
+	// Directory of the description file, the relative paths in the parameters are resolved from it.
+	Dir string `json:"-"`
+}
+
+func Parse(data []byte) (*System, error) {
+	var desc System
+
+	if err := json.Unmarshal(data, &desc); err != nil {
+		return nil, fmt.Errorf("cannot decode the system description: %w", err)
+	}
+
+	if err := desc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &desc, nil
+}
+
+func ReadFromFile(filePath string) (*System, error) {
+	data, err := os.ReadFile(filePath)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the system description: %w", err)
+	}
+
+	desc, err := Parse(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	desc.Dir = filepath.Dir(filePath)
+
+	return desc, nil
+}
+
+// Validate checks that the device IDs are unique and that the devices fit on the bus without overlapping, whichever
+// target they are for.
+func (s *System) Validate() error {
+	ids := make(map[string]bool)
+
+	for _, dev := range s.Devices {
+		if !deviceIdPattern.MatchString(dev.Id) {
+			return fmt.Errorf("invalid device ID '%s', expected lowercase letters, digits and underscores", dev.Id)
+		}
+
+		if ids[dev.Id] {
+			return fmt.Errorf("device ID '%s' is used more than once", dev.Id)
+		}
+
+		ids[dev.Id] = true
+
+		if dev.Type == "" {
+			return fmt.Errorf("device '%s' has no type", dev.Id)
+		}
+
+		if dev.Size <= 0 {
+			return fmt.Errorf("device '%s' has no addresses, size %d", dev.Id, dev.Size)
+		}
+
+		if int(dev.Base)+dev.Size > cBusAddresses {
+			return fmt.Errorf("device '%s' at %04X with %d addresses doesn't fit on the bus", dev.Id, dev.Base, dev.Size)
+		}
+
+		for _, target := range dev.Targets {
+			if (target != TARGET_SIMULATION) && (target != TARGET_RTL) {
+				return fmt.Errorf("device '%s' has an unknown target '%s'", dev.Id, target)
+			}
+		}
+	}
+
+	sorted := slices.Clone(s.Devices)
+
+	slices.SortStableFunc(sorted, func(a, b *Device) int {
+		return int(a.Base) - int(b.Base)
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Base <= sorted[i-1].Last() {
+			return fmt.Errorf("devices '%s' [%04X-%04X] and '%s' [%04X-%04X] overlap", sorted[i-1].Id, sorted[i-1].Base, sorted[i-1].Last(), sorted[i].Id, sorted[i].Base, sorted[i].Last())
+		}
+	}
+
+	return nil
+}
+
+// Path resolves a file path from the parameters of the devices.
+func (s *System) Path(path string) string {
+	if filepath.IsAbs(path) || (s.Dir == "") {
+		return path
+	}
+
+	return filepath.Join(s.Dir, path)
+}
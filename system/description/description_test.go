@@ -0,0 +1,67 @@
+package description
+
+import (
+	"strings"
+	"testing"
+)
+
+const cDescription = `{
+  "devices": [
+    {"id": "ram", "type": "memory", "base": 0, "size": 1024, "params": {"image": "software"}},
+    {"id": "timer", "type": "timer", "base": "0xFFF0", "size": 3, "targets": ["simulation"]},
+    {"id": "gpio", "type": "gpio", "base": "0x0400", "size": 1, "targets": ["rtl"]}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	desc, err := Parse([]byte(cDescription))
+
+	if err != nil {
+		t.Fatalf("cannot parse the description: %v", err)
+	}
+
+	if len(desc.Devices) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(desc.Devices))
+	}
+
+	timer := desc.Devices[1]
+
+	if (timer.Base != 0xFFF0) || (timer.Last() != 0xFFF2) {
+		t.Fatalf("expected the timer at FFF0-FFF2, got %04X-%04X", timer.Base, timer.Last())
+	}
+
+	if timer.In(TARGET_RTL) || !timer.In(TARGET_SIMULATION) {
+		t.Fatalf("expected the timer to only be simulated")
+	}
+
+	if !desc.Devices[0].In(TARGET_RTL) || !desc.Devices[0].In(TARGET_SIMULATION) {
+		t.Fatalf("expected the memory in both targets")
+	}
+
+	if image, _ := desc.Devices[0].Param("image"); image != "software" {
+		t.Fatalf("unexpected image parameter '%s'", image)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	descriptions := map[string]string{
+		"overlap":        `{"devices": [{"id": "a", "type": "memory", "base": 0, "size": 256}, {"id": "b", "type": "timer", "base": 253, "size": 3}]}`,
+		"duplicate ID":   `{"devices": [{"id": "a", "type": "memory", "base": 0, "size": 16}, {"id": "a", "type": "timer", "base": 16, "size": 3}]}`,
+		"bad ID":         `{"devices": [{"id": "My-RAM", "type": "memory", "base": 0, "size": 16}]}`,
+		"off the bus":    `{"devices": [{"id": "a", "type": "timer", "base": "0xFFFE", "size": 3}]}`,
+		"no size":        `{"devices": [{"id": "a", "type": "timer", "base": 0}]}`,
+		"unknown target": `{"devices": [{"id": "a", "type": "timer", "base": 0, "size": 3, "targets": ["fpga"]}]}`,
+	}
+
+	for name, text := range descriptions {
+		if _, err := Parse([]byte(text)); err == nil {
+			t.Errorf("expected the description with %s to be rejected", name)
+		}
+	}
+
+	_, err := Parse([]byte(descriptions["overlap"]))
+
+	if !strings.Contains(err.Error(), "'a' [0000-00FF] and 'b' [00FD-00FF] overlap") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package easybus
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+type BusFaultPolicy int
+
+const (
+	BUS_FAULT_ABORT  BusFaultPolicy = iota // The simulation fails with an error
+	BUS_FAULT_IGNORE                       // Reads return 0 and writes are dropped, like on the RTL bus
+	BUS_FAULT_TRAP                         // Same as ignoring, then the core traps to the interrupt vector
+)
+
+var busFaultPolicyNames = map[string]BusFaultPolicy{
+	"abort":  BUS_FAULT_ABORT,
+	"ignore": BUS_FAULT_IGNORE,
+	"trap":   BUS_FAULT_TRAP,
+}
+
+func ParseBusFaultPolicy(name string) (BusFaultPolicy, error) {
+	policy, found := busFaultPolicyNames[strings.ToLower(name)]
+
+	if !found {
+		names := make([]string, 0, len(busFaultPolicyNames))
+
+		for policyName := range busFaultPolicyNames {
+			names = append(names, policyName)
+		}
+
+		slices.Sort(names)
+
+		return 0, fmt.Errorf("unknown bus fault policy '%s', expected one of: %s", name, strings.Join(names, ", "))
+	}
+
+	return policy, nil
+}
+
+// UnmappedError is the bus fault, returned when no device responds to the address.
+type UnmappedError struct {
+	Address isa.BusValue
+}
+
+func (e *UnmappedError) Error() string {
+	return fmt.Sprintf("no device found for address: %04X", e.Address)
+}
+
+// SetBusFaultPolicy decides what happens on accesses to the unmapped addresses. Trapping needs a device that latches
+// the faults, so the trap handler can find out what happened.
+func (sys *EasyBusSystem) SetBusFaultPolicy(policy BusFaultPolicy) error {
+	if (policy == BUS_FAULT_TRAP) && (len(sys.faultLatches) == 0) {
+		return fmt.Errorf("cannot trap the bus faults, no device latches them")
+	}
+
+	sys.busFaultPolicy = policy
+
+	return nil
+}
+
+// handleFault is called when the bus access fails to find a device, or the device refuses it. It returns whether the
+// access should go on as if a device returned 0, the error stands otherwise.
+func (sys *EasyBusSystem) handleFault(address isa.Register, write bool, err error) bool {
+	var unmapped *UnmappedError
+	var refused *device.AccessFault
+
+	if (sys.busFaultPolicy == BUS_FAULT_ABORT) || !(errors.As(err, &unmapped) || errors.As(err, &refused)) {
+		return false
+	}
+
+	if sys.verbose {
+		sys.logger.Info("[EasyBus system] Bus fault", "address", fmt.Sprintf("%04X", address), "write", write)
+	}
+
+	if sys.busFaultPolicy == BUS_FAULT_TRAP {
+		for _, latch := range sys.faultLatches {
+			latch.LatchFault(address, write)
+		}
+
+		sys.hart.trapPending = true
+	}
+
+	return true
+}
@@ -0,0 +1,345 @@
+package easybus_test
+
+import (
+	"errors"
+	"testing"
+
+	"mrav/isa"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device"
+	"mrav/system/easybus/device/busfault"
+	"mrav/system/easybus/device/exit"
+	"mrav/system/easybus/device/memory"
+	"mrav/system/easybus/easybustest"
+)
+
+const cBusFaultProgram = `
+jal r0 main
+handler: xor r7 r7 r7
+ldhi r7 0xFF
+addi r7 0xFA
+lw r8 r7
+addi r7 2
+lw r9 r7
+xor r10 r10 r10
+addi r10 1
+sw r7 r10
+addi r6 1
+reti
+main: xor r1 r1 r1
+ldhi r1 0x04
+addi r2 5
+sw r1 r2
+lw r3 r1
+addi r3 7
+forever: jal r0 forever
+`
+
+func TestBusFaultAbort(t *testing.T) {
+	sys := newPeripheralTestSystem(t, cBusFaultProgram)
+
+	_, err := sys.RunFast(100)
+
+	if err == nil {
+		t.Fatalf("expected the unmapped write to fail the simulation")
+	}
+}
+
+func TestBusFaultIgnore(t *testing.T) {
+	sys := newPeripheralTestSystem(t, cBusFaultProgram)
+
+	if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_IGNORE); err != nil {
+		t.Fatalf("cannot set the policy: %v", err)
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	regs := sys.GetCore().Registers
+
+	if (regs[3] != 7) || (regs[6] != 0) {
+		t.Fatalf("expected the unmapped read to return 0 without a trap, got r3 = %d, r6 = %d", regs[3], regs[6])
+	}
+}
+
+func TestBusFaultTrap(t *testing.T) {
+	sys := newPeripheralTestSystem(t, cBusFaultProgram)
+
+	if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_TRAP); err != nil {
+		t.Fatalf("cannot set the policy: %v", err)
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	regs := sys.GetCore().Registers
+
+	// Both faults trapped, and the handler saw the read last.
+	if (regs[6] != 2) || (regs[8] != 0x0400) || (regs[9] != 0x01) || (regs[3] != 7) {
+		t.Fatalf("unexpected registers after the traps: r3 = %d, r6 = %d, r8 = %04X, r9 = %04X", regs[3], regs[6], regs[8], regs[9])
+	}
+}
+
+func TestBusFaultTrapMatchesMultiturn(t *testing.T) {
+	multiturn := newPeripheralTestSystem(t, cBusFaultProgram)
+	fast := newPeripheralTestSystem(t, cBusFaultProgram)
+
+	for _, sys := range []*easybus.EasyBusSystem{multiturn, fast} {
+		if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_TRAP); err != nil {
+			t.Fatalf("cannot set the policy: %v", err)
+		}
+	}
+
+	for i := 0; i < 40; i++ {
+		if err := multiturn.RunInstruction(); err != nil {
+			t.Fatalf("multiturn run failed at instruction %d: %v", i, err)
+		}
+
+		if _, err := fast.RunFast(1); err != nil {
+			t.Fatalf("fast run failed at instruction %d: %v", i, err)
+		}
+
+		requireSameState(t, multiturn, fast)
+	}
+}
+
+// The word at the last byte of the memory and the reserved offset of the bus fault unit are mapped, but the devices
+// refuse them, which is a bus fault like an unmapped address.
+const cRefusedAccessProgram = `
+addi r2 9
+addi r4 9
+xor r1 r1 r1
+addi r1 252
+sw r1 r1
+lw r2 r1
+xor r3 r3 r3
+ldhi r3 0xFF
+addi r3 0xFB
+sw r3 r1
+lw r4 r3
+forever: jal r0 forever
+`
+
+func TestBusFaultIgnoreRefusedAccesses(t *testing.T) {
+	sys := newPeripheralTestSystem(t, cRefusedAccessProgram)
+
+	if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_IGNORE); err != nil {
+		t.Fatalf("cannot set the policy: %v", err)
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if regs := sys.GetCore().Registers; (regs[2] != 0) || (regs[4] != 0) {
+		t.Fatalf("expected the refused read and the reserved register to read 0, got r2 = %d, r4 = %d", regs[2], regs[4])
+	}
+}
+
+// The timer interrupt handler does an unmapped read, which traps to the same vector while the handler runs. The
+// handler tells the two apart by the bus fault status.
+const cNestedFaultProgram = `
+timer_ctr = 253
+timer_ctrl = 254
+timer_status = 255
+
+jal r0 main
+handler: xor r7 r7 r7
+ldhi r7 0xFF
+addi r7 0xFC
+lw r8 r7
+bz r8 interrupt
+xor r10 r10 r10
+addi r10 1
+sw r7 r10
+addi r6 1
+reti
+interrupt: xor r7 r7 r7
+addi r7 timer_status
+xor r8 r8 r8
+addi r8 2
+sw r7 r8
+xor r7 r7 r7
+ldhi r7 0x04
+lw r9 r7
+addi r4 1
+reti
+main: xor r1 r1 r1
+addi r1 timer_ctr
+xor r2 r2 r2
+addi r2 5
+sw r1 r2
+addi r1 1
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+ei
+count: addi r5 1
+jal r0 count
+`
+
+func TestBusFaultInInterruptHandler(t *testing.T) {
+	multiturn := newPeripheralTestSystem(t, cNestedFaultProgram)
+	fast := newPeripheralTestSystem(t, cNestedFaultProgram)
+
+	for _, sys := range []*easybus.EasyBusSystem{multiturn, fast} {
+		if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_TRAP); err != nil {
+			t.Fatalf("cannot set the policy: %v", err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := multiturn.RunInstruction(); err != nil {
+			t.Fatalf("multiturn run failed at instruction %d: %v", i, err)
+		}
+	}
+
+	easybustest.RunFast(t, fast, 100)
+	requireSameState(t, multiturn, fast)
+
+	c := fast.GetCore()
+	regs := c.Registers
+
+	// The trap returned into the interrupt handler, and the handler back to the counting loop at 003E.
+	if (regs[6] != 1) || (regs[4] != 1) || (regs[9] != 0) {
+		t.Fatalf("expected a single trap and a single return to the handler, got r4 = %d, r6 = %d, r9 = %04X", regs[4], regs[6], regs[9])
+	}
+
+	if !c.InterruptsEnabled() || (c.Pc < 0x003E) || (regs[5] < 30) {
+		t.Fatalf("expected the main loop to go on with the interrupts enabled, PC %04X, r5 = %d", c.Pc, regs[5])
+	}
+}
+
+// Tries to overwrite its own code in the ROM, then copies the address to the RAM at 0x0400.
+const cRomWriteProgram = `
+jal r0 main
+handler: xor r7 r7 r7
+ldhi r7 0xFF
+addi r7 0xFA
+lw r8 r7
+addi r7 2
+xor r10 r10 r10
+addi r10 1
+sw r7 r10
+addi r6 1
+reti
+main: xor r1 r1 r1
+addi r1 main
+xor r2 r2 r2
+sw r1 r2
+lw r3 r1
+xor r4 r4 r4
+ldhi r4 0x04
+sw r4 r1
+lw r5 r4
+forever: jal r0 forever
+`
+
+const cTestRamBase isa.Register = 0x0400
+
+func newRomTestSystem(t *testing.T, policy memory.RomWritePolicy) (*easybus.EasyBusSystem, []byte) {
+	t.Helper()
+
+	image := easybustest.Assemble(t, cRomWriteProgram)
+	rom, err := memory.NewRom(len(image), image, policy)
+
+	if err != nil {
+		t.Fatalf("cannot create the ROM: %v", err)
+	}
+
+	ram := easybustest.NewMemory(t, 0x100, nil)
+	regions := []easybus.Region{
+		easybus.MapDevice(0, rom),
+		easybus.MapDevice(cTestRamBase, ram),
+		easybus.MapDevice(exit.DEFAULT_ADDRESS, exit.NewExitDevice()),
+		easybus.MapDevice(busfault.DEFAULT_BASE, busfault.NewBusFaultUnit()),
+	}
+
+	return easybustest.NewSystem(t, easybustest.Opts(), regions...), image
+}
+
+func requireRomUnchanged(t *testing.T, sys *easybus.EasyBusSystem, image []byte) {
+	t.Helper()
+
+	regs := sys.GetCore().Registers
+	main := regs[1]
+	word := isa.Register(image[main])<<8 | isa.Register(image[main+1])
+
+	if (regs[3] != word) || (regs[5] != main) {
+		t.Fatalf("expected the ROM word %04X and the RAM to work, got r3 = %04X, r5 = %04X", word, regs[3], regs[5])
+	}
+}
+
+func TestRomWriteFaultAbort(t *testing.T) {
+	sys, _ := newRomTestSystem(t, memory.ROM_WRITE_FAULT)
+
+	_, err := sys.RunFast(100)
+	var refused *device.AccessFault
+
+	if !errors.As(err, &refused) || !refused.Write {
+		t.Fatalf("expected the ROM write to fail the simulation, got %v", err)
+	}
+}
+
+func TestRomWriteFaultTrap(t *testing.T) {
+	sys, image := newRomTestSystem(t, memory.ROM_WRITE_FAULT)
+
+	if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_TRAP); err != nil {
+		t.Fatalf("cannot set the policy: %v", err)
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	regs := sys.GetCore().Registers
+
+	if (regs[6] != 1) || (regs[8] != regs[1]) {
+		t.Fatalf("expected a single trap for the ROM write, got r6 = %d, r8 = %04X", regs[6], regs[8])
+	}
+
+	requireRomUnchanged(t, sys, image)
+}
+
+func TestRomWriteIgnore(t *testing.T) {
+	sys, image := newRomTestSystem(t, memory.ROM_WRITE_IGNORE)
+
+	if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_TRAP); err != nil {
+		t.Fatalf("cannot set the policy: %v", err)
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if regs := sys.GetCore().Registers; regs[6] != 0 {
+		t.Fatalf("expected the ignored write not to trap, got r6 = %d", regs[6])
+	}
+
+	requireRomUnchanged(t, sys, image)
+}
+
+func TestRomWriteTrapMatchesMultiturn(t *testing.T) {
+	multiturn, _ := newRomTestSystem(t, memory.ROM_WRITE_FAULT)
+	fast, _ := newRomTestSystem(t, memory.ROM_WRITE_FAULT)
+
+	for _, sys := range []*easybus.EasyBusSystem{multiturn, fast} {
+		if err := sys.SetBusFaultPolicy(easybus.BUS_FAULT_TRAP); err != nil {
+			t.Fatalf("cannot set the policy: %v", err)
+		}
+	}
+
+	for i := 0; i < 40; i++ {
+		if err := multiturn.RunInstruction(); err != nil {
+			t.Fatalf("multiturn run failed at instruction %d: %v", i, err)
+		}
+
+		if _, err := fast.RunFast(1); err != nil {
+			t.Fatalf("fast run failed at instruction %d: %v", i, err)
+		}
+
+		requireSameState(t, multiturn, fast)
+	}
+}
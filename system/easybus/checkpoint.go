@@ -0,0 +1,154 @@
+package easybus
+
+import (
+	"fmt"
+	"os"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"mrav/core"
+	"mrav/core/proto"
+)
+
+// Checkpoint captures the state of the core and all the devices, so the simulation can be resumed later with Restore.
+func (sys *EasyBusSystem) Checkpoint() (*proto.SystemState, error) {
+	devices := make([]*proto.DeviceState, 0, len(sys.devices))
+
+	for i, dev := range sys.devices {
+		devState, err := dev.Snapshot()
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot snapshot device %d (%s): %w", i, dev.Name(), err)
+		}
+
+		devices = append(devices, &proto.DeviceState{
+			Name:  dev.Name(),
+			State: devState,
+		})
+	}
+
+	secondaryHarts := make([]*proto.HartState, 0, len(sys.harts)-1)
+
+	for _, h := range sys.harts[1:] {
+		secondaryHarts = append(secondaryHarts, &proto.HartState{
+			Core:        h.core.Serialize(),
+			TrapPending: h.trapPending,
+		})
+	}
+
+	return &proto.SystemState{
+		Core:           sys.harts[0].core.Serialize(),
+		Devices:        devices,
+		Cycles:         sys.cycles,
+		TrapPending:    sys.harts[0].trapPending,
+		SecondaryHarts: secondaryHarts,
+		NextHart:       uint32(sys.nextHart),
+	}, nil
+}
+
+// Restore brings the system to the checkpointed state. The system needs to be built with the same devices, in the same
+// order, as the one that produced the checkpoint.
+func (sys *EasyBusSystem) Restore(state *proto.SystemState) error {
+	if state.Core == nil {
+		return fmt.Errorf("cannot restore the system, checkpoint has no core state")
+	}
+
+	if len(state.SecondaryHarts) != len(sys.harts)-1 {
+		return fmt.Errorf("cannot restore the system, checkpoint has %d harts, system has %d", len(state.SecondaryHarts)+1, len(sys.harts))
+	}
+
+	if int(state.NextHart) >= len(sys.harts) {
+		return fmt.Errorf("cannot restore the system, next hart %d is out of range", state.NextHart)
+	}
+
+	if len(state.Devices) != len(sys.devices) {
+		return fmt.Errorf("cannot restore the system, checkpoint has %d devices, system has %d", len(state.Devices), len(sys.devices))
+	}
+
+	for i, dev := range sys.devices {
+		if state.Devices[i].Name != dev.Name() {
+			return fmt.Errorf("cannot restore the system, device %d is '%s' in the checkpoint, but '%s' in the system", i, state.Devices[i].Name, dev.Name())
+		}
+	}
+
+	coreStates := []*proto.CoreState{state.Core}
+	trapsPending := []bool{state.TrapPending}
+
+	for _, hartState := range state.SecondaryHarts {
+		coreStates = append(coreStates, hartState.Core)
+		trapsPending = append(trapsPending, hartState.TrapPending)
+	}
+
+	restoredCores := make([]*core.Core, 0, len(sys.harts))
+
+	for id, coreState := range coreStates {
+		if coreState == nil {
+			return fmt.Errorf("cannot restore the system, checkpoint has no core state for hart %d", id)
+		}
+
+		restoredCore, err := core.Deserialize(coreState, sys.harts[id].coreOpts)
+
+		if err != nil {
+			return fmt.Errorf("cannot restore the core of hart %d: %w", id, err)
+		}
+
+		restoredCores = append(restoredCores, restoredCore)
+	}
+
+	for i, dev := range sys.devices {
+		if err := dev.Restore(state.Devices[i].State); err != nil {
+			return fmt.Errorf("cannot restore device %d (%s): %w", i, dev.Name(), err)
+		}
+	}
+
+	for id, h := range sys.harts {
+		h.core = restoredCores[id]
+		h.trapPending = trapsPending[id]
+		h.halted = false
+	}
+
+	sys.cycles = state.Cycles
+	sys.delivered = false
+	sys.nextHart = int(state.NextHart)
+	sys.halted = false
+	sys.selectHart(0)
+	sys.invalidateAllDecoded()
+
+	return nil
+}
+
+func (sys *EasyBusSystem) CheckpointToFile(filePath string) error {
+	state, err := sys.Checkpoint()
+
+	if err != nil {
+		return fmt.Errorf("cannot checkpoint the system: %w", err)
+	}
+
+	stateBytes, err := protobuf.Marshal(state)
+
+	if err != nil {
+		return fmt.Errorf("cannot checkpoint the system, proto error: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, stateBytes, 0644); err != nil {
+		return fmt.Errorf("cannot checkpoint the system, file writing error: %w", err)
+	}
+
+	return nil
+}
+
+func (sys *EasyBusSystem) RestoreFromFile(filePath string) error {
+	fileBytes, err := os.ReadFile(filePath)
+
+	if err != nil {
+		return fmt.Errorf("cannot restore the system, file read error: %w", err)
+	}
+
+	state := &proto.SystemState{}
+
+	if err := protobuf.Unmarshal(fileBytes, state); err != nil {
+		return fmt.Errorf("cannot restore the system, proto error: %w", err)
+	}
+
+	return sys.Restore(state)
+}
@@ -0,0 +1,182 @@
+package easybus_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"mrav/isa"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/easybustest"
+)
+
+// Counts in the main loop, storing the count to the memory, while the timer interrupts it every 20 cycles.
+const cInterruptProgram = `
+timer_ctr = 253
+timer_ctrl = 254
+timer_status = 255
+
+jal r0 main
+handler: addi r6 1
+xor r7 r7 r7
+addi r7 timer_status
+xor r8 r8 r8
+addi r8 2
+sw r7 r8
+xor r7 r7 r7
+addi r7 timer_ctr
+xor r8 r8 r8
+addi r8 20
+sw r7 r8
+xor r7 r7 r7
+addi r7 timer_ctrl
+xor r8 r8 r8
+addi r8 3
+sw r7 r8
+reti
+main: xor r1 r1 r1
+addi r1 timer_ctr
+xor r2 r2 r2
+addi r2 20
+sw r1 r2
+addi r1 1
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+xor r9 r9 r9
+addi r9 200
+ei
+count: addi r5 1
+sw r9 r5
+jal r0 count
+`
+
+// newTestSystem builds the system with the image in the memory and the timer.
+func newTestSystem(t testing.TB, image []byte) *easybus.EasyBusSystem {
+	t.Helper()
+
+	return newTestSystemWithWaitStates(t, image, 0)
+}
+
+func newTestSystemWithWaitStates(t testing.TB, image []byte, waitStates int) *easybus.EasyBusSystem {
+	t.Helper()
+
+	mem := easybustest.NewMemory(t, cTestMemSize, image)
+	mem.SetWaitStates(waitStates)
+
+	return easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem), easybus.MapDevice(cTestTimerBase, &timer.Timer{}))
+}
+
+func requireSameState(t *testing.T, expected *easybus.EasyBusSystem, actual *easybus.EasyBusSystem) {
+	t.Helper()
+
+	expectedState, err := expected.Checkpoint()
+
+	if err != nil {
+		t.Fatalf("cannot checkpoint the expected system: %v", err)
+	}
+
+	actualState, err := actual.Checkpoint()
+
+	if err != nil {
+		t.Fatalf("cannot checkpoint the actual system: %v", err)
+	}
+
+	if !protobuf.Equal(expectedState, actualState) {
+		t.Fatalf("systems diverged\nexpected: %v\nactual: %v", expectedState, actualState)
+	}
+}
+
+// A run resumed from a checkpoint in a fresh system ends in the same state as the uninterrupted run, with the RAM,
+// the timer and the cycles restored along with the core.
+func TestCheckpointRestoreMatchesUninterrupted(t *testing.T) {
+	image := easybustest.Assemble(t, cInterruptProgram)
+	uninterrupted := newTestSystem(t, image)
+	checkpointed := newTestSystem(t, image)
+
+	easybustest.Run(t, checkpointed, 150)
+
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.pb")
+
+	if err := checkpointed.CheckpointToFile(checkpointPath); err != nil {
+		t.Fatalf("cannot checkpoint: %v", err)
+	}
+
+	resumed := newTestSystem(t, image)
+
+	if err := resumed.RestoreFromFile(checkpointPath); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	if (resumed.Cycles() != checkpointed.Cycles()) || (resumed.GetCore().Registers != checkpointed.GetCore().Registers) {
+		t.Fatalf("expected the restored system at cycle %d with %v, got cycle %d with %v",
+			checkpointed.Cycles(), checkpointed.GetCore().Registers, resumed.Cycles(), resumed.GetCore().Registers)
+	}
+
+	easybustest.Run(t, resumed, 150)
+	easybustest.Run(t, uninterrupted, 300)
+
+	if regs := uninterrupted.GetCore().Registers; (regs[5] == 0) || (regs[6] < 2) {
+		t.Fatalf("expected the run to count and take the timer interrupts, got r5 = %d, r6 = %d", regs[5], regs[6])
+	}
+
+	requireSameState(t, uninterrupted, resumed)
+}
+
+func TestRestoreRejectsOtherDevices(t *testing.T) {
+	image := easybustest.Assemble(t, cInterruptProgram)
+	sys := newTestSystem(t, image)
+
+	state, err := sys.Checkpoint()
+
+	if err != nil {
+		t.Fatalf("cannot checkpoint: %v", err)
+	}
+
+	memOnly := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, easybustest.NewMemory(t, cTestMemSize, image)))
+
+	if err := memOnly.Restore(state); err == nil {
+		t.Fatalf("expected the checkpoint with the timer not to restore into the system without it")
+	}
+}
+
+// The secondary harts and the round-robin position are a part of the checkpoint as well.
+func TestCheckpointRestoresAllHarts(t *testing.T) {
+	resetPcs := []isa.Register{0, 0, 0}
+	uninterrupted := newMultiHartTestSystem(t, cMailboxProgram, resetPcs, easybus.ARBITRATION_ROUND_ROBIN)
+	checkpointed := newMultiHartTestSystem(t, cMailboxProgram, resetPcs, easybus.ARBITRATION_ROUND_ROBIN)
+
+	// Stops with the second hart further along than the third one, and the third one next on the bus.
+	easybustest.Run(t, checkpointed, 20)
+
+	state, err := checkpointed.Checkpoint()
+
+	if err != nil {
+		t.Fatalf("cannot checkpoint: %v", err)
+	}
+
+	if (len(state.SecondaryHarts) != 2) || (state.NextHart != 2) {
+		t.Fatalf("expected 2 secondary harts with hart 2 next, got %d with hart %d next", len(state.SecondaryHarts), state.NextHart)
+	}
+
+	resumed := newMultiHartTestSystem(t, cMailboxProgram, resetPcs, easybus.ARBITRATION_ROUND_ROBIN)
+
+	if err := resumed.Restore(state); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	requireSameState(t, checkpointed, resumed)
+
+	easybustest.Run(t, resumed, 20)
+	easybustest.Run(t, uninterrupted, 40)
+
+	requireSameState(t, uninterrupted, resumed)
+
+	twoHarts := newMultiHartTestSystem(t, cMailboxProgram, resetPcs[:2], easybus.ARBITRATION_ROUND_ROBIN)
+
+	if err := twoHarts.Restore(state); err == nil {
+		t.Fatalf("expected the checkpoint of 3 harts not to restore into the system with 2")
+	}
+}
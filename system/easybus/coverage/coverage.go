@@ -0,0 +1,335 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	"mrav/isa"
+	"mrav/software/disasm"
+	"mrav/software/symbols"
+	"mrav/system/easybus"
+)
+
+type branchCounts struct {
+	taken    int64
+	notTaken int64
+}
+
+// Collector counts the executions of every address, opcode and branch direction while the system runs.
+type Collector struct {
+	executed []int64 // Per address
+	opcodes  map[*isa.InstructionSpec]int64
+	branches map[isa.Register]*branchCounts
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		executed: make([]int64, 1<<16),
+		opcodes:  make(map[*isa.InstructionSpec]int64),
+		branches: make(map[isa.Register]*branchCounts),
+	}
+}
+
+// Profile implements easybus.Profiler.
+func (c *Collector) Profile(instr *easybus.ExecutedInstruction) {
+	spec := instr.Instruction.Spec
+
+	c.executed[instr.Pc]++
+	c.opcodes[spec]++
+
+	if spec.Semantics != isa.SEMANTICS_BRANCH {
+		return
+	}
+
+	counts, found := c.branches[instr.Pc]
+
+	if !found {
+		counts = &branchCounts{}
+		c.branches[instr.Pc] = counts
+	}
+
+	// A branch to the next instruction is counted as not taken.
+	if instr.NextPc == instr.Pc+isa.INSTRUCTION_SIZE {
+		counts.notTaken++
+	} else {
+		counts.taken++
+	}
+}
+
+// InstructionCoverage tells how many times the instruction of the program ran.
+type InstructionCoverage struct {
+	Address     isa.Register
+	Disassembly string
+	Source      *symbols.SourceLine // Nil without the source lines in the symbol map
+	Count       int64
+
+	// Only for bz and bnz.
+	Branch   bool
+	Taken    int64
+	NotTaken int64
+}
+
+type OpcodeCoverage struct {
+	Mnemonic  string
+	InProgram bool
+	Count     int64
+}
+
+// Report is the coverage of the whole program.
+type Report struct {
+	Instructions []InstructionCoverage
+	Opcodes      []OpcodeCoverage // In the order of the ISA table
+}
+
+// Report puts together the coverage of the program in the image. The instructions of the program are the ones with a
+// source line in the symbol map, or all the words of the image without it.
+func (c *Collector) Report(image []byte, syms *symbols.SymbolMap) (*Report, error) {
+	var addresses []isa.Register
+
+	if (syms != nil) && (len(syms.Lines) > 0) {
+		for _, line := range syms.Lines {
+			addresses = append(addresses, isa.Register(line.Address))
+		}
+	} else {
+		for address := 0; address+1 < len(image); address += isa.INSTRUCTION_SIZE {
+			addresses = append(addresses, isa.Register(address))
+		}
+	}
+
+	report := &Report{}
+	inProgram := make(map[*isa.InstructionSpec]bool)
+
+	for _, address := range addresses {
+		if int(address)+1 >= len(image) {
+			return nil, fmt.Errorf("instruction at %04X is outside the program image of %d bytes", address, len(image))
+		}
+
+		word := isa.Register(binary.BigEndian.Uint16(image[address:]))
+		spec, err := isa.DecodeSpec(word)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode the instruction at %04X: %w", address, err)
+		}
+
+		disassembly, err := disasm.Disassemble(word, syms)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot disassemble the instruction at %04X: %w", address, err)
+		}
+
+		inProgram[spec] = true
+
+		instrCoverage := InstructionCoverage{
+			Address:     address,
+			Disassembly: disassembly,
+			Count:       c.executed[address],
+			Branch:      spec.Semantics == isa.SEMANTICS_BRANCH,
+		}
+
+		if syms != nil {
+			if source, found := syms.SourceLineAt(address); found {
+				instrCoverage.Source = source
+			}
+		}
+
+		if counts, found := c.branches[address]; found {
+			instrCoverage.Taken = counts.taken
+			instrCoverage.NotTaken = counts.notTaken
+		}
+
+		report.Instructions = append(report.Instructions, instrCoverage)
+	}
+
+	for i := range isa.InstructionSet {
+		spec := &isa.InstructionSet[i]
+
+		report.Opcodes = append(report.Opcodes, OpcodeCoverage{
+			Mnemonic:  spec.Mnemonic,
+			InProgram: inProgram[spec],
+			Count:     c.opcodes[spec],
+		})
+	}
+
+	return report, nil
+}
+
+func percent(covered int, total int) string {
+	if total == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f%%", 100*float64(covered)/float64(total))
+}
+
+// WriteSummary writes the human-readable summary, with everything that was not covered.
+func (r *Report) WriteSummary(w io.Writer) error {
+	var buf bytes.Buffer
+	executed := 0
+	branchDirections := 0
+	branchDirectionsTaken := 0
+
+	for _, instr := range r.Instructions {
+		if instr.Count > 0 {
+			executed++
+		}
+
+		if instr.Branch {
+			branchDirections += 2
+
+			if instr.Taken > 0 {
+				branchDirectionsTaken++
+			}
+
+			if instr.NotTaken > 0 {
+				branchDirectionsTaken++
+			}
+		}
+	}
+
+	opcodesInProgram := 0
+	opcodesExecuted := 0
+
+	for _, opcode := range r.Opcodes {
+		if opcode.InProgram {
+			opcodesInProgram++
+		}
+
+		if opcode.Count > 0 {
+			opcodesExecuted++
+		}
+	}
+
+	fmt.Fprintf(&buf, "Instructions: %d of %d executed (%s)\n", executed, len(r.Instructions), percent(executed, len(r.Instructions)))
+	fmt.Fprintf(&buf, "Branches: %d of %d directions taken (%s)\n", branchDirectionsTaken, branchDirections, percent(branchDirectionsTaken, branchDirections))
+	fmt.Fprintf(&buf, "Opcodes: %d of %d in the program executed, %d of %d in the ISA\n", opcodesExecuted, opcodesInProgram, opcodesExecuted, len(r.Opcodes))
+
+	fmt.Fprintf(&buf, "\nOpcode counts:\n")
+
+	for _, opcode := range r.Opcodes {
+		note := ""
+
+		if !opcode.InProgram && (opcode.Count == 0) {
+			note = " (not in the program)"
+		}
+
+		fmt.Fprintf(&buf, "  %-6s %d%s\n", opcode.Mnemonic, opcode.Count, note)
+	}
+
+	notExecuted := slices.DeleteFunc(slices.Clone(r.Instructions), func(instr InstructionCoverage) bool {
+		return instr.Count > 0
+	})
+
+	if len(notExecuted) > 0 {
+		fmt.Fprintf(&buf, "\nNot executed:\n")
+
+		for _, instr := range notExecuted {
+			fmt.Fprintf(&buf, "  %s%04X  %s\n", describeSource(instr.Source), instr.Address, instr.Disassembly)
+		}
+	}
+
+	partialBranches := slices.DeleteFunc(slices.Clone(r.Instructions), func(instr InstructionCoverage) bool {
+		return !instr.Branch || (instr.Count == 0) || ((instr.Taken > 0) && (instr.NotTaken > 0))
+	})
+
+	if len(partialBranches) > 0 {
+		fmt.Fprintf(&buf, "\nBranches going only one way:\n")
+
+		for _, instr := range partialBranches {
+			fmt.Fprintf(&buf, "  %s%04X  %-16s taken %d, not taken %d\n", describeSource(instr.Source), instr.Address, instr.Disassembly, instr.Taken, instr.NotTaken)
+		}
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("cannot write the coverage summary: %w", err)
+	}
+
+	return nil
+}
+
+func describeSource(source *symbols.SourceLine) string {
+	if source == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d  ", source.File, source.Line)
+}
+
+// WriteLcov writes the line and branch coverage in the LCOV tracefile format, which needs the source lines.
+func (r *Report) WriteLcov(w io.Writer) error {
+	var buf bytes.Buffer
+	var files []string
+	byFile := make(map[string][]InstructionCoverage)
+
+	for _, instr := range r.Instructions {
+		if instr.Source == nil {
+			return fmt.Errorf("no source line for the instruction at %04X, LCOV needs the symbol map from the assembler", instr.Address)
+		}
+
+		if _, found := byFile[instr.Source.File]; !found {
+			files = append(files, instr.Source.File)
+		}
+
+		byFile[instr.Source.File] = append(byFile[instr.Source.File], instr)
+	}
+
+	for _, file := range files {
+		instrs := byFile[file]
+
+		slices.SortStableFunc(instrs, func(a, b InstructionCoverage) int {
+			return a.Source.Line - b.Source.Line
+		})
+
+		fmt.Fprintf(&buf, "TN:\nSF:%s\n", file)
+
+		linesHit := 0
+		branchesFound := 0
+		branchesHit := 0
+
+		for _, instr := range instrs {
+			if !instr.Branch {
+				continue
+			}
+
+			// The branch directions are unknown for the branches that never ran.
+			taken, notTaken := "-", "-"
+
+			if instr.Count > 0 {
+				taken, notTaken = fmt.Sprint(instr.Taken), fmt.Sprint(instr.NotTaken)
+			}
+
+			fmt.Fprintf(&buf, "BRDA:%d,0,0,%s\n", instr.Source.Line, taken)
+			fmt.Fprintf(&buf, "BRDA:%d,0,1,%s\n", instr.Source.Line, notTaken)
+
+			branchesFound += 2
+
+			if instr.Taken > 0 {
+				branchesHit++
+			}
+
+			if instr.NotTaken > 0 {
+				branchesHit++
+			}
+		}
+
+		fmt.Fprintf(&buf, "BRF:%d\nBRH:%d\n", branchesFound, branchesHit)
+
+		for _, instr := range instrs {
+			fmt.Fprintf(&buf, "DA:%d,%d\n", instr.Source.Line, instr.Count)
+
+			if instr.Count > 0 {
+				linesHit++
+			}
+		}
+
+		fmt.Fprintf(&buf, "LF:%d\nLH:%d\nend_of_record\n", len(instrs), linesHit)
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("cannot write the LCOV file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mrav/software/symbols"
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+// The loop branch goes both ways, the check only falls through and the error path never runs.
+const cCoverageProgram = `xor r1 r1 r1
+addi r1 3
+xor r2 r2 r2
+addi r2 1
+loop: sub r1 r1 r2
+bnz r1 loop
+bnz r1 error
+done: jal r0 done
+error: addi r3 1
+jal r0 done
+`
+
+func collect(t *testing.T) (*Report, *symbols.SymbolMap) {
+	t.Helper()
+
+	program, image := easybustest.AssembleModule(t, cCoverageProgram)
+	mem := easybustest.NewMemory(t, 256, image)
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem))
+
+	collector := NewCollector()
+	sys.SetProfiler(collector)
+
+	easybustest.RunFast(t, sys, 30)
+
+	syms := symbols.FromModule(program, []string{"test.mrav"})
+	report, err := collector.Report(image, syms)
+
+	if err != nil {
+		t.Fatalf("cannot build the report: %v", err)
+	}
+
+	return report, syms
+}
+
+func TestCoverageReport(t *testing.T) {
+	report, _ := collect(t)
+
+	if len(report.Instructions) != 10 {
+		t.Fatalf("expected 10 instructions in the report, got %d", len(report.Instructions))
+	}
+
+	loopBranch := report.Instructions[5]
+
+	if !loopBranch.Branch || (loopBranch.Taken != 2) || (loopBranch.NotTaken != 1) {
+		t.Fatalf("unexpected coverage of the loop branch: %+v", loopBranch)
+	}
+
+	errorBranch := report.Instructions[6]
+
+	if (errorBranch.Taken != 0) || (errorBranch.NotTaken != 1) {
+		t.Fatalf("unexpected coverage of the error branch: %+v", errorBranch)
+	}
+
+	if (report.Instructions[8].Count != 0) || (report.Instructions[9].Count != 0) {
+		t.Fatalf("the error path should not run")
+	}
+
+	if report.Instructions[8].Source.Line != 9 {
+		t.Fatalf("expected the error path on line 9, got %d", report.Instructions[8].Source.Line)
+	}
+}
+
+func TestCoverageLcov(t *testing.T) {
+	report, _ := collect(t)
+	var buf bytes.Buffer
+
+	if err := report.WriteLcov(&buf); err != nil {
+		t.Fatalf("cannot write the LCOV file: %v", err)
+	}
+
+	lcov := buf.String()
+
+	for _, expected := range []string{"SF:test.mrav\n", "DA:5,3\n", "DA:9,0\n", "BRDA:6,0,0,2\n", "BRDA:7,0,0,0\n", "BRF:4\nBRH:3\n", "LF:10\nLH:8\n"} {
+		if !strings.Contains(lcov, expected) {
+			t.Errorf("expected '%s' in the LCOV file:\n%s", strings.TrimSpace(expected), lcov)
+		}
+	}
+}
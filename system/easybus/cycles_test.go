@@ -0,0 +1,68 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+// The cycles of the instruction classes, after the core.sv state machine: every instruction is fetched and executed
+// in CORE_READY, and LW and SW take another cycle in CORE_LW_READ and CORE_SW_WRITE. The wait states of the memory
+// add to every bus transaction, the fetches and the data accesses.
+var cycleTests = []struct {
+	name         string
+	source       string
+	instructions int
+	waitStates   int
+	cycles       uint64
+}{
+	{name: "add", source: "add r1 r2 r3", instructions: 1, cycles: 1},
+	{name: "sub", source: "sub r1 r2 r3", instructions: 1, cycles: 1},
+	{name: "xor", source: "xor r1 r2 r3", instructions: 1, cycles: 1},
+	{name: "and", source: "and r1 r2 r3", instructions: 1, cycles: 1},
+	{name: "or", source: "or r1 r2 r3", instructions: 1, cycles: 1},
+	{name: "addi", source: "addi r1 1", instructions: 1, cycles: 1},
+	{name: "ldhi", source: "ldhi r1 1", instructions: 1, cycles: 1},
+	{name: "shl", source: "shl r1 1", instructions: 1, cycles: 1},
+	{name: "shr", source: "shr r1 1", instructions: 1, cycles: 1},
+	{name: "shra", source: "shra r1 1", instructions: 1, cycles: 1},
+	{name: "bz taken", source: "target: bz r1 target", instructions: 1, cycles: 1},
+	{name: "bnz not taken", source: "target: bnz r1 target", instructions: 1, cycles: 1},
+	{name: "jal", source: "target: jal r1 target", instructions: 1, cycles: 1},
+	{name: "jalr", source: "jalr r1 r2", instructions: 1, cycles: 1},
+	{name: "ei", source: "ei", instructions: 1, cycles: 1},
+	{name: "di", source: "di", instructions: 1, cycles: 1},
+	{name: "lw", source: "lw r1 r2", instructions: 1, cycles: 2},
+	{name: "sw", source: "sw r2 r1", instructions: 1, cycles: 2},
+	{name: "mixed", source: "xor r1 r1 r1\naddi r1 100\nsw r1 r1\nlw r2 r1\nadd r3 r2 r1", instructions: 5, cycles: 7},
+	{name: "add with wait states", source: "add r1 r2 r3", instructions: 1, waitStates: 2, cycles: 3},
+	{name: "jal with wait states", source: "target: jal r1 target", instructions: 3, waitStates: 1, cycles: 6},
+	{name: "lw with wait states", source: "lw r1 r2", instructions: 1, waitStates: 2, cycles: 6},
+	{name: "sw with wait states", source: "sw r2 r1", instructions: 1, waitStates: 3, cycles: 8},
+	{name: "data access with wait states", source: cDataAccessProgram, instructions: 4, waitStates: 2, cycles: 6 * 3},
+}
+
+// The multiturn and the fast path count the same cycles, with and without the wait states.
+func TestCycles(t *testing.T) {
+	paths := map[string]func(testing.TB, *easybus.EasyBusSystem, int){
+		"multiturn": easybustest.Run,
+		"fast":      easybustest.RunFast,
+	}
+
+	for _, tc := range cycleTests {
+		for path, run := range paths {
+			t.Run(tc.name+"/"+path, func(t *testing.T) {
+				mem := easybustest.NewMemory(t, cTestMemSize, easybustest.Assemble(t, tc.source))
+				mem.SetWaitStates(tc.waitStates)
+				sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem))
+
+				run(t, sys, tc.instructions)
+
+				if sys.Cycles() != tc.cycles {
+					t.Fatalf("expected %d cycles, got %d", tc.cycles, sys.Cycles())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package easybus
+
+import (
+	"fmt"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// ReadMemory reads the bytes through the bus devices, for debugging purposes. It does not advance the simulation, and
+// the devices implementing device.Peeker are peeked, so reading doesn't change them.
+//
+// The bus is 16 bits wide, and a word read at an address returns the byte at that address in its high byte. The
+// last byte of a device can't be the start of a word, so it's taken from the low byte of the word before it.
+func (sys *EasyBusSystem) ReadMemory(address isa.Register, length int) ([]byte, error) {
+	data := make([]byte, 0, length)
+
+	for i := 0; i < length; i++ {
+		byteAddr := address + isa.Register(i)
+		b, err := sys.readMemoryByte(byteAddr)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot read memory at %04X: %w", byteAddr, err)
+		}
+
+		data = append(data, b)
+	}
+
+	return data, nil
+}
+
+// peekBus reads the word at the offset of the device without the side effects of reading it on the bus.
+func peekBus(dev device.Device, offset isa.BusValue) (isa.BusValue, error) {
+	if peeker, ok := dev.(device.Peeker); ok {
+		return peeker.Peek(offset)
+	}
+
+	return dev.ReadBus(offset)
+}
+
+func (sys *EasyBusSystem) readMemoryByte(address isa.Register) (byte, error) {
+	dev, offset, err := sys.hitDevice(isa.BusValue(address))
+
+	if err != nil {
+		return 0, err
+	}
+
+	word, err := peekBus(dev, offset)
+
+	if err == nil {
+		return byte(word >> 8), nil
+	}
+
+	if offset == 0 {
+		return 0, err
+	}
+
+	word, prevErr := peekBus(dev, offset-1)
+
+	if prevErr != nil {
+		return 0, err
+	}
+
+	return byte(word & 0xFF), nil
+}
+
+// WriteMemory writes the bytes through the bus devices, for debugging purposes. It does not advance the simulation.
+//
+// Bytes are written one by one, as a read-modify-write of the word starting at the byte, with the read peeked like in
+// ReadMemory.
+func (sys *EasyBusSystem) WriteMemory(address isa.Register, data []byte) error {
+	for i, b := range data {
+		byteAddr := address + isa.Register(i)
+
+		if err := sys.writeMemoryByte(byteAddr, b); err != nil {
+			return fmt.Errorf("cannot write memory at %04X: %w", byteAddr, err)
+		}
+	}
+
+	return nil
+}
+
+func (sys *EasyBusSystem) writeMemoryByte(address isa.Register, b byte) error {
+	dev, offset, err := sys.hitDevice(isa.BusValue(address))
+
+	if err != nil {
+		return err
+	}
+
+	// Both words containing the byte are covered.
+	sys.invalidateDecoded(address)
+
+	word, err := peekBus(dev, offset)
+
+	if err == nil {
+		return dev.WriteBus(offset, isa.BusValue(uint16(b)<<8)|(word&0x00FF))
+	}
+
+	// Last byte of the device, same as for reading.
+	if offset == 0 {
+		return err
+	}
+
+	word, prevErr := peekBus(dev, offset-1)
+
+	if prevErr != nil {
+		return err
+	}
+
+	return dev.WriteBus(offset-1, (word&0xFF00)|isa.BusValue(b))
+}
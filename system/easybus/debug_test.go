@@ -0,0 +1,48 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/device/uart"
+	"mrav/system/easybus/easybustest"
+)
+
+func TestReadMemoryPeeksDevices(t *testing.T) {
+	u := uart.NewUart(uart.NewBufferedBackend([]byte("a"), nil), 0)
+	sys := easybustest.NewProgramSystem(t, "forever: jal r0 forever", easybus.MapDevice(uart.DEFAULT_BASE, u))
+
+	easybustest.RunFast(t, sys, 2)
+
+	if _, err := sys.ReadMemory(uart.DEFAULT_BASE, u.Size()); err != nil {
+		t.Fatalf("cannot read the UART: %v", err)
+	}
+
+	if easybustest.ReadReg(t, u, 0) != 'a' {
+		t.Fatalf("expected the byte read by the debugger to stay in the RX FIFO")
+	}
+}
+
+func TestReadMemoryKeepsTimerFlags(t *testing.T) {
+	tim := &timer.Timer{}
+	sys := easybustest.NewProgramSystem(t, "forever: jal r0 forever", easybus.MapDevice(timer.DEFAULT_BASE, tim))
+
+	// The counter matches the compare register on the first step, and reaches zero on the second.
+	easybustest.WriteReg(t, tim, 0, 2)
+	easybustest.WriteReg(t, tim, 4, 1)
+	easybustest.WriteReg(t, tim, 1, 0x01|0x02|0x10|0x40) // Start, interrupt at zero, compare and read to clear
+	easybustest.Tick(tim, 2)
+
+	if _, err := sys.ReadMemory(timer.DEFAULT_BASE, tim.Size()); err != nil {
+		t.Fatalf("cannot read the timer: %v", err)
+	}
+
+	if status := easybustest.ReadReg(t, tim, 2); (status & 0x06) != 0x06 {
+		t.Fatalf("expected the zero and match flags to stay set after the debug read, status %02X", status)
+	}
+
+	if status := easybustest.ReadReg(t, tim, 2); (status & 0x06) != 0 {
+		t.Fatalf("expected the bus read to clear the flags, status %02X", status)
+	}
+}
@@ -0,0 +1,101 @@
+package busfault
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// Right below the exit device.
+const DEFAULT_BASE isa.Register = 0xFFFA
+
+const (
+	cAddressOffset  isa.Register = 0 // Address of the last unmapped access, read-only
+	cReservedOffset isa.Register = 1 // Reads 0 and drops the writes, the registers are words at the even offsets.
+	cStatusOffset   isa.Register = 2
+
+	cStatusFault isa.Register = 0x01 // Cleared by writing 1 to it.
+	cStatusWrite isa.Register = 0x02 // The last fault was a write.
+)
+
+// BusFaultUnit latches the unmapped bus accesses when the system traps them, so the trap handler can tell a bus fault
+// from an interrupt and find the address.
+type BusFaultUnit struct {
+	address isa.Register
+	status  isa.Register
+}
+
+func NewBusFaultUnit() *BusFaultUnit {
+	return &BusFaultUnit{}
+}
+
+func (u *BusFaultUnit) Name() string {
+	return "BusFault"
+}
+
+func (u *BusFaultUnit) Size() int {
+	return int(cStatusOffset) + 1
+}
+
+func (u *BusFaultUnit) TickCycle() {} // Nothing to do
+
+func (u *BusFaultUnit) InterruptPending() bool {
+	return false // Faults are delivered as traps.
+}
+
+func (u *BusFaultUnit) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	switch isa.Register(address) {
+	case cAddressOffset:
+		return isa.BusValue(u.address), nil
+	case cReservedOffset:
+		return 0, nil
+	case cStatusOffset:
+		return isa.BusValue(u.status), nil
+	}
+
+	return 0, &device.AccessFault{Device: u.Name(), Address: address}
+}
+
+func (u *BusFaultUnit) WriteBus(address isa.BusValue, value isa.BusValue) error {
+	switch isa.Register(address) {
+	case cAddressOffset, cReservedOffset:
+		return nil // Read-only
+	case cStatusOffset:
+		if (isa.Register(value) & cStatusFault) != 0 {
+			u.status = 0
+		}
+
+		return nil
+	}
+
+	return &device.AccessFault{Device: u.Name(), Address: address, Write: true}
+}
+
+func (u *BusFaultUnit) LatchFault(address isa.Register, write bool) {
+	u.address = address
+	u.status = cStatusFault
+
+	if write {
+		u.status |= cStatusWrite
+	}
+}
+
+func (u *BusFaultUnit) Snapshot() ([]byte, error) {
+	state := make([]byte, 0, 4)
+	state = binary.BigEndian.AppendUint16(state, uint16(u.address))
+	state = binary.BigEndian.AppendUint16(state, uint16(u.status))
+	return state, nil
+}
+
+func (u *BusFaultUnit) Restore(state []byte) error {
+	if len(state) != 4 {
+		return fmt.Errorf("cannot restore %s device, expected a snapshot of 4 bytes, got %d", u.Name(), len(state))
+	}
+
+	u.address = isa.Register(binary.BigEndian.Uint16(state[0:2]))
+	u.status = isa.Register(binary.BigEndian.Uint16(state[2:4]))
+
+	return nil
+}
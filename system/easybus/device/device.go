@@ -1,13 +1,96 @@
 package device
 
 import (
+	"fmt"
+
 	"mrav/isa"
 )
 
+// Device is mapped on the bus by the system, ReadBus and WriteBus get the offsets from the base of its region.
+//
+// The devices holding files or other resources also implement io.Closer, they're closed with the system.
 type Device interface {
 	Name() string
-	Hit(address isa.BusValue) bool
+	Size() int // Number of bus addresses the device decodes
 	TickCycle()
 	ReadBus(address isa.BusValue) (isa.BusValue, error)
 	WriteBus(address isa.BusValue, value isa.BusValue) error
+	InterruptPending() bool // Level-triggered, the device keeps the line asserted until the software acknowledges it.
+
+	// Snapshot and Restore are used for checkpointing the whole system, the encoding is up to the device.
+	Snapshot() ([]byte, error)
+	Restore(state []byte) error
+}
+
+// Peeker is implemented by the devices with registers that change when they're read, like a FIFO popped by reading
+// its data register. Peek returns what ReadBus would, without the side effects, so the debuggers can look at the
+// registers without disturbing the software.
+type Peeker interface {
+	Peek(address isa.BusValue) (isa.BusValue, error)
+}
+
+// AccessFault is returned by the devices refusing an access, like a ROM refusing the writes. The system handles it as
+// a bus fault, the same as an access to an unmapped address.
+type AccessFault struct {
+	Device  string
+	Address isa.BusValue // Offset from the base of the device
+	Write   bool
+}
+
+func (f *AccessFault) Error() string {
+	access := "read"
+
+	if f.Write {
+		access = "write"
+	}
+
+	return fmt.Sprintf("device %s refused the %s at offset %04X", f.Device, access, f.Address)
+}
+
+// Cacheable is implemented by the devices whose contents only change through WriteBus and Restore, so the fast
+// simulation can keep the instructions fetched from them decoded.
+type Cacheable interface {
+	Cacheable() bool
+}
+
+// Active is implemented by the devices that can get the core out of a loop on their own, like a timer that will raise
+// an interrupt. The core spinning in place is not considered halted while any of the devices is active.
+type Active interface {
+	Active() bool
+}
+
+// Exit is implemented by the devices that let the software end the simulation. The exit code is only valid once the
+// software has requested the exit.
+type Exit interface {
+	ExitRequested() (isa.Register, bool)
+}
+
+// MasterAware is implemented by the devices that need to know which hart owns the bus. The system tells them before
+// each instruction of a multi-core system, and once when it's built.
+type MasterAware interface {
+	SetBusMaster(hartId int)
+}
+
+// Latency is implemented by the devices that take more than one clock cycle for some of the bus transactions, like a
+// memory with wait states. The transaction stays on the bus for the extra cycles, the same as with read_done or
+// write_done held low in the RTL, so the fetch stalls, and the core stays in STATE_LW_WAITING or STATE_SW_WAITING.
+type Latency interface {
+	WaitStates(address isa.BusValue, write bool) int // Extra cycles before the transaction at the offset is done
+}
+
+// FaultLatch is implemented by the devices that record the bus faults for the trap handler.
+type FaultLatch interface {
+	LatchFault(address isa.Register, write bool)
+}
+
+// Probe is an internal signal of a device, sampled on every clock cycle for the waveforms.
+type Probe struct {
+	Name  string
+	Width int // Bits
+	Value func() uint64
+}
+
+// Probed is implemented by the devices that export their internal signals, like the timer counter, to the waveforms.
+type Probed interface {
+	Probes() []Probe
 }
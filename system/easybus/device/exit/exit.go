@@ -0,0 +1,75 @@
+package exit
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"mrav/isa"
+)
+
+// Far from the memory and the timer in all the simulated systems.
+const DEFAULT_ADDRESS isa.Register = 0xFFFE
+
+// ExitDevice ends the simulation when the software writes the exit code to its only register. Zero means success.
+type ExitDevice struct {
+	requested bool
+	code      isa.Register
+}
+
+func NewExitDevice() *ExitDevice {
+	return &ExitDevice{}
+}
+
+func (e *ExitDevice) Name() string {
+	return "Exit"
+}
+
+func (e *ExitDevice) Size() int {
+	return 1
+}
+
+func (e *ExitDevice) TickCycle() {} // Nothing to do
+
+func (e *ExitDevice) InterruptPending() bool {
+	return false
+}
+
+func (e *ExitDevice) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	return isa.BusValue(e.code), nil
+}
+
+func (e *ExitDevice) WriteBus(address isa.BusValue, value isa.BusValue) error {
+	e.requested = true
+	e.code = isa.Register(value)
+
+	return nil
+}
+
+func (e *ExitDevice) ExitRequested() (isa.Register, bool) {
+	return e.code, e.requested
+}
+
+func (e *ExitDevice) Snapshot() ([]byte, error) {
+	state := make([]byte, 0, 3)
+
+	if e.requested {
+		state = append(state, 1)
+	} else {
+		state = append(state, 0)
+	}
+
+	state = binary.BigEndian.AppendUint16(state, uint16(e.code))
+
+	return state, nil
+}
+
+func (e *ExitDevice) Restore(state []byte) error {
+	if len(state) != 3 {
+		return fmt.Errorf("cannot restore %s device, expected a snapshot of 3 bytes, got %d", e.Name(), len(state))
+	}
+
+	e.requested = state[0] != 0
+	e.code = isa.Register(binary.BigEndian.Uint16(state[1:3]))
+
+	return nil
+}
@@ -0,0 +1,270 @@
+package gpio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// Between the timer and the UART.
+const DEFAULT_ADDRESS isa.Register = 0xFFF3
+
+// Change is a new value of the pins at the cycle.
+type Change struct {
+	Cycle uint64
+	Value byte
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%d 0x%02X", c.Cycle, c.Value)
+}
+
+// Gpio is the model of gpio.sv: writing the register sets the 8 output pins, and reading it returns them in the low
+// byte. The 8 input pins in the high byte only exist in the simulator, gpio.sv reads them as 0, and so does the model
+// without an input script.
+type Gpio struct {
+	output byte
+	inputs byte
+	cycle  uint64
+
+	script     []Change // Input changes, by the cycle
+	nextScript int
+
+	changes []Change  // Of the output
+	log     io.Writer // Optional, gets every output change as a line
+	logErr  error
+
+	logFile *os.File // Opened by NewGpioFromFiles, closed by Close
+}
+
+// NewGpio creates the GPIO with the scripted input changes, and the optional writer for the output changes.
+func NewGpio(script []Change, log io.Writer) (*Gpio, error) {
+	for i := 1; i < len(script); i++ {
+		if script[i].Cycle < script[i-1].Cycle {
+			return nil, fmt.Errorf("input change at cycle %d comes after the one at cycle %d", script[i].Cycle, script[i-1].Cycle)
+		}
+	}
+
+	return &Gpio{
+		script: script,
+		log:    log,
+	}, nil
+}
+
+// NewGpioFromFiles reads the input script from a file and writes the output changes to another, either of them can
+// be empty. The log file stays open until Close.
+func NewGpioFromFiles(scriptPath string, logPath string) (*Gpio, error) {
+	var script []Change
+	var log io.Writer
+	var logFile *os.File
+
+	if scriptPath != "" {
+		scriptFile, err := os.Open(scriptPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot open the GPIO input script: %w", err)
+		}
+
+		defer scriptFile.Close()
+
+		script, err = ParseScript(scriptFile)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if logPath != "" {
+		var err error
+		logFile, err = os.Create(logPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot create the GPIO log: %w", err)
+		}
+
+		log = logFile
+	}
+
+	g, err := NewGpio(script, log)
+
+	if err != nil {
+		if logFile != nil {
+			logFile.Close()
+		}
+
+		return nil, err
+	}
+
+	g.logFile = logFile
+
+	return g, nil
+}
+
+// Close closes the log file opened by NewGpioFromFiles, if any. The changes after it are only kept in memory.
+func (g *Gpio) Close() error {
+	if g.logFile == nil {
+		return nil
+	}
+
+	err := g.logFile.Close()
+	g.logFile = nil
+	g.log = nil
+
+	if err != nil {
+		return fmt.Errorf("cannot close the GPIO log: %w", err)
+	}
+
+	return nil
+}
+
+// ParseScript reads the changes, one per line as the cycle and the value, like "1000 0x01". The output log is
+// written in the same format. Empty lines and the ones starting with '#' are skipped.
+func ParseScript(r io.Reader) ([]Change, error) {
+	var script []Change
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected the cycle and the value, got '%s'", lineNumber, line)
+		}
+
+		cycle, err := strconv.ParseUint(fields[0], 0, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cycle: %w", lineNumber, err)
+		}
+
+		value, err := strconv.ParseUint(fields[1], 0, 8)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value: %w", lineNumber, err)
+		}
+
+		script = append(script, Change{Cycle: cycle, Value: byte(value)})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read the GPIO script: %w", err)
+	}
+
+	return script, nil
+}
+
+func (g *Gpio) Name() string {
+	return "Gpio"
+}
+
+func (g *Gpio) Size() int {
+	return 1
+}
+
+func (g *Gpio) InterruptPending() bool {
+	return false
+}
+
+func (g *Gpio) TickCycle() {
+	g.cycle++
+
+	for (g.nextScript < len(g.script)) && (g.script[g.nextScript].Cycle <= g.cycle) {
+		g.inputs = g.script[g.nextScript].Value
+		g.nextScript++
+	}
+}
+
+func (g *Gpio) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	return (isa.BusValue(g.inputs) << 8) | isa.BusValue(g.output), nil
+}
+
+// Reading the pins has no side effects, Peek is the same as ReadBus.
+func (g *Gpio) Peek(address isa.BusValue) (isa.BusValue, error) {
+	return g.ReadBus(address)
+}
+
+func (g *Gpio) WriteBus(address isa.BusValue, value isa.BusValue) error {
+	newOutput := byte(value)
+
+	if newOutput == g.output {
+		return nil
+	}
+
+	g.output = newOutput
+	change := Change{Cycle: g.cycle, Value: newOutput}
+	g.changes = append(g.changes, change)
+
+	if (g.log != nil) && (g.logErr == nil) {
+		_, g.logErr = fmt.Fprintln(g.log, change.String())
+	}
+
+	return nil
+}
+
+// Output returns the current value of the output pins.
+func (g *Gpio) Output() byte {
+	return g.output
+}
+
+// SetInputs drives the input pins, on top of the script.
+func (g *Gpio) SetInputs(value byte) {
+	g.inputs = value
+}
+
+// Changes returns the changes of the output pins so far, with the cycles they were written at.
+func (g *Gpio) Changes() []Change {
+	return g.changes
+}
+
+// LogErr returns the first error writing the log, the later changes are only kept in memory after it.
+func (g *Gpio) LogErr() error {
+	return g.logErr
+}
+
+// The output pins are named after the gpio.sv port.
+func (g *Gpio) Probes() []device.Probe {
+	return []device.Probe{
+		{Name: "external_output", Width: 8, Value: func() uint64 { return uint64(g.output) }},
+		{Name: "inputs", Width: 8, Value: func() uint64 { return uint64(g.inputs) }},
+	}
+}
+
+// The log of the changes is not a part of the snapshot.
+func (g *Gpio) Snapshot() ([]byte, error) {
+	state := make([]byte, 0, 14)
+	state = append(state, g.output, g.inputs)
+	state = binary.BigEndian.AppendUint64(state, g.cycle)
+	state = binary.BigEndian.AppendUint32(state, uint32(g.nextScript))
+	return state, nil
+}
+
+func (g *Gpio) Restore(state []byte) error {
+	if len(state) != 14 {
+		return fmt.Errorf("cannot restore %s device, expected a snapshot of 14 bytes, got %d", g.Name(), len(state))
+	}
+
+	g.output = state[0]
+	g.inputs = state[1]
+	g.cycle = binary.BigEndian.Uint64(state[2:10])
+	g.nextScript = int(binary.BigEndian.Uint32(state[10:14]))
+
+	if g.nextScript > len(g.script) {
+		return fmt.Errorf("cannot restore %s device, the snapshot is at input change %d of the %d in the script", g.Name(), g.nextScript, len(g.script))
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package gpio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+const cBlinkProgram = `
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xF3
+xor r5 r5 r5
+addi r5 1
+blink: xor r2 r2 r2
+addi r2 0xFF
+sw r1 r2
+jal r15 delay
+xor r2 r2 r2
+sw r1 r2
+jal r15 delay
+jal r0 blink
+delay: xor r4 r4 r4
+addi r4 10
+delay_loop: sub r4 r4 r5
+bnz r4 delay_loop
+jalr r0 r15
+`
+
+// Copies the input pins to the output pins.
+const cFollowProgram = `
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xF3
+follow: lw r2 r1
+shr r2 8
+sw r1 r2
+jal r0 follow
+`
+
+func TestBlink(t *testing.T) {
+	var log bytes.Buffer
+	g, err := NewGpio(nil, &log)
+
+	if err != nil {
+		t.Fatalf("cannot create the GPIO: %v", err)
+	}
+
+	sys := easybustest.NewProgramSystem(t, cBlinkProgram, easybus.MapDevice(DEFAULT_ADDRESS, g))
+	easybustest.RunFast(t, sys, 1000)
+	changes := g.Changes()
+
+	if len(changes) < 4 {
+		t.Fatalf("expected the LEDs to blink a few times, got %v", changes)
+	}
+
+	for i, change := range changes {
+		expected := byte(0xFF)
+
+		if i%2 == 1 {
+			expected = 0x00
+		}
+
+		if change.Value != expected {
+			t.Fatalf("expected change %d to %02X, got %02X", i, expected, change.Value)
+		}
+
+		if (i >= 2) && (change.Cycle-changes[i-2].Cycle != changes[2].Cycle-changes[0].Cycle) {
+			t.Fatalf("uneven blinking: %v", changes)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+
+	if (len(lines) != len(changes)) || (lines[0] != changes[0].String()) {
+		t.Fatalf("the log doesn't match the changes: %v vs %v", lines, changes)
+	}
+}
+
+func TestScriptedInputs(t *testing.T) {
+	script, err := ParseScript(strings.NewReader("# Press the buttons\n50 0x05\n\n100 0x0A\n"))
+
+	if err != nil {
+		t.Fatalf("cannot parse the script: %v", err)
+	}
+
+	g, err := NewGpio(script, nil)
+
+	if err != nil {
+		t.Fatalf("cannot create the GPIO: %v", err)
+	}
+
+	sys := easybustest.NewProgramSystem(t, cFollowProgram, easybus.MapDevice(DEFAULT_ADDRESS, g))
+	easybustest.RunFast(t, sys, 100)
+	changes := g.Changes()
+
+	if (len(changes) != 2) || (changes[0].Value != 0x05) || (changes[1].Value != 0x0A) {
+		t.Fatalf("expected the outputs to follow the inputs, got %v", changes)
+	}
+
+	// A round of the loop takes 6 cycles.
+	for i, cycle := range []uint64{50, 100} {
+		if (changes[i].Cycle < cycle) || (changes[i].Cycle > cycle+6) {
+			t.Fatalf("expected the change %d shortly after cycle %d, got %v", i, cycle, changes[i])
+		}
+	}
+}
+
+func TestLogFileClosed(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "gpio.log")
+	g, err := NewGpioFromFiles("", logPath)
+
+	if err != nil {
+		t.Fatalf("cannot create the GPIO: %v", err)
+	}
+
+	sys := easybustest.NewProgramSystem(t, cFollowProgram, easybus.MapDevice(DEFAULT_ADDRESS, g))
+	g.SetInputs(0x5A)
+	easybustest.RunFast(t, sys, 10)
+
+	if err := sys.Close(); err != nil {
+		t.Fatalf("cannot close the system: %v", err)
+	}
+
+	if g.logFile != nil {
+		t.Fatalf("expected the log file to be closed")
+	}
+
+	logged, err := os.ReadFile(logPath)
+
+	if err != nil {
+		t.Fatalf("cannot read the log: %v", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(string(logged)), "\n"); (len(lines) != 1) || (lines[0] != g.Changes()[0].String()) {
+		t.Fatalf("the log doesn't match the changes: %q vs %v", logged, g.Changes())
+	}
+
+	// The changes after closing are still recorded, without writing to the closed file.
+	g.SetInputs(0xA5)
+	easybustest.RunFast(t, sys, 10)
+
+	if (len(g.Changes()) != 2) || (g.LogErr() != nil) {
+		t.Fatalf("expected the change after closing without an error, got %v (%v)", g.Changes(), g.LogErr())
+	}
+}
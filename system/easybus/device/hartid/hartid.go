@@ -0,0 +1,59 @@
+package hartid
+
+import (
+	"fmt"
+
+	"mrav/isa"
+)
+
+// Right below the bus fault unit.
+const DEFAULT_ADDRESS isa.Register = 0xFFF8
+
+// HartIdDevice lets the software find out which core it runs on. Reading its only register returns the ID of the hart
+// doing the read, writes are ignored.
+type HartIdDevice struct {
+	master int
+}
+
+func NewHartIdDevice() *HartIdDevice {
+	return &HartIdDevice{}
+}
+
+func (h *HartIdDevice) Name() string {
+	return "HartId"
+}
+
+func (h *HartIdDevice) Size() int {
+	return 1
+}
+
+func (h *HartIdDevice) TickCycle() {} // Nothing to do
+
+func (h *HartIdDevice) InterruptPending() bool {
+	return false
+}
+
+func (h *HartIdDevice) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	return isa.BusValue(h.master), nil
+}
+
+func (h *HartIdDevice) WriteBus(address isa.BusValue, value isa.BusValue) error {
+	return nil
+}
+
+func (h *HartIdDevice) SetBusMaster(hartId int) {
+	h.master = hartId
+}
+
+// The bus master is set by the system before every instruction, there's nothing to save.
+func (h *HartIdDevice) Snapshot() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h *HartIdDevice) Restore(state []byte) error {
+	if len(state) != 0 {
+		return fmt.Errorf("cannot restore %s device, expected an empty snapshot, got %d bytes", h.Name(), len(state))
+	}
+
+	return nil
+}
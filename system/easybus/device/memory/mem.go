@@ -4,10 +4,12 @@ import (
 	"fmt"
 
 	"mrav/isa"
+	"mrav/system/easybus/device"
 )
 
 type Mem struct {
-	ram []byte
+	ram        []byte
+	waitStates int
 }
 
 func NewMem(size int, image []byte) (*Mem, error) {
@@ -32,13 +34,32 @@ func (m *Mem) Name() string {
 
 func (m *Mem) TickCycle() {} // Nothing to do
 
-func (m *Mem) Hit(address isa.BusValue) bool {
-	return address < isa.BusValue(len(m.ram))
+func (m *Mem) InterruptPending() bool {
+	return false
 }
 
+func (m *Mem) Cacheable() bool {
+	return true
+}
+
+// SetWaitStates makes every read and write take the extra cycles, like a slow memory on the RTL bus.
+func (m *Mem) SetWaitStates(cycles int) {
+	m.waitStates = cycles
+}
+
+func (m *Mem) WaitStates(address isa.BusValue, write bool) int {
+	return m.waitStates
+}
+
+func (m *Mem) Size() int {
+	return len(m.ram)
+}
+
+// ReadBus and WriteBus refuse the word at the last byte, it would go past the end of the memory. The system handles
+// it like an access to an unmapped address, so with the bus faults ignored it reads 0 like on the RTL bus.
 func (m *Mem) ReadBus(address isa.BusValue) (isa.BusValue, error) {
 	if address >= isa.BusValue(len(m.ram)-1) {
-		return 0, fmt.Errorf("%s device address %X out of bounds", m.Name(), address)
+		return 0, &device.AccessFault{Device: m.Name(), Address: address}
 	}
 
 	hiByte := m.ram[address]
@@ -49,7 +70,7 @@ func (m *Mem) ReadBus(address isa.BusValue) (isa.BusValue, error) {
 
 func (m *Mem) WriteBus(address isa.BusValue, value isa.BusValue) error {
 	if address >= isa.BusValue(len(m.ram)-1) {
-		return fmt.Errorf("%s device address %X out of bounds", m.Name(), address)
+		return &device.AccessFault{Device: m.Name(), Address: address, Write: true}
 	}
 
 	hiByte := byte((value >> 8) & 0xFF)
@@ -61,6 +82,20 @@ func (m *Mem) WriteBus(address isa.BusValue, value isa.BusValue) error {
 	return nil
 }
 
+func (m *Mem) Snapshot() ([]byte, error) {
+	return m.GetMemoryBytes(), nil
+}
+
+func (m *Mem) Restore(state []byte) error {
+	if len(state) != len(m.ram) {
+		return fmt.Errorf("cannot restore %s device of %d bytes from a snapshot of %d bytes", m.Name(), len(m.ram), len(state))
+	}
+
+	copy(m.ram, state)
+
+	return nil
+}
+
 func (m *Mem) GetMemoryBytes() []byte {
 	memCopy := make([]byte, len(m.ram))
 	copy(memCopy, m.ram)
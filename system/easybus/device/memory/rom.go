@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+type RomWritePolicy int
+
+const (
+	ROM_WRITE_FAULT  RomWritePolicy = iota // A bus fault, handled by the bus fault policy of the system
+	ROM_WRITE_IGNORE                       // The writes are dropped
+)
+
+var romWritePolicyNames = map[string]RomWritePolicy{
+	"fault":  ROM_WRITE_FAULT,
+	"ignore": ROM_WRITE_IGNORE,
+}
+
+func ParseRomWritePolicy(name string) (RomWritePolicy, error) {
+	policy, found := romWritePolicyNames[strings.ToLower(name)]
+
+	if !found {
+		names := make([]string, 0, len(romWritePolicyNames))
+
+		for policyName := range romWritePolicyNames {
+			names = append(names, policyName)
+		}
+
+		slices.Sort(names)
+
+		return 0, fmt.Errorf("unknown ROM write policy '%s', expected one of: %s", name, strings.Join(names, ", "))
+	}
+
+	return policy, nil
+}
+
+// Rom is a memory with the contents fixed to the image, like a boot ROM.
+type Rom struct {
+	contents *Mem
+	policy   RomWritePolicy
+}
+
+func NewRom(size int, image []byte, policy RomWritePolicy) (*Rom, error) {
+	contents, err := NewMem(size, image)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the ROM: %w", err)
+	}
+
+	return &Rom{
+		contents: contents,
+		policy:   policy,
+	}, nil
+}
+
+func (r *Rom) Name() string {
+	return "Rom"
+}
+
+func (r *Rom) TickCycle() {} // Nothing to do
+
+func (r *Rom) InterruptPending() bool {
+	return false
+}
+
+func (r *Rom) Cacheable() bool {
+	return true
+}
+
+// SetWaitStates makes every access take the extra cycles, like a slow flash.
+func (r *Rom) SetWaitStates(cycles int) {
+	r.contents.SetWaitStates(cycles)
+}
+
+func (r *Rom) WaitStates(address isa.BusValue, write bool) int {
+	return r.contents.WaitStates(address, write)
+}
+
+func (r *Rom) Size() int {
+	return r.contents.Size()
+}
+
+func (r *Rom) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	if address >= isa.BusValue(r.Size()-1) {
+		return 0, &device.AccessFault{Device: r.Name(), Address: address}
+	}
+
+	return r.contents.ReadBus(address)
+}
+
+func (r *Rom) WriteBus(address isa.BusValue, value isa.BusValue) error {
+	if r.policy == ROM_WRITE_IGNORE {
+		return nil
+	}
+
+	return &device.AccessFault{Device: r.Name(), Address: address, Write: true}
+}
+
+// The contents never change, so there's nothing to snapshot.
+func (r *Rom) Snapshot() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (r *Rom) Restore(state []byte) error {
+	if len(state) != 0 {
+		return fmt.Errorf("cannot restore %s device, expected an empty snapshot, got %d bytes", r.Name(), len(state))
+	}
+
+	return nil
+}
+
+func (r *Rom) GetMemoryBytes() []byte {
+	return r.contents.GetMemoryBytes()
+}
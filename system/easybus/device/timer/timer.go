@@ -1,43 +1,103 @@
 package timer
 
 import (
+	"encoding/binary"
 	"fmt"
 	"mrav/isa"
+	"mrav/system/easybus/device"
 )
 
+// Timer counts down from the value written to the counter, one step every prescaler + 1 cycles, and can raise the
+// interrupt when it reaches zero or matches the compare register. The registers, by their offsets from the base:
+//
+//   - 0, counter: the current value, writing it sets where the count starts from
+//   - 1, control: bit 0 starts the timer, bit 1 enables the interrupt at zero, bit 2 stops the timer, keeping the
+//     counter, bit 3 reloads the counter at zero for the periodic mode, bit 4 enables the compare, bit 5 enables the
+//     interrupt on a match, and bit 6 makes reading the status clear its flags. The start and stop bits read as 0,
+//     and writing the control without the start bit doesn't stop a running timer.
+//   - 2, status: bit 0 while the timer runs, bit 1 once it reached zero with the interrupt at zero enabled, bit 2 once
+//     the counter matched the compare register. The flags are cleared by writing 1 to them, or by reading the status
+//     on the bus with bit 6 of the control set. Peeking at it, like the debuggers do, keeps them.
+//   - 3, reload: where the count starts again in the periodic mode, so the period in steps, 0 stops the timer at zero
+//   - 4, compare: the value the counter is compared to after every step, like for the duty cycle of a PWM
+//   - 5, prescaler: the counter steps every prescaler + 1 cycles
 type Timer struct {
-	status  isa.Register
-	counter isa.Register
+	status    isa.Register
+	control   isa.Register
+	counter   isa.Register
+	reload    isa.Register
+	compare   isa.Register
+	prescaler isa.Register
+
+	prescaleCount isa.Register // Cycles since the last step
 }
 
 func (t *Timer) Name() string {
 	return "Timer"
 }
 
-const (
-	cAddressLo isa.Register = 253
-	cAddressHi isa.Register = 255
+// Below the GPIO and the UART, clear of the memory in all the simulated systems.
+const DEFAULT_BASE isa.Register = 0xFFE8
 
-	cCounterReg isa.Register = 253
-	cControlReg isa.Register = 254
-	cStatusReg  isa.Register = 255
+// Register offsets from the base.
+const (
+	cCounterReg   isa.Register = 0
+	cControlReg   isa.Register = 1
+	cStatusReg    isa.Register = 2
+	cReloadReg    isa.Register = 3
+	cCompareReg   isa.Register = 4
+	cPrescalerReg isa.Register = 5
+
+	cControlStart           isa.Register = 0x01
+	cControlInterruptEnable isa.Register = 0x02 // At zero
+	cControlStop            isa.Register = 0x04
+	cControlAutoReload      isa.Register = 0x08
+	cControlCompareEnable   isa.Register = 0x10
+	cControlMatchInterrupt  isa.Register = 0x20
+	cControlReadClear       isa.Register = 0x40
+
+	// Bits that are kept in the control register, the start and stop bits are commands.
+	cControlSettings = cControlInterruptEnable | cControlAutoReload | cControlCompareEnable | cControlMatchInterrupt | cControlReadClear
+
+	cStatusRunning          isa.Register = 0x01
+	cStatusInterruptPending isa.Register = 0x02 // Cleared by writing 1 to it.
+	cStatusMatch            isa.Register = 0x04 // Cleared by writing 1 to it.
+
+	cStatusFlags = cStatusInterruptPending | cStatusMatch
 )
 
-func (t *Timer) Hit(address isa.BusValue) bool {
-	return (isa.Register(address) >= cAddressLo) && (isa.Register(address) <= cAddressHi)
+func (t *Timer) Size() int {
+	return int(cPrescalerReg) + 1
 }
 
 func (t *Timer) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	value, err := t.Peek(address)
+
+	if (err == nil) && (isa.Register(address) == cStatusReg) && ((t.control & cControlReadClear) != 0) {
+		t.status &= ^cStatusFlags
+	}
+
+	return value, err
+}
+
+// Peek reads the status without clearing its flags, even with the bit 6 of the control set.
+func (t *Timer) Peek(address isa.BusValue) (isa.BusValue, error) {
 	switch isa.Register(address) {
 	case cCounterReg:
 		return isa.BusValue(t.counter), nil
 	case cControlReg:
-		return isa.BusValue(0x0000), nil
+		return isa.BusValue(t.control), nil
 	case cStatusReg:
 		return isa.BusValue(t.status), nil
+	case cReloadReg:
+		return isa.BusValue(t.reload), nil
+	case cCompareReg:
+		return isa.BusValue(t.compare), nil
+	case cPrescalerReg:
+		return isa.BusValue(t.prescaler), nil
 	}
 
-	return 0, fmt.Errorf("device %s, reading, address out of bounds: %04X", t.Name(), address)
+	return 0, &device.AccessFault{Device: t.Name(), Address: address}
 }
 
 func (t *Timer) WriteBus(address isa.BusValue, value isa.BusValue) error {
@@ -46,35 +106,124 @@ func (t *Timer) WriteBus(address isa.BusValue, value isa.BusValue) error {
 		t.counter = isa.Register(value)
 		return nil
 	case cControlReg:
-		startRunning := value & 0x01
+		command := isa.Register(value)
+		t.control = command & cControlSettings
+
+		if (command & cControlStop) != 0 {
+			t.status &= ^cStatusRunning
+			return nil
+		}
 
-		if startRunning == 1 {
-			if (t.status & 0x01) == 1 {
+		if (command & cControlStart) != 0 {
+			if (t.status & cStatusRunning) != 0 {
 				// Timer is running already, nothing to do.
 				return nil
 			}
 
-			t.status |= 0x01
+			t.status |= cStatusRunning
+			t.prescaleCount = 0
 			return nil
 		}
 
-		// Other bits don't matter.
+		// Without the start or the stop bit, only the settings matter.
 		return nil
 	case cStatusReg:
-		return nil // Do nothing
+		t.status &= ^(isa.Register(value) & cStatusFlags)
+		return nil
+	case cReloadReg:
+		t.reload = isa.Register(value)
+		return nil
+	case cCompareReg:
+		t.compare = isa.Register(value)
+		return nil
+	case cPrescalerReg:
+		t.prescaler = isa.Register(value)
+		t.prescaleCount = 0
+		return nil
 	}
 
-	return fmt.Errorf("device %s, writing, address out of bounds: %04X", t.Name(), address)
+	return &device.AccessFault{Device: t.Name(), Address: address, Write: true}
 }
 
 func (t *Timer) TickCycle() {
-	if (t.status & 0x01) == 0 {
+	if (t.status & cStatusRunning) == 0 {
 		return // Not running
 	}
 
+	if t.prescaleCount < t.prescaler {
+		t.prescaleCount++
+		return
+	}
+
+	t.prescaleCount = 0
 	t.counter--
 
-	if t.counter == 0 {
-		t.status &= ^isa.Register(0x01) // Flip the bit
+	if ((t.control & cControlCompareEnable) != 0) && (t.counter == t.compare) {
+		t.status |= cStatusMatch
+	}
+
+	if t.counter != 0 {
+		return
 	}
+
+	if (t.control & cControlInterruptEnable) != 0 {
+		t.status |= cStatusInterruptPending
+	}
+
+	if ((t.control & cControlAutoReload) != 0) && (t.reload != 0) {
+		t.counter = t.reload
+		return
+	}
+
+	t.status &= ^cStatusRunning // Flip the bit
+}
+
+func (t *Timer) InterruptPending() bool {
+	if (t.status & cStatusInterruptPending) != 0 {
+		return true
+	}
+
+	return ((t.status & cStatusMatch) != 0) && ((t.control & cControlMatchInterrupt) != 0)
+}
+
+// The timer can only get the core out of a loop with an interrupt.
+func (t *Timer) Active() bool {
+	running := (t.status & cStatusRunning) != 0
+	interruptEnabled := (t.control & cControlInterruptEnable) != 0
+	matchInterruptEnabled := (t.control & (cControlCompareEnable | cControlMatchInterrupt)) == (cControlCompareEnable | cControlMatchInterrupt)
+
+	return (running && (interruptEnabled || matchInterruptEnabled)) || t.InterruptPending()
+}
+
+func (t *Timer) Probes() []device.Probe {
+	return []device.Probe{
+		{Name: "counter", Width: 16, Value: func() uint64 { return uint64(t.counter) }},
+		{Name: "control", Width: 16, Value: func() uint64 { return uint64(t.control) }},
+		{Name: "status", Width: 16, Value: func() uint64 { return uint64(t.status) }},
+		{Name: "prescale_count", Width: 16, Value: func() uint64 { return uint64(t.prescaleCount) }},
+	}
+}
+
+func (t *Timer) Snapshot() ([]byte, error) {
+	state := make([]byte, 0, 14)
+
+	for _, reg := range []isa.Register{t.counter, t.control, t.status, t.reload, t.compare, t.prescaler, t.prescaleCount} {
+		state = binary.BigEndian.AppendUint16(state, uint16(reg))
+	}
+
+	return state, nil
+}
+
+func (t *Timer) Restore(state []byte) error {
+	if len(state) != 14 {
+		return fmt.Errorf("cannot restore %s device, expected a snapshot of 14 bytes, got %d", t.Name(), len(state))
+	}
+
+	regs := []*isa.Register{&t.counter, &t.control, &t.status, &t.reload, &t.compare, &t.prescaler, &t.prescaleCount}
+
+	for i, reg := range regs {
+		*reg = isa.Register(binary.BigEndian.Uint16(state[2*i : 2*i+2]))
+	}
+
+	return nil
 }
@@ -0,0 +1,167 @@
+package timer
+
+import (
+	"bytes"
+	"testing"
+
+	"mrav/system/easybus/easybustest"
+)
+
+func TestOneShot(t *testing.T) {
+	timer := &Timer{}
+	easybustest.WriteReg(t, timer, cCounterReg, 5)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStart|cControlInterruptEnable)
+	easybustest.Tick(timer, 4)
+
+	if timer.InterruptPending() || (easybustest.ReadReg(t, timer, cCounterReg) != 1) {
+		t.Fatalf("expected the counter at 1 without an interrupt")
+	}
+
+	easybustest.Tick(timer, 1)
+
+	if !timer.InterruptPending() || (easybustest.ReadReg(t, timer, cStatusReg) != cStatusInterruptPending) {
+		t.Fatalf("expected the timer stopped at zero with the interrupt, status %02X", easybustest.ReadReg(t, timer, cStatusReg))
+	}
+
+	easybustest.WriteReg(t, timer, cStatusReg, cStatusInterruptPending)
+
+	if timer.InterruptPending() {
+		t.Fatalf("expected writing 1 to clear the interrupt")
+	}
+}
+
+func TestPrescaler(t *testing.T) {
+	timer := &Timer{}
+	easybustest.WriteReg(t, timer, cPrescalerReg, 3)
+	easybustest.WriteReg(t, timer, cCounterReg, 10)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStart)
+
+	// A step every 4 cycles.
+	easybustest.Tick(timer, 4*3+3)
+
+	if got := easybustest.ReadReg(t, timer, cCounterReg); got != 10-3 {
+		t.Fatalf("expected the counter at %d, got %d", 10-3, got)
+	}
+
+	easybustest.Tick(timer, 1)
+
+	if got := easybustest.ReadReg(t, timer, cCounterReg); got != 10-4 {
+		t.Fatalf("expected the counter at %d, got %d", 10-4, got)
+	}
+}
+
+func TestAutoReload(t *testing.T) {
+	timer := &Timer{}
+	easybustest.WriteReg(t, timer, cReloadReg, 4)
+	easybustest.WriteReg(t, timer, cCounterReg, 4)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStart|cControlInterruptEnable|cControlAutoReload)
+
+	for period := 0; period < 3; period++ {
+		easybustest.Tick(timer, 4)
+
+		status := easybustest.ReadReg(t, timer, cStatusReg)
+
+		if (status != cStatusRunning|cStatusInterruptPending) || (easybustest.ReadReg(t, timer, cCounterReg) != 4) {
+			t.Fatalf("expected the counter reloaded and still running after period %d, status %02X", period, status)
+		}
+
+		easybustest.WriteReg(t, timer, cStatusReg, cStatusInterruptPending)
+	}
+
+	// The stop bit keeps the counter.
+	easybustest.Tick(timer, 1)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStop|cControlAutoReload)
+	easybustest.Tick(timer, 10)
+
+	if (easybustest.ReadReg(t, timer, cStatusReg) != 0) || (easybustest.ReadReg(t, timer, cCounterReg) != 3) {
+		t.Fatalf("expected the timer stopped at 3")
+	}
+
+	if easybustest.ReadReg(t, timer, cControlReg) != cControlAutoReload {
+		t.Fatalf("expected the start and stop bits not to stick in the control")
+	}
+}
+
+func TestCompareMatch(t *testing.T) {
+	timer := &Timer{}
+	easybustest.WriteReg(t, timer, cReloadReg, 10)
+	easybustest.WriteReg(t, timer, cCounterReg, 10)
+	easybustest.WriteReg(t, timer, cCompareReg, 7)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStart|cControlAutoReload|cControlCompareEnable)
+	easybustest.Tick(timer, 3)
+
+	if (easybustest.ReadReg(t, timer, cStatusReg) & cStatusMatch) == 0 {
+		t.Fatalf("expected the match flag at the compare value")
+	}
+
+	if timer.InterruptPending() {
+		t.Fatalf("expected no interrupt without the match interrupt enabled")
+	}
+
+	easybustest.WriteReg(t, timer, cControlReg, cControlAutoReload|cControlCompareEnable|cControlMatchInterrupt)
+
+	if !timer.InterruptPending() {
+		t.Fatalf("expected the pending match to raise the interrupt once enabled")
+	}
+
+	easybustest.WriteReg(t, timer, cStatusReg, cStatusMatch)
+
+	if timer.InterruptPending() {
+		t.Fatalf("expected writing 1 to clear the match")
+	}
+
+	// Matches again in the next period.
+	easybustest.Tick(timer, 10)
+
+	if !timer.InterruptPending() {
+		t.Fatalf("expected the match in the next period")
+	}
+}
+
+func TestReadClear(t *testing.T) {
+	timer := &Timer{}
+	easybustest.WriteReg(t, timer, cCounterReg, 2)
+	easybustest.WriteReg(t, timer, cCompareReg, 1)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStart|cControlInterruptEnable|cControlCompareEnable|cControlReadClear)
+	easybustest.Tick(timer, 2)
+
+	if status := easybustest.ReadReg(t, timer, cStatusReg); status != cStatusInterruptPending|cStatusMatch {
+		t.Fatalf("expected both flags, got %02X", status)
+	}
+
+	if status := easybustest.ReadReg(t, timer, cStatusReg); status != 0 {
+		t.Fatalf("expected the read to clear the flags, got %02X", status)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	timer := &Timer{}
+	easybustest.WriteReg(t, timer, cPrescalerReg, 2)
+	easybustest.WriteReg(t, timer, cReloadReg, 9)
+	easybustest.WriteReg(t, timer, cCompareReg, 4)
+	easybustest.WriteReg(t, timer, cCounterReg, 9)
+	easybustest.WriteReg(t, timer, cControlReg, cControlStart|cControlAutoReload|cControlCompareEnable)
+	easybustest.Tick(timer, 17)
+
+	state, err := timer.Snapshot()
+
+	if err != nil {
+		t.Fatalf("cannot snapshot: %v", err)
+	}
+
+	restored := &Timer{}
+
+	if err := restored.Restore(state); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	easybustest.Tick(timer, 5)
+	easybustest.Tick(restored, 5)
+
+	original, _ := timer.Snapshot()
+	restoredState, _ := restored.Snapshot()
+
+	if !bytes.Equal(original, restoredState) {
+		t.Fatalf("restored timer diverged: %v vs %v", original, restoredState)
+	}
+}
@@ -0,0 +1,215 @@
+package uart
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Backend is the other end of the serial line. Receive is called on every cycle, so it can't block.
+type Backend interface {
+	Transmit(b byte)
+	Receive() (byte, bool)
+	InputDone() bool // No more bytes will be received
+}
+
+// BufferedBackend receives the input given up front, so the simulation is repeatable.
+type BufferedBackend struct {
+	input  []byte
+	output io.Writer
+	err    error
+
+	outputFile *os.File // Created by NewFileBackend, closed by Close
+}
+
+// NewBufferedBackend receives the input and sends the output to the writer, which can be nil to drop it.
+func NewBufferedBackend(input []byte, output io.Writer) *BufferedBackend {
+	return &BufferedBackend{
+		input:  input,
+		output: output,
+	}
+}
+
+// NewFileBackend receives the contents of the input file and writes the output file, either of them can be empty.
+// The output file stays open until Close.
+func NewFileBackend(inputPath string, outputPath string) (*BufferedBackend, error) {
+	var input []byte
+	var outputFile *os.File
+
+	if inputPath != "" {
+		data, err := os.ReadFile(inputPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the UART input: %w", err)
+		}
+
+		input = data
+	}
+
+	if outputPath == "" {
+		return NewBufferedBackend(input, nil), nil
+	}
+
+	outputFile, err := os.Create(outputPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the UART output: %w", err)
+	}
+
+	bb := NewBufferedBackend(input, outputFile)
+	bb.outputFile = outputFile
+
+	return bb, nil
+}
+
+// Close closes the output file created by NewFileBackend, if any. The bytes sent after it are dropped.
+func (bb *BufferedBackend) Close() error {
+	if bb.outputFile == nil {
+		return nil
+	}
+
+	err := bb.outputFile.Close()
+	bb.outputFile = nil
+	bb.output = nil
+
+	if err != nil {
+		return fmt.Errorf("cannot close the UART output: %w", err)
+	}
+
+	return nil
+}
+
+func (bb *BufferedBackend) Transmit(b byte) {
+	if (bb.output == nil) || (bb.err != nil) {
+		return
+	}
+
+	_, bb.err = bb.output.Write([]byte{b})
+}
+
+func (bb *BufferedBackend) Receive() (byte, bool) {
+	if len(bb.input) == 0 {
+		return 0, false
+	}
+
+	b := bb.input[0]
+	bb.input = bb.input[1:]
+
+	return b, true
+}
+
+func (bb *BufferedBackend) InputDone() bool {
+	return len(bb.input) == 0
+}
+
+// Err returns the first error writing the output, the later bytes are dropped after it.
+func (bb *BufferedBackend) Err() error {
+	return bb.err
+}
+
+// StreamBackend receives from a reader as the bytes come in, like from a terminal, so it depends on the timing of
+// the input.
+type StreamBackend struct {
+	input  chan byte
+	done   bool
+	output io.Writer
+	err    error
+}
+
+// NewStreamBackend reads the input in the background, the reader can be nil for no input.
+func NewStreamBackend(input io.Reader, output io.Writer) *StreamBackend {
+	sb := &StreamBackend{
+		input:  make(chan byte, FIFO_DEPTH),
+		output: output,
+	}
+
+	if input == nil {
+		close(sb.input)
+		return sb
+	}
+
+	go func() {
+		defer close(sb.input)
+
+		reader := bufio.NewReader(input)
+
+		for {
+			b, err := reader.ReadByte()
+
+			if err != nil {
+				return
+			}
+
+			sb.input <- b
+		}
+	}()
+
+	return sb
+}
+
+func NewStdioBackend() *StreamBackend {
+	return NewStreamBackend(os.Stdin, os.Stdout)
+}
+
+func (sb *StreamBackend) Transmit(b byte) {
+	if (sb.output == nil) || (sb.err != nil) {
+		return
+	}
+
+	_, sb.err = sb.output.Write([]byte{b})
+}
+
+func (sb *StreamBackend) Receive() (byte, bool) {
+	if sb.done {
+		return 0, false
+	}
+
+	select {
+	case b, open := <-sb.input:
+		if !open {
+			sb.done = true
+			return 0, false
+		}
+
+		return b, true
+	default:
+		return 0, false
+	}
+}
+
+func (sb *StreamBackend) InputDone() bool {
+	return sb.done
+}
+
+func (sb *StreamBackend) Err() error {
+	return sb.err
+}
+
+// OpenBackend sets up the backend of the kind: none, stdio, pty or file. The paths are only used for the files.
+func OpenBackend(kind string, inputPath string, outputPath string) (Backend, error) {
+	switch kind {
+	case "none":
+		return NewBufferedBackend(nil, nil), nil
+	case "stdio":
+		return NewStdioBackend(), nil
+	case "pty":
+		pty, err := NewPtyBackend()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return pty, nil
+	case "file":
+		files, err := NewFileBackend(inputPath, outputPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return files, nil
+	}
+
+	return nil, fmt.Errorf("unknown UART backend '%s', expected none, stdio, pty or file", kind)
+}
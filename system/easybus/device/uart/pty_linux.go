@@ -0,0 +1,97 @@
+package uart
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// PtyBackend is a pseudo-terminal a terminal program like 'screen' can connect to.
+type PtyBackend struct {
+	*StreamBackend
+
+	Path string // Of the terminal side
+
+	master *os.File
+	slave  *os.File // Kept open, so reading the master doesn't fail before a terminal is connected
+}
+
+func NewPtyBackend() (*PtyBackend, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot open a pseudo-terminal: %w", err)
+	}
+
+	unlock := int32(0)
+
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("cannot unlock the pseudo-terminal: %w", err)
+	}
+
+	var number uint32
+
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&number)); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("cannot find the pseudo-terminal: %w", err)
+	}
+
+	path := fmt.Sprintf("/dev/pts/%d", number)
+	slave, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("cannot open the terminal side of the pseudo-terminal: %w", err)
+	}
+
+	if err := makeRaw(slave); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, err
+	}
+
+	return &PtyBackend{
+		StreamBackend: NewStreamBackend(master, master),
+		Path:          path,
+		master:        master,
+		slave:         slave,
+	}, nil
+}
+
+// makeRaw passes the bytes through unchanged, without the echo and the line editing.
+func makeRaw(f *os.File) error {
+	var termios syscall.Termios
+
+	if err := ioctl(f, syscall.TCGETS, unsafe.Pointer(&termios)); err != nil {
+		return fmt.Errorf("cannot get the terminal attributes: %w", err)
+	}
+
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+
+	if err := ioctl(f, syscall.TCSETS, unsafe.Pointer(&termios)); err != nil {
+		return fmt.Errorf("cannot set the terminal attributes: %w", err)
+	}
+
+	return nil
+}
+
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func (pb *PtyBackend) Close() error {
+	pb.slave.Close()
+	return pb.master.Close()
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package uart
+
+import (
+	"fmt"
+)
+
+type PtyBackend struct {
+	*StreamBackend
+
+	Path string
+}
+
+func NewPtyBackend() (*PtyBackend, error) {
+	return nil, fmt.Errorf("pseudo-terminals are only supported on Linux")
+}
+
+func (pb *PtyBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,307 @@
+package uart
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// Between the timer and the hart ID device.
+const DEFAULT_BASE isa.Register = 0xFFF4
+
+const FIFO_DEPTH = 16
+
+// Register offsets from the base.
+const (
+	cDataReg    isa.Register = 0 // Write to send a byte, read to take the oldest received byte (0 if there's none)
+	cStatusReg  isa.Register = 1
+	cControlReg isa.Register = 2
+	cDividerReg isa.Register = 3 // Clock cycles per bit, 0 sends and receives in a single cycle
+
+	cStatusRxReady   isa.Register = 0x01 // The RX FIFO has data
+	cStatusTxFull    isa.Register = 0x02
+	cStatusTxEmpty   isa.Register = 0x04 // The TX FIFO is empty and the last byte is out
+	cStatusRxOverrun isa.Register = 0x08 // A received byte was dropped, cleared by writing 1 to it
+	cStatusTxOverrun isa.Register = 0x10 // A byte written to the full TX FIFO was dropped, cleared by writing 1 to it
+
+	cControlRxInterrupt isa.Register = 0x01 // Interrupt while the RX FIFO has data
+	cControlTxInterrupt isa.Register = 0x02 // Interrupt while the TX FIFO is empty and the last byte is out
+
+	// Start bit, 8 data bits and a stop bit.
+	cBitsPerFrame = 10
+)
+
+// Uart sends and receives bytes through the backend, at the pace set by the divider.
+type Uart struct {
+	backend Backend
+
+	control isa.Register
+	status  isa.Register // Only the overrun flags, the rest is computed
+	divider isa.Register
+
+	txFifo      []byte
+	txShifting  bool
+	txByte      byte
+	txCountdown int
+
+	rxFifo      []byte
+	rxShifting  bool
+	rxByte      byte
+	rxCountdown int
+}
+
+func NewUart(backend Backend, divider isa.Register) *Uart {
+	return &Uart{
+		backend: backend,
+		divider: divider,
+	}
+}
+
+// Close closes the backend if it holds files or a pseudo-terminal. The standard input and output are left open.
+func (u *Uart) Close() error {
+	if closer, ok := u.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// DividerFor returns the divider for the baud rate at the clock frequency.
+func DividerFor(clockHz uint64, baud uint64) isa.Register {
+	return isa.Register(clockHz / baud)
+}
+
+func (u *Uart) Name() string {
+	return "Uart"
+}
+
+func (u *Uart) Size() int {
+	return int(cDividerReg) + 1
+}
+
+func (u *Uart) frameCycles() int {
+	return cBitsPerFrame * int(u.divider)
+}
+
+func (u *Uart) statusValue() isa.Register {
+	status := u.status
+
+	if len(u.rxFifo) > 0 {
+		status |= cStatusRxReady
+	}
+
+	if len(u.txFifo) >= FIFO_DEPTH {
+		status |= cStatusTxFull
+	}
+
+	if (len(u.txFifo) == 0) && !u.txShifting {
+		status |= cStatusTxEmpty
+	}
+
+	return status
+}
+
+func (u *Uart) ReadBus(address isa.BusValue) (isa.BusValue, error) {
+	value, err := u.Peek(address)
+
+	if (err == nil) && (isa.Register(address) == cDataReg) && (len(u.rxFifo) > 0) {
+		u.rxFifo = u.rxFifo[1:]
+	}
+
+	return value, err
+}
+
+// Peek reads the data register without taking the byte out of the RX FIFO.
+func (u *Uart) Peek(address isa.BusValue) (isa.BusValue, error) {
+	switch isa.Register(address) {
+	case cDataReg:
+		if len(u.rxFifo) == 0 {
+			return 0, nil
+		}
+
+		return isa.BusValue(u.rxFifo[0]), nil
+	case cStatusReg:
+		return isa.BusValue(u.statusValue()), nil
+	case cControlReg:
+		return isa.BusValue(u.control), nil
+	case cDividerReg:
+		return isa.BusValue(u.divider), nil
+	}
+
+	return 0, &device.AccessFault{Device: u.Name(), Address: address}
+}
+
+func (u *Uart) WriteBus(address isa.BusValue, value isa.BusValue) error {
+	switch isa.Register(address) {
+	case cDataReg:
+		if len(u.txFifo) >= FIFO_DEPTH {
+			u.status |= cStatusTxOverrun
+			return nil
+		}
+
+		u.txFifo = append(u.txFifo, byte(value))
+		return nil
+	case cStatusReg:
+		u.status &= ^(isa.Register(value) & (cStatusRxOverrun | cStatusTxOverrun))
+		return nil
+	case cControlReg:
+		u.control = isa.Register(value) & (cControlRxInterrupt | cControlTxInterrupt)
+		return nil
+	case cDividerReg:
+		u.divider = isa.Register(value)
+		return nil
+	}
+
+	return &device.AccessFault{Device: u.Name(), Address: address, Write: true}
+}
+
+func (u *Uart) TickCycle() {
+	u.tickTx()
+	u.tickRx()
+}
+
+func (u *Uart) tickTx() {
+	if !u.txShifting {
+		if len(u.txFifo) == 0 {
+			return
+		}
+
+		u.txByte = u.txFifo[0]
+		u.txFifo = u.txFifo[1:]
+		u.txShifting = true
+		u.txCountdown = u.frameCycles()
+	}
+
+	if u.txCountdown > 0 {
+		u.txCountdown--
+	}
+
+	if u.txCountdown == 0 {
+		u.txShifting = false
+
+		if u.backend != nil {
+			u.backend.Transmit(u.txByte)
+		}
+	}
+}
+
+func (u *Uart) tickRx() {
+	if !u.rxShifting {
+		if u.backend == nil {
+			return
+		}
+
+		b, received := u.backend.Receive()
+
+		if !received {
+			return
+		}
+
+		u.rxByte = b
+		u.rxShifting = true
+		u.rxCountdown = u.frameCycles()
+	}
+
+	if u.rxCountdown > 0 {
+		u.rxCountdown--
+	}
+
+	if u.rxCountdown == 0 {
+		u.rxShifting = false
+
+		if len(u.rxFifo) >= FIFO_DEPTH {
+			u.status |= cStatusRxOverrun
+			return
+		}
+
+		u.rxFifo = append(u.rxFifo, u.rxByte)
+	}
+}
+
+func (u *Uart) InterruptPending() bool {
+	rxInterrupt := ((u.control & cControlRxInterrupt) != 0) && (len(u.rxFifo) > 0)
+	txInterrupt := ((u.control & cControlTxInterrupt) != 0) && (len(u.txFifo) == 0) && !u.txShifting
+
+	return rxInterrupt || txInterrupt
+}
+
+// The UART can get the core out of a loop with an interrupt once more input arrives or the transmission is done.
+func (u *Uart) Active() bool {
+	if u.InterruptPending() {
+		return true
+	}
+
+	moreInput := u.rxShifting || ((u.backend != nil) && !u.backend.InputDone())
+	sending := (len(u.txFifo) > 0) || u.txShifting
+
+	return (((u.control & cControlRxInterrupt) != 0) && moreInput) || (((u.control & cControlTxInterrupt) != 0) && sending)
+}
+
+// The bytes in flight are saved, but not the backend, which is set up again with the restored system.
+func (u *Uart) Snapshot() ([]byte, error) {
+	state := make([]byte, 0, 16+len(u.txFifo)+len(u.rxFifo))
+	state = binary.BigEndian.AppendUint16(state, uint16(u.control))
+	state = binary.BigEndian.AppendUint16(state, uint16(u.status))
+	state = binary.BigEndian.AppendUint16(state, uint16(u.divider))
+	state = appendShifter(state, u.txShifting, u.txByte, u.txCountdown)
+	state = appendShifter(state, u.rxShifting, u.rxByte, u.rxCountdown)
+	state = append(state, byte(len(u.txFifo)))
+	state = append(state, u.txFifo...)
+	state = append(state, byte(len(u.rxFifo)))
+	state = append(state, u.rxFifo...)
+
+	return state, nil
+}
+
+func appendShifter(state []byte, shifting bool, b byte, countdown int) []byte {
+	if shifting {
+		state = append(state, 1)
+	} else {
+		state = append(state, 0)
+	}
+
+	state = append(state, b)
+
+	return binary.BigEndian.AppendUint32(state, uint32(countdown))
+}
+
+func (u *Uart) Restore(state []byte) error {
+	const fixedSize = 6 + 2*6
+
+	if len(state) < fixedSize+1 {
+		return fmt.Errorf("cannot restore %s device, snapshot of %d bytes is too short", u.Name(), len(state))
+	}
+
+	u.control = isa.Register(binary.BigEndian.Uint16(state[0:2]))
+	u.status = isa.Register(binary.BigEndian.Uint16(state[2:4]))
+	u.divider = isa.Register(binary.BigEndian.Uint16(state[4:6]))
+
+	u.txShifting = state[6] != 0
+	u.txByte = state[7]
+	u.txCountdown = int(binary.BigEndian.Uint32(state[8:12]))
+	u.rxShifting = state[12] != 0
+	u.rxByte = state[13]
+	u.rxCountdown = int(binary.BigEndian.Uint32(state[14:18]))
+
+	rest := state[fixedSize:]
+	txLen := int(rest[0])
+
+	if len(rest) < 1+txLen+1 {
+		return fmt.Errorf("cannot restore %s device, snapshot is cut off in the TX FIFO", u.Name())
+	}
+
+	u.txFifo = append([]byte{}, rest[1:1+txLen]...)
+	rest = rest[1+txLen:]
+	rxLen := int(rest[0])
+
+	if len(rest) != 1+rxLen {
+		return fmt.Errorf("cannot restore %s device, expected %d bytes of the RX FIFO, got %d", u.Name(), rxLen, len(rest)-1)
+	}
+
+	u.rxFifo = append([]byte{}, rest[1:]...)
+
+	return nil
+}
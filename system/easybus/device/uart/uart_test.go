@@ -0,0 +1,168 @@
+package uart
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mrav/isa"
+	"mrav/system/easybus/easybustest"
+)
+
+func TestTransmitPacing(t *testing.T) {
+	var output bytes.Buffer
+	u := NewUart(NewBufferedBackend(nil, &output), 2)
+
+	easybustest.WriteReg(t, u, cDataReg, 'H')
+	easybustest.WriteReg(t, u, cDataReg, 'i')
+
+	if (easybustest.ReadReg(t, u, cStatusReg) & cStatusTxEmpty) != 0 {
+		t.Fatalf("expected the TX to be busy")
+	}
+
+	// A frame is 10 bits of 2 cycles.
+	easybustest.Tick(u, 19)
+
+	if output.Len() != 0 {
+		t.Fatalf("expected nothing sent before the end of the first frame, got '%s'", output.String())
+	}
+
+	easybustest.Tick(u, 1)
+
+	if output.String() != "H" {
+		t.Fatalf("expected the first byte after 20 cycles, got '%s'", output.String())
+	}
+
+	easybustest.Tick(u, 20)
+
+	if output.String() != "Hi" {
+		t.Fatalf("expected both bytes after 40 cycles, got '%s'", output.String())
+	}
+
+	if (easybustest.ReadReg(t, u, cStatusReg) & cStatusTxEmpty) == 0 {
+		t.Fatalf("expected the TX to be empty")
+	}
+}
+
+func TestReceive(t *testing.T) {
+	u := NewUart(NewBufferedBackend([]byte("ab"), nil), 0)
+	easybustest.WriteReg(t, u, cControlReg, cControlRxInterrupt)
+
+	if u.InterruptPending() || !u.Active() {
+		t.Fatalf("expected no interrupt yet, but more input on the way")
+	}
+
+	easybustest.Tick(u, 2)
+
+	if !u.InterruptPending() || ((easybustest.ReadReg(t, u, cStatusReg) & cStatusRxReady) == 0) {
+		t.Fatalf("expected the received bytes to raise the interrupt")
+	}
+
+	if (easybustest.ReadReg(t, u, cDataReg) != 'a') || (easybustest.ReadReg(t, u, cDataReg) != 'b') || (easybustest.ReadReg(t, u, cDataReg) != 0) {
+		t.Fatalf("expected to read 'a', 'b' and then 0")
+	}
+
+	if u.InterruptPending() || u.Active() {
+		t.Fatalf("expected the UART to be idle after the input is done")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	u := NewUart(NewBufferedBackend([]byte("a"), nil), 0)
+	easybustest.Tick(u, 1)
+
+	for i := 0; i < 2; i++ {
+		if value, err := u.Peek(isa.BusValue(cDataReg)); (err != nil) || (value != 'a') {
+			t.Fatalf("expected to peek 'a', got %02X, %v", value, err)
+		}
+	}
+
+	if easybustest.ReadReg(t, u, cDataReg) != 'a' {
+		t.Fatalf("expected the peeked byte to stay in the RX FIFO")
+	}
+}
+
+func TestOverrun(t *testing.T) {
+	u := NewUart(NewBufferedBackend(nil, nil), 100)
+
+	for i := 0; i <= FIFO_DEPTH; i++ {
+		easybustest.WriteReg(t, u, cDataReg, isa.Register(i))
+	}
+
+	status := easybustest.ReadReg(t, u, cStatusReg)
+
+	if ((status & cStatusTxFull) == 0) || ((status & cStatusTxOverrun) == 0) {
+		t.Fatalf("expected the TX FIFO full and overrun, status %02X", status)
+	}
+
+	easybustest.WriteReg(t, u, cStatusReg, cStatusTxOverrun)
+
+	if (easybustest.ReadReg(t, u, cStatusReg) & cStatusTxOverrun) != 0 {
+		t.Fatalf("expected the overrun flag to be cleared")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	u := NewUart(NewBufferedBackend([]byte("xyz"), nil), 1)
+	easybustest.WriteReg(t, u, cDataReg, 'A')
+	easybustest.WriteReg(t, u, cDataReg, 'B')
+	easybustest.Tick(u, 25)
+
+	state, err := u.Snapshot()
+
+	if err != nil {
+		t.Fatalf("cannot snapshot: %v", err)
+	}
+
+	restored := NewUart(nil, 0)
+
+	if err := restored.Restore(state); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	restoredState, err := restored.Snapshot()
+
+	if err != nil {
+		t.Fatalf("cannot snapshot the restored UART: %v", err)
+	}
+
+	if !bytes.Equal(state, restoredState) {
+		t.Fatalf("restored state differs: %v vs %v", state, restoredState)
+	}
+}
+
+func TestFileBackendClosed(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "uart.out")
+	backend, err := NewFileBackend("", outputPath)
+
+	if err != nil {
+		t.Fatalf("cannot create the backend: %v", err)
+	}
+
+	u := NewUart(backend, 0)
+	easybustest.WriteReg(t, u, cDataReg, 'A')
+	easybustest.Tick(u, 1)
+
+	if err := u.Close(); err != nil {
+		t.Fatalf("cannot close the UART: %v", err)
+	}
+
+	if backend.outputFile != nil {
+		t.Fatalf("expected the output file to be closed")
+	}
+
+	// Dropped, not written to the closed file.
+	easybustest.WriteReg(t, u, cDataReg, 'B')
+	easybustest.Tick(u, 1)
+
+	output, err := os.ReadFile(outputPath)
+
+	if (err != nil) || (string(output) != "A") {
+		t.Fatalf("expected 'A' in the output file, got '%s' (%v)", output, err)
+	}
+
+	if backend.Err() != nil {
+		t.Fatalf("expected no errors after closing, got %v", backend.Err())
+	}
+}
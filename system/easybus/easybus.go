@@ -1,64 +1,171 @@
 package easybus
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"strings"
+	"slices"
 
 	"mrav/core"
+	"mrav/core/proto"
 	"mrav/isa"
 	"mrav/system"
 	"mrav/system/easybus/device"
 )
 
 type EasyBusSystem struct {
+	harts     []*hart
+	devices   []device.Device // In the order the regions were given, for the checkpoints
+	memoryMap *MemoryMap
+	cycles    uint64
+
+	// The hart that owns the bus, running the current instruction.
+	current int
+	hart    *hart
 	core    *core.Core
-	devices []device.Device
+
+	arbitration ArbitrationPolicy
+	nextHart    int // First hart to consider in the round-robin arbitration
+
+	// Devices with the optional interfaces, found once when the system is built.
+	exitDevices        []device.Exit
+	activeDevices      []device.Active
+	faultLatches       []device.FaultLatch
+	masterAwareDevices []device.MasterAware
+
+	busFaultPolicy BusFaultPolicy
+
+	// Set after the instruction that halted the program, when it exits or none of the harts can go on.
+	halt   Halt
+	halted bool
+
+	// Data accesses (LW/SW, not the instruction fetches) done by the last instruction.
+	dataAccesses []DataAccess
+
+	// Set once the interrupt is delivered for the next instruction. RunUntilStop delivers it ahead of running the
+	// instruction, so the breakpoints see the jump to the vector.
+	delivered   bool
+	interrupted bool
+
+	// State of the core before the last instruction, taken after the interrupt was delivered.
+	previousPc   isa.Register
+	previousRegs isa.GeneralRegisters
+
+	stopConditions      map[int]StopCondition
+	nextStopConditionId int
+
+	tracer Tracer
+
+	waveform *waveform
+
+	profiler Profiler
+	executed ExecutedInstruction // Filled in for the profiler while the instruction runs
+
+	fast *fastPath // Built on the first RunFast
 
 	logger  *slog.Logger
 	verbose bool
 }
 
-func NewEasyBusSystem(opts *system.SystemOpts, devices []device.Device) (*EasyBusSystem, error) {
-	coreOpts := &core.CoreOpts{
-		Logger:  opts.Logger,
-		Verbose: opts.Verbose,
+// NewEasyBusSystem builds the system with the devices placed in the regions of the bus, which can't overlap.
+func NewEasyBusSystem(opts *system.SystemOpts, regions []Region) (*EasyBusSystem, error) {
+	memoryMap, err := NewMemoryMap(regions)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory map: %w", err)
+	}
+
+	resetPcs := opts.ResetPcs
+
+	if len(resetPcs) == 0 {
+		resetPcs = []isa.Register{0x0000}
+	}
+
+	devices := make([]device.Device, 0, len(regions))
+
+	for _, region := range regions {
+		devices = append(devices, region.Device)
 	}
 
 	system := &EasyBusSystem{
-		core:    core.NewCore(coreOpts),
-		devices: devices,
-		logger:  opts.Logger,
-		verbose: opts.Verbose,
+		devices:   devices,
+		memoryMap: memoryMap,
+		logger:    opts.Logger,
+		verbose:   opts.Verbose,
+	}
+
+	for id, resetPc := range resetPcs {
+		coreOpts := &core.CoreOpts{
+			Logger:          opts.Logger,
+			Verbose:         opts.Verbose,
+			InterruptVector: opts.InterruptVector,
+			ResetPc:         resetPc,
+		}
+
+		if len(resetPcs) > 1 {
+			coreOpts.Logger = opts.Logger.With("hart", id)
+		}
+
+		system.harts = append(system.harts, &hart{
+			core:     core.NewCore(coreOpts),
+			coreOpts: coreOpts,
+		})
+	}
+
+	for _, dev := range devices {
+		if exitDev, ok := dev.(device.Exit); ok {
+			system.exitDevices = append(system.exitDevices, exitDev)
+		}
+
+		if activeDev, ok := dev.(device.Active); ok {
+			system.activeDevices = append(system.activeDevices, activeDev)
+		}
+
+		if latch, ok := dev.(device.FaultLatch); ok {
+			system.faultLatches = append(system.faultLatches, latch)
+		}
+
+		if masterAware, ok := dev.(device.MasterAware); ok {
+			system.masterAwareDevices = append(system.masterAwareDevices, masterAware)
+		}
 	}
 
+	system.selectHart(0)
+
 	return system, nil
 }
 
-func (sys *EasyBusSystem) hitDevice(address isa.BusValue) (device.Device, error) {
-	hits := make([]device.Device, 0)
+// Close closes the devices holding files or other resources, the ones implementing io.Closer. All of them are closed
+// even if some fail.
+func (sys *EasyBusSystem) Close() error {
+	var errs []error
 
-	for _, dev := range sys.devices {
-		if dev.Hit(address) {
-			hits = append(hits, dev)
+	for i, dev := range sys.devices {
+		if closer, ok := dev.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("cannot close device %d (%s): %w", i, dev.Name(), err))
+			}
 		}
 	}
 
-	if len(hits) == 0 {
-		return nil, fmt.Errorf("no device found for address: %04X", address)
-	}
+	return errors.Join(errs...)
+}
 
-	if len(hits) > 1 {
-		hitNames := make([]string, 0, len(hits))
+// MemoryMap returns the layout of the devices on the bus.
+func (sys *EasyBusSystem) MemoryMap() *MemoryMap {
+	return sys.memoryMap
+}
 
-		for _, hitDev := range hits {
-			hitNames = append(hitNames, hitDev.Name())
-		}
+// hitDevice finds the device mapped at the address, and the offset of the address from the base of its region.
+func (sys *EasyBusSystem) hitDevice(address isa.BusValue) (device.Device, isa.BusValue, error) {
+	region, offset, found := sys.memoryMap.Lookup(isa.Register(address))
 
-		return nil, fmt.Errorf("multiple devices hit on the bus: %s", strings.Join(hitNames, ", "))
+	if !found {
+		return nil, 0, &UnmappedError{Address: address}
 	}
 
-	return hits[0], nil
+	return region.Device, offset, nil
 }
 
 func (sys *EasyBusSystem) readBus(address isa.BusValue) (isa.BusValue, error) {
@@ -66,13 +173,27 @@ func (sys *EasyBusSystem) readBus(address isa.BusValue) (isa.BusValue, error) {
 		sys.logger.Info("[EasyBus system] Read", "address", fmt.Sprintf("%04X", address))
 	}
 
-	busDevice, err := sys.hitDevice(address)
+	busDevice, offset, err := sys.hitDevice(address)
 
 	if err != nil {
+		if sys.handleFault(isa.Register(address), false, err) {
+			return 0, nil
+		}
+
 		return 0, err
 	}
 
-	return busDevice.ReadBus(address)
+	value, err := busDevice.ReadBus(offset)
+
+	if err != nil {
+		if sys.handleFault(isa.Register(address), false, err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return value, nil
 }
 
 func (sys *EasyBusSystem) writeBus(address isa.BusValue, value isa.BusValue) error {
@@ -80,31 +201,117 @@ func (sys *EasyBusSystem) writeBus(address isa.BusValue, value isa.BusValue) err
 		sys.logger.Info("[EasyBus system] Write", "address", fmt.Sprintf("%04X", address), "value", fmt.Sprintf("%04X", value))
 	}
 
-	busDevice, err := sys.hitDevice(address)
+	busDevice, offset, err := sys.hitDevice(address)
 
 	if err != nil {
+		if sys.handleFault(isa.Register(address), true, err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if err := busDevice.WriteBus(offset, value); err != nil {
+		if sys.handleFault(isa.Register(address), true, err) {
+			return nil
+		}
+
 		return err
 	}
 
-	return busDevice.WriteBus(address, value)
+	sys.invalidateDecoded(isa.Register(address))
+
+	return nil
 }
 
+// CoreDebug dumps the core registers, with a line for each of the harts in the multi-core systems.
 func (sys *EasyBusSystem) CoreDebug(regsToDump []isa.RegisterId) (string, error) {
+	if len(sys.harts) > 1 {
+		return sys.hartsDebug(regsToDump)
+	}
+
 	return sys.core.DebugDump(regsToDump)
 }
 
+// GetCore returns the first hart, which is the only core in the single-core systems.
 func (sys *EasyBusSystem) GetCore() *core.Core {
-	return sys.core
+	return sys.harts[0].core
 }
 
 func (sys *EasyBusSystem) ProtoCoreDebugFile(filepath string) error {
-	return sys.core.SnapshotToFile(filepath)
+	return sys.harts[0].core.SnapshotToFile(filepath)
+}
+
+// Cycles returns the number of clock cycles simulated so far.
+func (sys *EasyBusSystem) Cycles() uint64 {
+	return sys.cycles
+}
+
+// tickCycle models a single clock of the core.sv state machine. Each of its states (CORE_READY fetching and executing,
+// CORE_LW_READ and CORE_SW_WRITE) drives exactly one bus transaction, and the bus devices complete it in the same
+// clock, so every bus access from the core is one clock cycle, plus the wait states of the slower devices.
+func (sys *EasyBusSystem) tickCycle() {
+	sys.cycles++
+
+	for _, dev := range sys.devices {
+		dev.TickCycle()
+	}
+}
+
+func (sys *EasyBusSystem) interruptPending() bool {
+	for _, dev := range sys.devices {
+		if dev.InterruptPending() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deliverInterrupts gives the pending trap or interrupt to the core before its next instruction, once per instruction.
+// A pending trap goes first, the interrupt can be taken once the trap handler enables the interrupts again. The
+// interrupt line is shared, so the interrupt is taken by whichever hart runs next with the interrupts enabled. Returns
+// true if the core jumped to the interrupt vector by this call.
+func (sys *EasyBusSystem) deliverInterrupts() bool {
+	if sys.delivered {
+		return false
+	}
+
+	sys.delivered = true
+
+	if sys.hart.trapPending {
+		sys.hart.trapPending = false
+		sys.interrupted = sys.core.TakeTrap()
+	} else {
+		sys.interrupted = sys.interruptPending() && sys.core.TakeInterrupt()
+	}
+
+	return sys.interrupted
 }
 
+// RunInstruction runs a single instruction on the hart picked by the arbitration.
 func (sys *EasyBusSystem) RunInstruction() error {
+	sys.arbitrate()
+	return sys.runInstruction()
+}
+
+// runInstruction runs the next instruction of the hart that owns the bus.
+func (sys *EasyBusSystem) runInstruction() error {
 	done := false
 	nextBusValue := isa.BusValue(0x0000)
 
+	// Interrupts are only delivered between instructions.
+	sys.deliverInterrupts()
+	sys.delivered = false
+
+	sys.previousPc = sys.core.Pc
+	sys.previousRegs = sys.core.Registers
+
+	sys.dataAccesses = sys.dataAccesses[:0]
+	trace := sys.newTraceBuilder(sys.interrupted)
+	sys.beginProfile(sys.interrupted)
+	fetched := isa.BusValue(0)
+
 	for !done {
 		busAccess, signals, err := sys.core.MultiturnRunInstruction(nextBusValue)
 
@@ -112,11 +319,14 @@ func (sys *EasyBusSystem) RunInstruction() error {
 			return fmt.Errorf("unable to run instruction in the system: %w", err)
 		}
 
-		for _, dev := range sys.devices {
-			dev.TickCycle()
-		}
-
 		if busAccess != nil {
+			if err := sys.stallBus(busAccess, signals); err != nil {
+				return err
+			}
+
+			sys.tickCycle()
+			sys.sampleWaveform()
+
 			if busAccess.Read != nil {
 				addr := busAccess.Read.Address
 				val, err := sys.readBus(isa.BusValue(addr))
@@ -126,6 +336,24 @@ func (sys *EasyBusSystem) RunInstruction() error {
 				}
 
 				nextBusValue = val
+				waveState := cWaveCoreReady
+
+				if slices.Contains(signals, core.SIGNAL_LOADING_DATA) {
+					waveState = cWaveCoreLwRead
+					sys.dataAccesses = append(sys.dataAccesses, DataAccess{
+						Address: addr,
+						Value:   isa.Register(val),
+					})
+
+					trace.addBusAccess(proto.BusAccessKind_BUS_ACCESS_KIND_READ, addr, isa.Register(val))
+				} else {
+					fetched = val
+					trace.addBusAccess(proto.BusAccessKind_BUS_ACCESS_KIND_FETCH, addr, isa.Register(val))
+				}
+
+				if err := sys.recordWaveform(&waveBusCycle{state: waveState, address: addr, value: isa.Register(val)}); err != nil {
+					return err
+				}
 			} else if busAccess.Write != nil {
 				addr := busAccess.Write.Address
 				val := busAccess.Write.Value
@@ -135,6 +363,18 @@ func (sys *EasyBusSystem) RunInstruction() error {
 				}
 
 				nextBusValue = isa.BusValue(0x0000)
+
+				sys.dataAccesses = append(sys.dataAccesses, DataAccess{
+					Address: addr,
+					Value:   val,
+					Write:   true,
+				})
+
+				trace.addBusAccess(proto.BusAccessKind_BUS_ACCESS_KIND_WRITE, addr, val)
+
+				if err := sys.recordWaveform(&waveBusCycle{state: cWaveCoreSwWrite, address: addr, value: val}); err != nil {
+					return err
+				}
 			} else {
 				return fmt.Errorf("bus access is neither read nor write")
 			}
@@ -145,5 +385,21 @@ func (sys *EasyBusSystem) RunInstruction() error {
 		}
 	}
 
+	sys.updateHalt(sys.previousPc, &sys.previousRegs)
+
+	if sys.profiler != nil {
+		instr, err := core.Decode(isa.Register(fetched))
+
+		if err != nil {
+			return fmt.Errorf("cannot profile the instruction: %w", err)
+		}
+
+		sys.finishProfile(&instr)
+	}
+
+	if err := sys.finishTrace(trace); err != nil {
+		return fmt.Errorf("cannot trace the instruction: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,138 @@
+// Package easybustest has the fixtures shared by the tests of the EasyBus system and its devices.
+package easybustest
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"mrav/isa"
+	"mrav/software/asm"
+	"mrav/software/machinecode"
+	"mrav/software/model"
+	"mrav/system"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device"
+	"mrav/system/easybus/device/memory"
+)
+
+// Size of the memory with the program in NewProgramSystem, the devices are mapped above it.
+const MEMORY_SIZE = 256
+
+// AssembleModule assembles the source, returning the module for the symbols and the binary image.
+func AssembleModule(t testing.TB, source string) (*model.MravModule, []byte) {
+	t.Helper()
+
+	program, err := asm.AssembleModules([]string{source})
+
+	if err != nil {
+		t.Fatalf("cannot assemble the test program: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := machinecode.GenerateMachineCode(*program, &buf); err != nil {
+		t.Fatalf("cannot generate the machine code: %v", err)
+	}
+
+	return program, buf.Bytes()
+}
+
+func Assemble(t testing.TB, source string) []byte {
+	t.Helper()
+
+	_, image := AssembleModule(t, source)
+
+	return image
+}
+
+func NewMemory(t testing.TB, size int, image []byte) *memory.Mem {
+	t.Helper()
+
+	mem, err := memory.NewMem(size, image)
+
+	if err != nil {
+		t.Fatalf("cannot create the memory: %v", err)
+	}
+
+	return mem
+}
+
+// Opts are the system options of the tests, with the harts starting at the reset PCs if any are given.
+func Opts(resetPcs ...isa.Register) *system.SystemOpts {
+	return &system.SystemOpts{
+		Logger:   slog.Default(),
+		ResetPcs: resetPcs,
+	}
+}
+
+func NewSystem(t testing.TB, opts *system.SystemOpts, regions ...easybus.Region) *easybus.EasyBusSystem {
+	t.Helper()
+
+	sys, err := easybus.NewEasyBusSystem(opts, regions)
+
+	if err != nil {
+		t.Fatalf("cannot create the system: %v", err)
+	}
+
+	return sys
+}
+
+// NewProgramSystem builds a single-core system with the program in the memory of MEMORY_SIZE bytes at address 0,
+// and the other devices in the regions.
+func NewProgramSystem(t testing.TB, source string, regions ...easybus.Region) *easybus.EasyBusSystem {
+	t.Helper()
+
+	mem := NewMemory(t, MEMORY_SIZE, Assemble(t, source))
+
+	return NewSystem(t, Opts(), append([]easybus.Region{easybus.MapDevice(0, mem)}, regions...)...)
+}
+
+// Run runs the instructions, failing the test on an error.
+func Run(t testing.TB, sys *easybus.EasyBusSystem, instructions int) {
+	t.Helper()
+
+	for i := 0; i < instructions; i++ {
+		if err := sys.RunInstruction(); err != nil {
+			t.Fatalf("instruction %d failed: %v", i, err)
+		}
+	}
+}
+
+// RunFast runs the instructions on the fast path, failing the test on an error.
+func RunFast(t testing.TB, sys *easybus.EasyBusSystem, instructions int) {
+	t.Helper()
+
+	if done, err := sys.RunFast(instructions); err != nil {
+		t.Fatalf("instruction %d failed: %v", done, err)
+	}
+}
+
+// Tick clocks the device on its own, without a system.
+func Tick(dev device.Device, cycles int) {
+	for i := 0; i < cycles; i++ {
+		dev.TickCycle()
+	}
+}
+
+// ReadReg reads the register at the offset straight from the device.
+func ReadReg(t testing.TB, dev device.Device, reg isa.Register) isa.Register {
+	t.Helper()
+
+	value, err := dev.ReadBus(isa.BusValue(reg))
+
+	if err != nil {
+		t.Fatalf("cannot read the register %d: %v", reg, err)
+	}
+
+	return isa.Register(value)
+}
+
+// WriteReg writes the register at the offset straight to the device.
+func WriteReg(t testing.TB, dev device.Device, reg isa.Register, value isa.Register) {
+	t.Helper()
+
+	if err := dev.WriteBus(isa.BusValue(reg), isa.BusValue(value)); err != nil {
+		t.Fatalf("cannot write the register %d: %v", reg, err)
+	}
+}
@@ -0,0 +1,302 @@
+package easybus
+
+import (
+	"fmt"
+
+	"mrav/core"
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+const (
+	cBusAddresses = 1 << 16
+
+	// Marker in the address to region table, region indexes are below it.
+	cNoDevice uint8 = 0xFF
+)
+
+type decodedEntry struct {
+	valid bool
+	instr core.DecodedInstruction
+}
+
+// fastPath holds the precomputed tables for RunFast, and services the data accesses of the core.
+type fastPath struct {
+	sys *EasyBusSystem
+
+	regions   []Region
+	deviceMap []uint8          // Index of the region with each bus address
+	cacheable []bool           // Per region, whether the instructions fetched from its device can be kept decoded
+	latencies []device.Latency // Per region, nil for the devices without the wait states
+	decoded   []decodedEntry
+}
+
+func newFastPath(sys *EasyBusSystem) (*fastPath, error) {
+	regions := sys.memoryMap.Regions()
+
+	if len(regions) >= int(cNoDevice) {
+		return nil, fmt.Errorf("fast simulation supports up to %d devices, the system has %d", cNoDevice, len(regions))
+	}
+
+	fp := &fastPath{
+		sys:       sys,
+		regions:   regions,
+		deviceMap: make([]uint8, cBusAddresses),
+		cacheable: make([]bool, len(regions)),
+		latencies: make([]device.Latency, len(regions)),
+		decoded:   make([]decodedEntry, cBusAddresses),
+	}
+
+	for address := range fp.deviceMap {
+		fp.deviceMap[address] = cNoDevice
+	}
+
+	for i, region := range regions {
+		for offset := 0; offset < region.Size; offset++ {
+			fp.deviceMap[int(region.Base)+offset] = uint8(i)
+		}
+
+		if cacheableDev, ok := region.Device.(device.Cacheable); ok {
+			fp.cacheable[i] = cacheableDev.Cacheable()
+		}
+
+		if latency, ok := region.Device.(device.Latency); ok {
+			fp.latencies[i] = latency
+		}
+	}
+
+	return fp, nil
+}
+
+// device is the table lookup equivalent of hitDevice, which is still used to report the errors.
+func (fp *fastPath) device(address isa.Register) (device.Device, isa.BusValue, uint8, error) {
+	idx := fp.deviceMap[address]
+
+	if idx == cNoDevice {
+		_, _, err := fp.sys.hitDevice(isa.BusValue(address))
+		return nil, 0, idx, err
+	}
+
+	region := &fp.regions[idx]
+
+	return region.Device, isa.BusValue(address - region.Base), idx, nil
+}
+
+// stall runs the wait states of the access, like stallBus.
+func (fp *fastPath) stall(address isa.Register, write bool) {
+	idx := fp.deviceMap[address]
+
+	if (idx == cNoDevice) || (fp.latencies[idx] == nil) {
+		return
+	}
+
+	offset := isa.BusValue(address - fp.regions[idx].Base)
+
+	for i := fp.latencies[idx].WaitStates(offset, write); i > 0; i-- {
+		fp.sys.tickCycle()
+	}
+}
+
+func (fp *fastPath) ReadData(address isa.Register) (isa.BusValue, error) {
+	fp.stall(address, false)
+	fp.sys.tickCycle()
+
+	value := isa.BusValue(0)
+	dev, offset, _, err := fp.device(address)
+
+	if err != nil {
+		if !fp.sys.handleFault(address, false, err) {
+			return 0, fmt.Errorf("cannot read from RAM: %w", err)
+		}
+	} else {
+		value, err = dev.ReadBus(offset)
+
+		if err != nil {
+			if !fp.sys.handleFault(address, false, err) {
+				return 0, fmt.Errorf("cannot read from RAM: %w", err)
+			}
+
+			value = 0
+		}
+	}
+
+	fp.sys.dataAccesses = append(fp.sys.dataAccesses, DataAccess{
+		Address: address,
+		Value:   isa.Register(value),
+	})
+
+	return value, nil
+}
+
+func (fp *fastPath) WriteData(address isa.Register, value isa.Register) error {
+	fp.stall(address, true)
+	fp.sys.tickCycle()
+
+	dev, offset, _, err := fp.device(address)
+
+	if err != nil {
+		if !fp.sys.handleFault(address, true, err) {
+			return fmt.Errorf("cannot write to bus: %w", err)
+		}
+	} else {
+		if err := dev.WriteBus(offset, isa.BusValue(value)); err != nil {
+			if !fp.sys.handleFault(address, true, err) {
+				return fmt.Errorf("cannot write to bus: %w", err)
+			}
+		} else {
+			fp.sys.invalidateDecoded(address)
+		}
+	}
+
+	fp.sys.dataAccesses = append(fp.sys.dataAccesses, DataAccess{
+		Address: address,
+		Value:   value,
+		Write:   true,
+	})
+
+	return nil
+}
+
+// fetch returns the decoded instruction at the address, reading it from the bus only if it's not cached already.
+func (fp *fastPath) fetch(address isa.Register, scratch *core.DecodedInstruction) (*core.DecodedInstruction, error) {
+	entry := &fp.decoded[address]
+
+	if entry.valid {
+		return &entry.instr, nil
+	}
+
+	word := isa.BusValue(0)
+	faulted := false
+	dev, offset, idx, err := fp.device(address)
+
+	if err != nil {
+		if !fp.sys.handleFault(address, false, err) {
+			return nil, fmt.Errorf("cannot read from RAM: %w", err)
+		}
+
+		faulted = true
+	} else {
+		word, err = dev.ReadBus(offset)
+
+		if err != nil {
+			if !fp.sys.handleFault(address, false, err) {
+				return nil, fmt.Errorf("cannot read from RAM: %w", err)
+			}
+
+			word = 0
+			faulted = true
+		}
+	}
+
+	instr, err := core.Decode(isa.Register(word))
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to run instruction in the system: %w", err)
+	}
+
+	// The bus faults are not cached, they need to be handled on every fetch.
+	if faulted || !fp.cacheable[idx] {
+		*scratch = instr
+		return scratch, nil
+	}
+
+	entry.instr = instr
+	entry.valid = true
+
+	return &entry.instr, nil
+}
+
+// invalidateDecoded drops the cached instructions overlapping the word at the address.
+func (sys *EasyBusSystem) invalidateDecoded(address isa.Register) {
+	if sys.fast == nil {
+		return
+	}
+
+	sys.fast.decoded[address-1].valid = false
+	sys.fast.decoded[address].valid = false
+	sys.fast.decoded[address+1].valid = false
+}
+
+func (sys *EasyBusSystem) invalidateAllDecoded() {
+	if sys.fast == nil {
+		return
+	}
+
+	clear(sys.fast.decoded)
+}
+
+// RunFast runs the given number of instructions and returns how many were completed. The result is the same as with
+// calling RunInstruction repeatedly, but the instructions are kept decoded and the devices are looked up in a table,
+// without the per-access allocations and logging, so it's meant for long simulations.
+//
+// Stop conditions are not checked. With a tracer or a waveform recorder set, or verbose output on, the instructions
+// are simply run with RunInstruction.
+func (sys *EasyBusSystem) RunFast(instructions int) (int, error) {
+	return sys.runFast(instructions, false)
+}
+
+// RunFastUntilHalt is RunFast that stops early, after the instruction that halted the program.
+func (sys *EasyBusSystem) RunFastUntilHalt(maxInstructions int) (int, error) {
+	return sys.runFast(maxInstructions, true)
+}
+
+func (sys *EasyBusSystem) runFast(instructions int, untilHalt bool) (int, error) {
+	if (sys.tracer != nil) || (sys.waveform != nil) || sys.verbose {
+		for i := 0; i < instructions; i++ {
+			if err := sys.RunInstruction(); err != nil {
+				return i, err
+			}
+
+			if untilHalt && sys.halted {
+				return i + 1, nil
+			}
+		}
+
+		return instructions, nil
+	}
+
+	if sys.fast == nil {
+		fp, err := newFastPath(sys)
+
+		if err != nil {
+			return 0, err
+		}
+
+		sys.fast = fp
+	}
+
+	var scratch core.DecodedInstruction
+
+	for i := 0; i < instructions; i++ {
+		sys.arbitrate()
+		sys.deliverInterrupts()
+		sys.delivered = false
+
+		sys.previousPc = sys.core.Pc
+		sys.previousRegs = sys.core.Registers
+
+		sys.dataAccesses = sys.dataAccesses[:0]
+		sys.beginProfile(sys.interrupted)
+		sys.fast.stall(sys.core.Pc, false)
+		sys.tickCycle()
+
+		instr, err := sys.fast.fetch(sys.core.Pc, &scratch)
+
+		if err != nil {
+			return i, err
+		}
+
+		if err := sys.core.RunDecoded(instr, sys.fast); err != nil {
+			return i, err
+		}
+
+		sys.updateHalt(sys.previousPc, &sys.previousRegs)
+		sys.finishProfile(instr)
+
+		if untilHalt && sys.halted {
+			return i + 1, nil
+		}
+	}
+
+	return instructions, nil
+}
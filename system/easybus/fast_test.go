@@ -0,0 +1,195 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+const cLoopProgram = `
+xor r0 r0 r0
+ldhi r2 0x01
+shr r2 8
+ldhi r1 0x0A
+shr r1 8
+loop: add r0 r0 r1
+sub r1 r1 r2
+bnz r1 loop
+xor r3 r3 r3
+addi r3 200
+sw r3 r0
+lw r4 r3
+forever: jal r10 forever
+`
+
+const cSelfModifyingProgram = `
+xor r3 r3 r3
+xor r4 r4 r4
+addi r4 patch
+xor r1 r1 r1
+ldhi r1 0x73
+addi r1 2
+patch: addi r3 1
+sw r4 r1
+jal r0 patch
+`
+
+// Reads the word at 252, the last byte of the memory and the first byte of the timer, which is not a valid address.
+const cFaultingProgram = `
+xor r1 r1 r1
+addi r1 10
+addi r1 242
+lw r2 r1
+`
+
+func TestRunFastMatchesMultiturn(t *testing.T) {
+	programs := map[string]string{
+		"loop":           cLoopProgram,
+		"self-modifying": cSelfModifyingProgram,
+		"interrupt":      cInterruptProgram,
+	}
+
+	for name, source := range programs {
+		t.Run(name, func(t *testing.T) {
+			image := easybustest.Assemble(t, source)
+			multiturn := newTestSystem(t, image)
+			fast := newTestSystem(t, image)
+
+			for i := 0; i < 500; i++ {
+				easybustest.Run(t, multiturn, 1)
+				easybustest.RunFast(t, fast, 1)
+				requireSameState(t, multiturn, fast)
+			}
+		})
+	}
+}
+
+func TestRunFastSelfModifyingCode(t *testing.T) {
+	sys := newTestSystem(t, easybustest.Assemble(t, cSelfModifyingProgram))
+
+	// 6 instructions of setup, then the patched loop of 3 instructions.
+	easybustest.RunFast(t, sys, 6+3*10)
+
+	if got := sys.GetCore().Registers[3]; got != 1+2*9 {
+		t.Fatalf("expected r3 = %d after the patched loop, got %d", 1+2*9, got)
+	}
+}
+
+func TestRunFastAfterRestore(t *testing.T) {
+	image := easybustest.Assemble(t, cSelfModifyingProgram)
+	multiturn := newTestSystem(t, image)
+	fast := newTestSystem(t, image)
+
+	initial, err := fast.Checkpoint()
+
+	if err != nil {
+		t.Fatalf("cannot checkpoint: %v", err)
+	}
+
+	// The patched instruction is cached, the restored memory has the original one.
+	easybustest.RunFast(t, fast, 100)
+
+	if err := fast.Restore(initial); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	easybustest.Run(t, multiturn, 100)
+	easybustest.RunFast(t, fast, 100)
+	requireSameState(t, multiturn, fast)
+}
+
+// Continuing on the fast path from the breakpoint at the vector runs the handler, without taking the interrupt again.
+func TestRunFastAfterBreakpointAtInterruptVector(t *testing.T) {
+	image := easybustest.Assemble(t, cMaskedTimerProgram)
+	multiturn := newTestSystem(t, image)
+	fast := newTestSystem(t, image)
+
+	for _, sys := range []*easybus.EasyBusSystem{multiturn, fast} {
+		id := sys.AddStopCondition(&easybus.PcBreakpoint{Pc: 0x0002})
+
+		if events, done, err := sys.RunUntilStop(500); (err != nil) || (len(events) != 1) {
+			t.Fatalf("expected to stop at the vector, got %d events after %d instructions (%v)", len(events), done, err)
+		}
+
+		if err := sys.RemoveStopCondition(id); err != nil {
+			t.Fatalf("cannot remove the breakpoint: %v", err)
+		}
+	}
+
+	easybustest.Run(t, multiturn, 100)
+	easybustest.RunFast(t, fast, 100)
+	requireSameState(t, multiturn, fast)
+}
+
+func TestRunFastFaultMatchesMultiturn(t *testing.T) {
+	image := easybustest.Assemble(t, cFaultingProgram)
+	multiturn := newTestSystem(t, image)
+	fast := newTestSystem(t, image)
+
+	var multiturnErr error
+	multiturnDone := 0
+
+	for ; multiturnDone < 10; multiturnDone++ {
+		if multiturnErr = multiturn.RunInstruction(); multiturnErr != nil {
+			break
+		}
+	}
+
+	fastDone, fastErr := fast.RunFast(10)
+
+	if (multiturnErr == nil) || (fastErr == nil) {
+		t.Fatalf("expected both runs to fail, multiturn: %v, fast: %v", multiturnErr, fastErr)
+	}
+
+	if multiturnErr.Error() != fastErr.Error() {
+		t.Fatalf("different errors, multiturn: %v, fast: %v", multiturnErr, fastErr)
+	}
+
+	if multiturnDone != fastDone {
+		t.Fatalf("failed at different instructions, multiturn: %d, fast: %d", multiturnDone, fastDone)
+	}
+}
+
+func TestRunFastDoesNotAllocate(t *testing.T) {
+	sys := newTestSystem(t, easybustest.Assemble(t, cLoopProgram))
+
+	// Builds the tables and warms up the cache and the data access buffer.
+	easybustest.RunFast(t, sys, 100)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := sys.RunFast(100); err != nil {
+			t.Fatalf("fast run failed: %v", err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("expected no allocations on the fast path, got %v per run", allocs)
+	}
+}
+
+func BenchmarkRunInstruction(b *testing.B) {
+	sys := newTestSystem(b, easybustest.Assemble(b, cInterruptProgram))
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := sys.RunInstruction(); err != nil {
+			b.Fatalf("multiturn run failed: %v", err)
+		}
+	}
+
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+func BenchmarkRunFast(b *testing.B) {
+	sys := newTestSystem(b, easybustest.Assemble(b, cInterruptProgram))
+
+	b.ResetTimer()
+
+	if _, err := sys.RunFast(b.N); err != nil {
+		b.Fatalf("fast run failed: %v", err)
+	}
+
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
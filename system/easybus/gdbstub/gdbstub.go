@@ -0,0 +1,838 @@
+package gdbstub
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"mrav/core"
+	"mrav/isa"
+	"mrav/system/easybus"
+)
+
+// Register file as seen by the debugger, general purpose registers are followed by the PC.
+//
+//go:embed target.xml
+var targetXml []byte
+
+const (
+	cPcRegNum   = int(isa.RegsNumber)
+	cRegsNumber = int(isa.RegsNumber) + 1
+
+	// How many instructions are run before checking if the debugger wants to interrupt the target.
+	cContinueChunk = 1024
+
+	cPacketSize = 0x1000
+
+	// The harts are the threads of the debugger, numbered from 1 because 0 and -1 mean any and all threads.
+	cAnyHart = -1
+
+	cSigInt  = 0x02
+	cSigTrap = 0x05
+	cSigSegv = 0x0B
+)
+
+type StubOpts struct {
+	Logger  *slog.Logger
+	Verbose bool
+}
+
+type watchKey struct {
+	kind    byte // Z packet type: '2' write, '3' read, '4' access
+	address isa.Register
+	length  int
+}
+
+// Stub implements the GDB remote serial protocol on top of an EasyBus system.
+//
+// Software breakpoints and watchpoints are implemented as the system's stop conditions, the program in memory is not
+// patched. The harts are shown as the threads, they all run when the target is continued, and single-stepping runs
+// the other harts until the stepped one has done an instruction.
+type Stub struct {
+	sys *easybus.EasyBusSystem
+
+	hart       int // Hart of the register accesses, selected with 'Hg' and switched to the hart that stopped
+	resumeHart int // Hart to single-step, selected with 'Hc', cAnyHart steps the hart of the register accesses
+
+	logger  *slog.Logger
+	verbose bool
+
+	breakpoints map[isa.Register]int // Maps to the stop condition ID
+	watchpoints map[watchKey]int
+
+	conn      io.Writer
+	input     chan inputEvent
+	noAck     bool
+	lastReply string
+}
+
+type inputEvent struct {
+	packet      string
+	interrupt   bool
+	badChecksum bool
+	err         error
+}
+
+func NewStub(sys *easybus.EasyBusSystem, opts *StubOpts) *Stub {
+	return &Stub{
+		sys:         sys,
+		logger:      opts.Logger,
+		verbose:     opts.Verbose,
+		breakpoints: make(map[isa.Register]int),
+		watchpoints: make(map[watchKey]int),
+		resumeHart:  cAnyHart,
+		lastReply:   fmt.Sprintf("T%02xthread:1;", cSigTrap),
+	}
+}
+
+// Serve handles a single debugger session on the connection, until the debugger detaches or kills the target.
+func (s *Stub) Serve(conn io.ReadWriter) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	s.conn = conn
+	s.input = make(chan inputEvent)
+	s.noAck = false
+
+	go s.readInput(bufio.NewReader(conn), done)
+
+	for {
+		event := <-s.input
+
+		if event.err != nil {
+			if errors.Is(event.err, io.EOF) {
+				return nil
+			}
+
+			return event.err
+		}
+
+		if event.interrupt {
+			continue // Target is not running, nothing to interrupt.
+		}
+
+		if event.badChecksum {
+			if _, err := io.WriteString(s.conn, "-"); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !s.noAck {
+			if _, err := io.WriteString(s.conn, "+"); err != nil {
+				return err
+			}
+		}
+
+		if s.verbose {
+			s.logger.Info("[GDB stub] Packet", "packet", event.packet)
+		}
+
+		reply, end, err := s.handlePacket(event.packet)
+
+		if err != nil {
+			return err
+		}
+
+		if end {
+			if reply != "" {
+				return s.sendPacket(reply)
+			}
+
+			return nil
+		}
+
+		if err := s.sendPacket(reply); err != nil {
+			return err
+		}
+
+		if event.packet == "QStartNoAckMode" {
+			s.noAck = true
+		}
+	}
+}
+
+func (s *Stub) readInput(reader *bufio.Reader, done chan struct{}) {
+	send := func(event inputEvent) bool {
+		select {
+		case s.input <- event:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	for {
+		b, err := reader.ReadByte()
+
+		if err != nil {
+			send(inputEvent{err: err})
+			return
+		}
+
+		switch b {
+		case 0x03:
+			if !send(inputEvent{interrupt: true}) {
+				return
+			}
+		case '$':
+			event := readPacket(reader)
+
+			if !send(event) || (event.err != nil) {
+				return
+			}
+		default:
+			// Acks for the stub's packets are not needed over TCP.
+		}
+	}
+}
+
+func readPacket(reader *bufio.Reader) inputEvent {
+	var packet strings.Builder
+	checksum := byte(0)
+
+	for {
+		b, err := reader.ReadByte()
+
+		if err != nil {
+			return inputEvent{err: err}
+		}
+
+		if b == '#' {
+			break
+		}
+
+		checksum += b
+
+		if b == '}' {
+			escaped, err := reader.ReadByte()
+
+			if err != nil {
+				return inputEvent{err: err}
+			}
+
+			checksum += escaped
+			b = escaped ^ 0x20
+		}
+
+		packet.WriteByte(b)
+	}
+
+	checksumHex := make([]byte, 2)
+
+	if _, err := io.ReadFull(reader, checksumHex); err != nil {
+		return inputEvent{err: err}
+	}
+
+	expected, err := strconv.ParseUint(string(checksumHex), 16, 8)
+
+	if (err != nil) || (byte(expected) != checksum) {
+		return inputEvent{badChecksum: true}
+	}
+
+	return inputEvent{packet: packet.String()}
+}
+
+func (s *Stub) sendPacket(data string) error {
+	checksum := byte(0)
+
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+
+	_, err := fmt.Fprintf(s.conn, "$%s#%02x", data, checksum)
+
+	return err
+}
+
+func (s *Stub) errorReply(err error) string {
+	if s.verbose {
+		s.logger.Info("[GDB stub] Error", "error", err)
+	}
+
+	return "E01"
+}
+
+// handlePacket returns the reply to the packet and whether the session is over.
+func (s *Stub) handlePacket(packet string) (string, bool, error) {
+	if packet == "" {
+		return "", false, nil
+	}
+
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return s.lastReply, false, nil
+	case 'g':
+		return s.readRegisters(), false, nil
+	case 'G':
+		if err := s.writeRegisters(args); err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return "OK", false, nil
+	case 'p':
+		reply, err := s.readRegister(args)
+
+		if err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return reply, false, nil
+	case 'P':
+		if err := s.writeRegister(args); err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return "OK", false, nil
+	case 'm':
+		reply, err := s.readMemory(args)
+
+		if err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return reply, false, nil
+	case 'M':
+		if err := s.writeMemory(args); err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return "OK", false, nil
+	case 's', 'c':
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 16)
+
+			if err != nil {
+				return s.errorReply(err), false, nil
+			}
+
+			s.resumingCore().Pc = isa.Register(addr)
+		}
+
+		reply, err := s.resume(packet[0] == 's')
+
+		if err != nil {
+			return "", true, err
+		}
+
+		s.lastReply = reply
+		return reply, false, nil
+	case 'Z', 'z':
+		if err := s.updatePoint(packet[0] == 'Z', args); err != nil {
+			if errors.Is(err, errUnsupported) {
+				return "", false, nil
+			}
+
+			return s.errorReply(err), false, nil
+		}
+
+		return "OK", false, nil
+	case 'q', 'Q':
+		return s.handleQuery(packet), false, nil
+	case 'H':
+		if err := s.selectThread(args); err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return "OK", false, nil
+	case 'T':
+		if _, err := s.parseThread(args); err != nil {
+			return s.errorReply(err), false, nil
+		}
+
+		return "OK", false, nil
+	case 'D':
+		return "OK", true, nil
+	case 'k':
+		return "", true, nil
+	case 'v':
+		if packet == "vKill" || strings.HasPrefix(packet, "vKill;") {
+			return "OK", true, nil
+		}
+
+		return "", false, nil
+	default:
+		return "", false, nil
+	}
+}
+
+func (s *Stub) handleQuery(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+;swbreak+", cPacketSize)
+	case packet == "QStartNoAckMode":
+		return "OK"
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return fmt.Sprintf("QC%x", s.hart+1)
+	case packet == "qfThreadInfo":
+		return "m" + s.threadList()
+	case packet == "qsThreadInfo":
+		return "l"
+	case strings.HasPrefix(packet, "qSymbol"):
+		return "OK"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return s.readTargetXml(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+	default:
+		return ""
+	}
+}
+
+func (s *Stub) readTargetXml(args string) string {
+	offset, length, err := parseAddressLength(args)
+
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	if int(offset) >= len(targetXml) {
+		return "l"
+	}
+
+	end := int(offset) + length
+
+	if end >= len(targetXml) {
+		return "l" + escapeBinary(targetXml[offset:])
+	}
+
+	return "m" + escapeBinary(targetXml[offset:end])
+}
+
+func escapeBinary(data []byte) string {
+	var escaped strings.Builder
+
+	for _, b := range data {
+		switch b {
+		case '#', '$', '}', '*':
+			escaped.WriteByte('}')
+			escaped.WriteByte(b ^ 0x20)
+		default:
+			escaped.WriteByte(b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func (s *Stub) threadList() string {
+	threads := make([]string, 0, s.sys.HartCount())
+
+	for hart := 0; hart < s.sys.HartCount(); hart++ {
+		threads = append(threads, strconv.FormatInt(int64(hart+1), 16))
+	}
+
+	return strings.Join(threads, ",")
+}
+
+// parseThread returns the hart of the thread ID, or cAnyHart for the IDs meaning any or all the threads.
+func (s *Stub) parseThread(spec string) (int, error) {
+	thread, err := strconv.ParseInt(spec, 16, 32)
+
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse the thread ID: %w", err)
+	}
+
+	if thread <= 0 {
+		return cAnyHart, nil
+	}
+
+	if int(thread) > s.sys.HartCount() {
+		return 0, fmt.Errorf("no thread %d, the system has %d harts", thread, s.sys.HartCount())
+	}
+
+	return int(thread) - 1, nil
+}
+
+func (s *Stub) selectThread(args string) error {
+	if args == "" {
+		return fmt.Errorf("malformed thread selection")
+	}
+
+	hart, err := s.parseThread(args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case 'g':
+		if hart != cAnyHart {
+			s.hart = hart
+		}
+	case 'c':
+		s.resumeHart = hart
+	default:
+		return fmt.Errorf("unknown thread operation '%c'", args[0])
+	}
+
+	return nil
+}
+
+func (s *Stub) core() *core.Core {
+	c, _ := s.sys.GetHart(s.hart) // Always in range, the thread IDs are checked when they're selected.
+
+	return c
+}
+
+func (s *Stub) steppedHart() int {
+	if s.resumeHart == cAnyHart {
+		return s.hart
+	}
+
+	return s.resumeHart
+}
+
+func (s *Stub) resumingCore() *core.Core {
+	c, _ := s.sys.GetHart(s.steppedHart())
+
+	return c
+}
+
+func (s *Stub) registerValue(regNum int) isa.Register {
+	c := s.core()
+
+	if regNum == cPcRegNum {
+		return c.Pc
+	}
+
+	return c.Registers[regNum]
+}
+
+func (s *Stub) setRegisterValue(regNum int, value isa.Register) {
+	c := s.core()
+
+	if regNum == cPcRegNum {
+		c.Pc = value
+		return
+	}
+
+	c.Registers[regNum] = value
+}
+
+func (s *Stub) readRegisters() string {
+	var regs strings.Builder
+
+	for i := 0; i < cRegsNumber; i++ {
+		fmt.Fprintf(&regs, "%04x", s.registerValue(i))
+	}
+
+	return regs.String()
+}
+
+func (s *Stub) writeRegisters(args string) error {
+	if len(args) != 4*cRegsNumber {
+		return fmt.Errorf("expected %d hex digits for the registers, got %d", 4*cRegsNumber, len(args))
+	}
+
+	values := make([]isa.Register, 0, cRegsNumber)
+
+	for i := 0; i < cRegsNumber; i++ {
+		value, err := strconv.ParseUint(args[4*i:4*i+4], 16, 16)
+
+		if err != nil {
+			return fmt.Errorf("cannot parse register %d: %w", i, err)
+		}
+
+		values = append(values, isa.Register(value))
+	}
+
+	for i, value := range values {
+		s.setRegisterValue(i, value)
+	}
+
+	return nil
+}
+
+func parseRegNum(spec string) (int, error) {
+	regNum, err := strconv.ParseUint(spec, 16, 8)
+
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse the register number: %w", err)
+	}
+
+	if int(regNum) >= cRegsNumber {
+		return 0, fmt.Errorf("register number %d out of range", regNum)
+	}
+
+	return int(regNum), nil
+}
+
+func (s *Stub) readRegister(args string) (string, error) {
+	regNum, err := parseRegNum(args)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%04x", s.registerValue(regNum)), nil
+}
+
+func (s *Stub) writeRegister(args string) error {
+	regSpec, valueSpec, found := strings.Cut(args, "=")
+
+	if !found {
+		return fmt.Errorf("malformed register write: %s", args)
+	}
+
+	regNum, err := parseRegNum(regSpec)
+
+	if err != nil {
+		return err
+	}
+
+	value, err := strconv.ParseUint(valueSpec, 16, 16)
+
+	if err != nil {
+		return fmt.Errorf("cannot parse the register value: %w", err)
+	}
+
+	s.setRegisterValue(regNum, isa.Register(value))
+
+	return nil
+}
+
+func parseAddressLength(args string) (isa.Register, int, error) {
+	addrSpec, lengthSpec, found := strings.Cut(args, ",")
+
+	if !found {
+		return 0, 0, fmt.Errorf("expected 'address,length', got '%s'", args)
+	}
+
+	addr, err := strconv.ParseUint(addrSpec, 16, 16)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse the address: %w", err)
+	}
+
+	length, err := strconv.ParseUint(lengthSpec, 16, 16)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse the length: %w", err)
+	}
+
+	return isa.Register(addr), int(length), nil
+}
+
+func (s *Stub) readMemory(args string) (string, error) {
+	addr, length, err := parseAddressLength(args)
+
+	if err != nil {
+		return "", err
+	}
+
+	// Two hex digits per byte, the debugger asks for the rest of a longer read.
+	data, err := s.sys.ReadMemory(addr, min(length, cPacketSize/2))
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+func (s *Stub) writeMemory(args string) error {
+	location, dataHex, found := strings.Cut(args, ":")
+
+	if !found {
+		return fmt.Errorf("malformed memory write: %s", args)
+	}
+
+	addr, length, err := parseAddressLength(location)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := hex.DecodeString(dataHex)
+
+	if err != nil {
+		return fmt.Errorf("cannot decode the memory write data: %w", err)
+	}
+
+	if len(data) != length {
+		return fmt.Errorf("memory write of %d bytes has %d bytes of data", length, len(data))
+	}
+
+	return s.sys.WriteMemory(addr, data)
+}
+
+var errUnsupported = errors.New("unsupported")
+
+func (s *Stub) updatePoint(insert bool, args string) error {
+	fields := strings.Split(args, ",")
+
+	if len(fields) != 3 {
+		return fmt.Errorf("malformed breakpoint packet: %s", args)
+	}
+
+	addr, err := strconv.ParseUint(fields[1], 16, 16)
+
+	if err != nil {
+		return fmt.Errorf("cannot parse the breakpoint address: %w", err)
+	}
+
+	kind, err := strconv.ParseUint(fields[2], 16, 16)
+
+	if err != nil {
+		return fmt.Errorf("cannot parse the breakpoint kind: %w", err)
+	}
+
+	switch fields[0] {
+	case "0", "1":
+		// Hardware breakpoints are no different from the software ones in the simulation.
+		return s.updateBreakpoint(insert, isa.Register(addr))
+	case "2", "3", "4":
+		key := watchKey{
+			kind:    fields[0][0],
+			address: isa.Register(addr),
+			length:  int(kind),
+		}
+
+		return s.updateWatchpoint(insert, key)
+	default:
+		return errUnsupported
+	}
+}
+
+func (s *Stub) updateBreakpoint(insert bool, addr isa.Register) error {
+	id, exists := s.breakpoints[addr]
+
+	if insert {
+		if !exists {
+			s.breakpoints[addr] = s.sys.AddStopCondition(&easybus.PcBreakpoint{Pc: addr})
+		}
+
+		return nil
+	}
+
+	if !exists {
+		return nil
+	}
+
+	delete(s.breakpoints, addr)
+
+	return s.sys.RemoveStopCondition(id)
+}
+
+func (s *Stub) updateWatchpoint(insert bool, key watchKey) error {
+	id, exists := s.watchpoints[key]
+
+	if insert {
+		if exists {
+			return nil
+		}
+
+		length := max(key.length, 1)
+
+		s.watchpoints[key] = s.sys.AddStopCondition(&easybus.AddressWatchpoint{
+			Lo:      key.address,
+			Hi:      key.address + isa.Register(length-1),
+			OnRead:  key.kind != '2',
+			OnWrite: key.kind != '3',
+		})
+
+		return nil
+	}
+
+	if !exists {
+		return nil
+	}
+
+	delete(s.watchpoints, key)
+
+	return s.sys.RemoveStopCondition(id)
+}
+
+// resume runs the target until it stops, and returns the stop reply.
+func (s *Stub) resume(singleStep bool) (string, error) {
+	if singleStep {
+		return s.step(s.steppedHart()), nil
+	}
+
+	for {
+		events, _, err := s.sys.RunUntilStop(cContinueChunk)
+
+		if (err != nil) || (len(events) > 0) {
+			return s.stopReply(events, err), nil
+		}
+
+		select {
+		case event := <-s.input:
+			if event.err != nil {
+				return "", event.err
+			}
+
+			if event.interrupt {
+				return s.stopReply(nil, errInterrupted), nil
+			}
+
+			// Nothing else is expected from the debugger while the target is running.
+		default:
+		}
+	}
+}
+
+// step runs the harts until the given one has done an instruction, or any of them stops. The other harts can keep it
+// off the bus, like with the fixed priority, so they're only run for a chunk of instructions.
+func (s *Stub) step(hart int) string {
+	for i := 0; i < cContinueChunk; i++ {
+		events, _, err := s.sys.RunUntilStop(1)
+
+		if (err != nil) || (len(events) > 0) || (s.sys.CurrentHart() == hart) {
+			return s.stopReply(events, err)
+		}
+	}
+
+	return s.stopReply(nil, nil)
+}
+
+var errInterrupted = errors.New("interrupted by the debugger")
+
+// stopReply switches the register accesses to the hart that ran the last instruction, and reports it as the thread
+// that stopped.
+func (s *Stub) stopReply(events []*easybus.StopEvent, err error) string {
+	s.hart = s.sys.CurrentHart()
+	thread := fmt.Sprintf("thread:%x;", s.hart+1)
+
+	if errors.Is(err, errInterrupted) {
+		return fmt.Sprintf("T%02x%s", cSigInt, thread)
+	}
+
+	if err != nil {
+		if s.verbose {
+			s.logger.Info("[GDB stub] Target fault", "error", err)
+		}
+
+		return fmt.Sprintf("T%02x%s", cSigSegv, thread)
+	}
+
+	for _, event := range events {
+		if _, isBreakpoint := event.Condition.(*easybus.PcBreakpoint); isBreakpoint {
+			return fmt.Sprintf("T%02x%sswbreak:;", cSigTrap, thread)
+		}
+
+		if watch, isWatch := event.Condition.(*easybus.AddressWatchpoint); isWatch {
+			watchType := "awatch"
+
+			if !watch.OnRead {
+				watchType = "watch"
+			} else if !watch.OnWrite {
+				watchType = "rwatch"
+			}
+
+			return fmt.Sprintf("T%02x%s%s:%x;", cSigTrap, thread, watchType, watch.Lo)
+		}
+	}
+
+	return fmt.Sprintf("T%02x%s", cSigTrap, thread)
+}
@@ -0,0 +1,215 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"mrav/isa"
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+const cCountProgram = `
+xor r1 r1 r1
+loop: addi r1 1
+stop: jal r0 loop
+`
+
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	done   chan error
+}
+
+// startStub serves the system on one end of a pipe, and returns the debugger on the other end.
+func startStub(t *testing.T, sys *easybus.EasyBusSystem) *testClient {
+	t.Helper()
+
+	stubConn, conn := net.Pipe()
+	done := make(chan error, 1)
+	stub := NewStub(sys, &StubOpts{Logger: slog.Default()})
+
+	go func() {
+		done <- stub.Serve(stubConn)
+		stubConn.Close()
+	}()
+
+	client := &testClient{t: t, conn: conn, reader: bufio.NewReader(conn), done: done}
+	t.Cleanup(client.detach)
+
+	return client
+}
+
+func (c *testClient) write(frame string) {
+	c.t.Helper()
+
+	if _, err := c.conn.Write([]byte(frame)); err != nil {
+		c.t.Fatalf("cannot write '%s': %v", frame, err)
+	}
+}
+
+func (c *testClient) readByte() byte {
+	c.t.Helper()
+
+	b, err := c.reader.ReadByte()
+
+	if err != nil {
+		c.t.Fatalf("cannot read from the stub: %v", err)
+	}
+
+	return b
+}
+
+// request sends the packet and returns the reply, checking the acks and the checksum.
+func (c *testClient) request(packet string) string {
+	c.t.Helper()
+
+	checksum := byte(0)
+
+	for i := 0; i < len(packet); i++ {
+		checksum += packet[i]
+	}
+
+	c.write(fmt.Sprintf("$%s#%02x", packet, checksum))
+
+	if ack := c.readByte(); ack != '+' {
+		c.t.Fatalf("expected the stub to ack '%s', got '%c'", packet, ack)
+	}
+
+	if start := c.readByte(); start != '$' {
+		c.t.Fatalf("expected a packet in reply to '%s', got '%c'", packet, start)
+	}
+
+	var reply strings.Builder
+	replySum := byte(0)
+
+	for b := c.readByte(); b != '#'; b = c.readByte() {
+		reply.WriteByte(b)
+		replySum += b
+	}
+
+	if sum := fmt.Sprintf("%c%c", c.readByte(), c.readByte()); sum != fmt.Sprintf("%02x", replySum) {
+		c.t.Fatalf("bad checksum %s of the reply to '%s'", sum, packet)
+	}
+
+	return reply.String()
+}
+
+func (c *testClient) expect(packet string, expected string) {
+	c.t.Helper()
+
+	if reply := c.request(packet); reply != expected {
+		c.t.Fatalf("expected '%s' in reply to '%s', got '%s'", expected, packet, reply)
+	}
+}
+
+func (c *testClient) detach() {
+	c.expect("D", "OK")
+
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("the stub failed: %v", err)
+	}
+
+	c.conn.Close()
+}
+
+func TestPackets(t *testing.T) {
+	image := easybustest.Assemble(t, cCountProgram)
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, easybustest.NewMemory(t, 256, image)))
+	client := startStub(t, sys)
+
+	if reply := client.request("qSupported:swbreak+"); !strings.Contains(reply, fmt.Sprintf("PacketSize=%x", cPacketSize)) {
+		t.Fatalf("expected the packet size in '%s'", reply)
+	}
+
+	// A corrupted packet is not acked.
+	client.write("$g#00")
+
+	if nack := client.readByte(); nack != '-' {
+		t.Fatalf("expected the bad checksum to be refused, got '%c'", nack)
+	}
+
+	client.expect("m0,4", hex.EncodeToString(image[:4]))
+	client.expect("Z0,4,2", "OK")
+	client.expect("c", "T05thread:1;swbreak:;")
+	client.expect("p10", "0004")
+	client.expect("p1", "0001")
+
+	// r1 is the second register, after r0.
+	if regs := client.request("g"); (len(regs) != 4*cRegsNumber) || (regs[4:8] != "0001") {
+		t.Fatalf("unexpected registers '%s'", regs)
+	}
+
+	client.expect("c", "T05thread:1;swbreak:;")
+	client.expect("p1", "0002")
+	client.expect("z0,4,2", "OK")
+	client.expect("P1=0100", "OK")
+	client.expect("s", "T05thread:1;")
+	client.expect("p10", "0002")
+	client.expect("s", "T05thread:1;")
+	client.expect("p1", "0101")
+
+	client.expect("M80,2:beef", "OK")
+	client.expect("m80,2", "beef")
+}
+
+// The SW at 0x80 writes the word, so the byte at 0x81 changes as well.
+func TestWatchOnSecondByte(t *testing.T) {
+	image := easybustest.Assemble(t, "xor r1 r1 r1\naddi r1 0x80\nsw r1 r1\nforever: jal r0 forever")
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, easybustest.NewMemory(t, 256, image)))
+	client := startStub(t, sys)
+
+	client.expect("Z2,81,1", "OK")
+	client.expect("c", "T05thread:1;watch:81;")
+	client.expect("p10", "0006")
+}
+
+func TestMemoryReadCappedAtPacketSize(t *testing.T) {
+	mem := easybustest.NewMemory(t, 0x4000, nil)
+	client := startStub(t, easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem)))
+
+	if reply := client.request("m0,4000"); len(reply) != cPacketSize {
+		t.Fatalf("expected the read cut at %d hex digits, got %d", cPacketSize, len(reply))
+	}
+}
+
+func TestHartsAsThreads(t *testing.T) {
+	image := easybustest.Assemble(t, cCountProgram)
+	mem := easybustest.NewMemory(t, 256, image)
+	sys := easybustest.NewSystem(t, easybustest.Opts(0, 0), easybus.MapDevice(0, mem))
+	client := startStub(t, sys)
+
+	client.expect("qfThreadInfo", "m1,2")
+	client.expect("qsThreadInfo", "l")
+	client.expect("T2", "OK")
+	client.expect("T3", "E01")
+
+	// Stepping the second hart runs the first one before it, the harts take turns.
+	client.expect("Hc2", "OK")
+	client.expect("s", "T05thread:2;")
+	client.expect("qC", "QC2")
+	client.expect("p10", "0002")
+
+	client.expect("Hg1", "OK")
+	client.expect("p10", "0002")
+	client.expect("s", "T05thread:2;")
+
+	for hart, pc := range []isa.Register{0x0004, 0x0004} {
+		if c, _ := sys.GetHart(hart); c.Pc != pc {
+			t.Fatalf("expected hart %d at %04X, got %04X", hart, pc, c.Pc)
+		}
+	}
+
+	// The register accesses follow the hart that stopped.
+	client.expect("P1=0042", "OK")
+
+	if c, _ := sys.GetHart(1); c.Registers[1] != 0x0042 {
+		t.Fatalf("expected the register write to go to the second hart, got %04X", c.Registers[1])
+	}
+}
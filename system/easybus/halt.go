@@ -0,0 +1,102 @@
+package easybus
+
+import (
+	"fmt"
+
+	"mrav/isa"
+)
+
+type HaltReason int
+
+const (
+	HALT_SELF_LOOP HaltReason = iota // Jumping or branching in place, with nothing that could interrupt it
+	HALT_EXIT                        // Exit code written to the exit device
+)
+
+type Halt struct {
+	Reason   HaltReason
+	Pc       isa.Register
+	ExitCode isa.Register // Only set for HALT_EXIT
+	Hart     int          // The hart that ran the last instruction
+}
+
+func (h *Halt) String() string {
+	if h.Reason == HALT_EXIT {
+		return fmt.Sprintf("exit with code %d at PC %04X", h.ExitCode, h.Pc)
+	}
+
+	return fmt.Sprintf("halted in a loop at PC %04X", h.Pc)
+}
+
+// Halted tells whether the program ended after the last instruction, nil if it's still running.
+func (sys *EasyBusSystem) Halted() *Halt {
+	if !sys.halted {
+		return nil
+	}
+
+	halt := sys.halt
+	return &halt
+}
+
+// updateHalt is called after every instruction. The program has halted when it requests the exit, or when none of the
+// harts can make any progress.
+func (sys *EasyBusSystem) updateHalt(previousPc isa.Register, previousRegs *isa.GeneralRegisters) {
+	for _, exitDev := range sys.exitDevices {
+		if code, requested := exitDev.ExitRequested(); requested {
+			sys.halt = Halt{Reason: HALT_EXIT, Pc: previousPc, ExitCode: code, Hart: sys.current}
+			sys.halted = true
+
+			return
+		}
+	}
+
+	sys.hart.halt, sys.hart.halted = sys.detectHalt(previousPc, previousRegs)
+	sys.halt, sys.halted = sys.hart.halt, sys.hart.halted
+
+	for _, h := range sys.harts {
+		if (h != sys.hart) && sys.runnable(h) {
+			sys.halted = false
+			return
+		}
+	}
+}
+
+// detectHalt tells whether the current hart is stuck. It is if the instruction didn't change the PC or any of the
+// registers, since the next run of the same instruction will do the same. Only an interrupt can get it out then. A
+// jump to itself that writes the link register is detected on its second run.
+func (sys *EasyBusSystem) detectHalt(previousPc isa.Register, previousRegs *isa.GeneralRegisters) (Halt, bool) {
+	if sys.hart.trapPending || (sys.core.Pc != previousPc) || (sys.core.Registers != *previousRegs) {
+		return Halt{}, false
+	}
+
+	if sys.core.InterruptsEnabled() && (sys.interruptPending() || sys.devicesActive()) {
+		return Halt{}, false
+	}
+
+	return Halt{Reason: HALT_SELF_LOOP, Pc: previousPc, Hart: sys.current}, true
+}
+
+func (sys *EasyBusSystem) devicesActive() bool {
+	for _, activeDev := range sys.activeDevices {
+		if activeDev.Active() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HaltCondition stops RunUntilStop when the program halts.
+type HaltCondition struct{}
+
+func (c *HaltCondition) Describe() string {
+	return "halt"
+}
+
+func (c *HaltCondition) Check(check *StopCheck) string {
+	if check.Halt == nil {
+		return ""
+	}
+
+	return check.Halt.String()
+}
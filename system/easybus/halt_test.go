@@ -0,0 +1,104 @@
+package easybus_test
+
+import (
+	"strings"
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/busfault"
+	"mrav/system/easybus/device/exit"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/easybustest"
+)
+
+const cExitProgram = `
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xFE
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+forever: jal r0 forever
+`
+
+// Has all the devices of memonly, with the timer right above the memory.
+func newPeripheralTestSystem(t *testing.T, source string) *easybus.EasyBusSystem {
+	t.Helper()
+
+	mem := easybustest.NewMemory(t, cTestMemSize, easybustest.Assemble(t, source))
+
+	regions := []easybus.Region{
+		easybus.MapDevice(0, mem),
+		easybus.MapDevice(cTestTimerBase, &timer.Timer{}),
+		easybus.MapDevice(exit.DEFAULT_ADDRESS, exit.NewExitDevice()),
+		easybus.MapDevice(busfault.DEFAULT_BASE, busfault.NewBusFaultUnit()),
+	}
+
+	return easybustest.NewSystem(t, easybustest.Opts(), regions...)
+}
+
+func TestHaltOnSelfJump(t *testing.T) {
+	sys := newPeripheralTestSystem(t, cLoopProgram)
+	sys.AddStopCondition(&easybus.HaltCondition{})
+
+	events, done, err := sys.RunUntilStop(1000)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected the program to halt, got %d events after %d instructions", len(events), done)
+	}
+
+	halt := sys.Halted()
+
+	if (halt.Reason != easybus.HALT_SELF_LOOP) || (halt.Pc != sys.GetCore().Pc) {
+		t.Fatalf("unexpected halt: %s", halt)
+	}
+}
+
+func TestHaltOnExit(t *testing.T) {
+	for _, fast := range []bool{false, true} {
+		sys := newPeripheralTestSystem(t, cExitProgram)
+		var done int
+		var err error
+
+		if fast {
+			done, err = sys.RunFastUntilHalt(1000)
+		} else {
+			sys.AddStopCondition(&easybus.HaltCondition{})
+			_, done, err = sys.RunUntilStop(1000)
+		}
+
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+
+		halt := sys.Halted()
+
+		if (done != 6) || (halt == nil) || (halt.Reason != easybus.HALT_EXIT) || (halt.ExitCode != 3) {
+			t.Fatalf("expected an exit with code 3 after 6 instructions (fast: %v), got %v after %d", fast, halt, done)
+		}
+	}
+}
+
+func TestNoHaltWhileWaitingForInterrupt(t *testing.T) {
+	// The main loop of the interrupt program spins in place between the interrupts.
+	source := strings.Replace(cInterruptProgram, "count: addi r5 1\njal r0 count", "wait: jal r0 wait", 1)
+	sys := newPeripheralTestSystem(t, source)
+
+	done, err := sys.RunFastUntilHalt(1000)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if sys.Halted() != nil {
+		t.Fatalf("program halted after %d instructions while the timer is running: %s", done, sys.Halted())
+	}
+
+	if sys.GetCore().Registers[6] == 0 {
+		t.Fatalf("no interrupts were handled")
+	}
+}
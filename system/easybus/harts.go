@@ -0,0 +1,141 @@
+package easybus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mrav/core"
+	"mrav/isa"
+)
+
+type ArbitrationPolicy int
+
+const (
+	ARBITRATION_ROUND_ROBIN    ArbitrationPolicy = iota // The harts take turns, one instruction each
+	ARBITRATION_FIXED_PRIORITY                          // The lowest numbered hart that can run gets the bus
+)
+
+var arbitrationPolicyNames = map[string]ArbitrationPolicy{
+	"round_robin":    ARBITRATION_ROUND_ROBIN,
+	"fixed_priority": ARBITRATION_FIXED_PRIORITY,
+}
+
+func ParseArbitrationPolicy(name string) (ArbitrationPolicy, error) {
+	policy, found := arbitrationPolicyNames[strings.ToLower(name)]
+
+	if !found {
+		names := make([]string, 0, len(arbitrationPolicyNames))
+
+		for policyName := range arbitrationPolicyNames {
+			names = append(names, policyName)
+		}
+
+		slices.Sort(names)
+
+		return 0, fmt.Errorf("unknown arbitration policy '%s', expected one of: %s", name, strings.Join(names, ", "))
+	}
+
+	return policy, nil
+}
+
+// hart is one of the cores sharing the bus, with the state the system keeps for it.
+type hart struct {
+	core     *core.Core
+	coreOpts *core.CoreOpts
+
+	trapPending bool // Set by a trapped bus fault, taken before the next instruction of this hart
+
+	// Set after the instruction that got this hart stuck.
+	halt   Halt
+	halted bool
+}
+
+// SetArbitration decides which hart gets the bus for the next instruction. The harts own the bus for a whole
+// instruction, so the instructions are never interleaved.
+func (sys *EasyBusSystem) SetArbitration(policy ArbitrationPolicy) {
+	sys.arbitration = policy
+}
+
+// HartCount returns the number of cores in the system.
+func (sys *EasyBusSystem) HartCount() int {
+	return len(sys.harts)
+}
+
+// GetHart returns the core with the given hart ID.
+func (sys *EasyBusSystem) GetHart(id int) (*core.Core, error) {
+	if (id < 0) || (id >= len(sys.harts)) {
+		return nil, fmt.Errorf("no hart with ID %d, the system has %d", id, len(sys.harts))
+	}
+
+	return sys.harts[id].core, nil
+}
+
+// CurrentHart returns the ID of the hart that ran the last instruction.
+func (sys *EasyBusSystem) CurrentHart() int {
+	return sys.current
+}
+
+// runnable tells whether the hart can make any progress, a halted hart can still be woken up by an interrupt.
+func (sys *EasyBusSystem) runnable(h *hart) bool {
+	if !h.halted || h.trapPending {
+		return true
+	}
+
+	return h.core.InterruptsEnabled() && (sys.interruptPending() || sys.devicesActive())
+}
+
+// arbitrate picks the hart for the next instruction and gives it the bus. If none of them can run, the program has
+// halted and the harts keep taking turns in the same order, spinning in place. The hart that already took the
+// interrupt for its next instruction, when RunUntilStop stopped at the vector, keeps the bus.
+func (sys *EasyBusSystem) arbitrate() {
+	if (len(sys.harts) == 1) || sys.delivered {
+		return
+	}
+
+	first := 0
+
+	if sys.arbitration == ARBITRATION_ROUND_ROBIN {
+		first = sys.nextHart
+	}
+
+	selected := first
+
+	for i := range sys.harts {
+		id := (first + i) % len(sys.harts)
+
+		if sys.runnable(sys.harts[id]) {
+			selected = id
+			break
+		}
+	}
+
+	sys.nextHart = (selected + 1) % len(sys.harts)
+	sys.selectHart(selected)
+}
+
+func (sys *EasyBusSystem) selectHart(id int) {
+	sys.current = id
+	sys.hart = sys.harts[id]
+	sys.core = sys.hart.core
+
+	for _, masterAware := range sys.masterAwareDevices {
+		masterAware.SetBusMaster(id)
+	}
+}
+
+func (sys *EasyBusSystem) hartsDebug(regsToDump []isa.RegisterId) (string, error) {
+	lines := make([]string, 0, len(sys.harts))
+
+	for id, h := range sys.harts {
+		dump, err := h.core.DebugDump(regsToDump)
+
+		if err != nil {
+			return "", fmt.Errorf("cannot dump hart %d: %w", id, err)
+		}
+
+		lines = append(lines, fmt.Sprintf("hart %d: %s", id, dump))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,150 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/core/proto"
+	"mrav/isa"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/hartid"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/easybustest"
+)
+
+// Every hart writes 0x10 plus its ID to its own mailbox word, starting at 200.
+const cMailboxProgram = `
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xF8
+lw r2 r1
+xor r3 r3 r3
+addi r3 200
+add r3 r3 r2
+add r3 r3 r2
+xor r4 r4 r4
+addi r4 0x10
+add r4 r4 r2
+sw r3 r4
+forever: jal r0 forever
+`
+
+type recordingTracer struct {
+	harts []uint32
+}
+
+func (rt *recordingTracer) Trace(record *proto.TraceRecord) error {
+	rt.harts = append(rt.harts, record.Hart)
+	return nil
+}
+
+func newMultiHartTestSystem(t *testing.T, source string, resetPcs []isa.Register, policy easybus.ArbitrationPolicy) *easybus.EasyBusSystem {
+	t.Helper()
+
+	mem := easybustest.NewMemory(t, cTestMemSize, easybustest.Assemble(t, source))
+	regions := []easybus.Region{
+		easybus.MapDevice(0, mem),
+		easybus.MapDevice(cTestTimerBase, &timer.Timer{}),
+		easybus.MapDevice(hartid.DEFAULT_ADDRESS, hartid.NewHartIdDevice()),
+	}
+
+	sys := easybustest.NewSystem(t, easybustest.Opts(resetPcs...), regions...)
+
+	sys.SetArbitration(policy)
+
+	return sys
+}
+
+func TestHartsShareTheBus(t *testing.T) {
+	sys := newMultiHartTestSystem(t, cMailboxProgram, []isa.Register{0, 0, 0}, easybus.ARBITRATION_ROUND_ROBIN)
+	tracer := &recordingTracer{}
+	sys.SetTracer(tracer)
+	sys.AddStopCondition(&easybus.HaltCondition{})
+
+	events, done, err := sys.RunUntilStop(1000)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected the program to halt, got %d events after %d instructions", len(events), done)
+	}
+
+	for id := 0; id < sys.HartCount(); id++ {
+		hartCore, err := sys.GetHart(id)
+
+		if err != nil {
+			t.Fatalf("cannot get hart %d: %v", id, err)
+		}
+
+		if hartCore.Registers[2] != isa.Register(id) {
+			t.Fatalf("hart %d read the hart ID %d", id, hartCore.Registers[2])
+		}
+
+		mailbox, err := sys.ReadMemory(isa.Register(200+2*id), 2)
+
+		if err != nil {
+			t.Fatalf("cannot read the mailbox: %v", err)
+		}
+
+		if (mailbox[0] != 0) || (mailbox[1] != byte(0x10+id)) {
+			t.Fatalf("unexpected mailbox of hart %d: %v", id, mailbox)
+		}
+	}
+
+	for i, hart := range tracer.harts {
+		if hart != uint32(i%3) {
+			t.Fatalf("instruction %d traced for hart %d, expected the harts to take turns", i, hart)
+		}
+	}
+}
+
+func TestFixedPriorityArbitration(t *testing.T) {
+	sys := newMultiHartTestSystem(t, cMailboxProgram, []isa.Register{0, 0}, easybus.ARBITRATION_FIXED_PRIORITY)
+
+	// Hart 0 keeps the bus until it gets stuck in its loop, which is noticed on the second run of the jump.
+	for i := 0; i < 14; i++ {
+		if err := sys.RunInstruction(); err != nil {
+			t.Fatalf("run failed at instruction %d: %v", i, err)
+		}
+
+		if sys.CurrentHart() != 0 {
+			t.Fatalf("instruction %d ran on hart %d", i, sys.CurrentHart())
+		}
+	}
+
+	if err := sys.RunInstruction(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if sys.CurrentHart() != 1 {
+		t.Fatalf("expected hart 1 to get the bus once hart 0 is stuck, got hart %d", sys.CurrentHart())
+	}
+}
+
+func TestMultiHartRunFastMatchesMultiturn(t *testing.T) {
+	policies := map[string]easybus.ArbitrationPolicy{
+		"round robin":    easybus.ARBITRATION_ROUND_ROBIN,
+		"fixed priority": easybus.ARBITRATION_FIXED_PRIORITY,
+	}
+
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			resetPcs := []isa.Register{0, 0}
+			multiturn := newMultiHartTestSystem(t, cMailboxProgram, resetPcs, policy)
+			fast := newMultiHartTestSystem(t, cMailboxProgram, resetPcs, policy)
+
+			for i := 0; i < 50; i++ {
+				if err := multiturn.RunInstruction(); err != nil {
+					t.Fatalf("multiturn run failed at instruction %d: %v", i, err)
+				}
+
+				if _, err := fast.RunFast(1); err != nil {
+					t.Fatalf("fast run failed at instruction %d: %v", i, err)
+				}
+
+				requireSameState(t, multiturn, fast)
+			}
+		})
+	}
+}
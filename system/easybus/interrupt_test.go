@@ -0,0 +1,168 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/isa"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/easybustest"
+)
+
+// The memory ends right below the timer registers, which the test programs reach with 8-bit immediates.
+const (
+	cTestMemSize                = 253
+	cTestTimerBase isa.Register = 253
+)
+
+// The core starts at 0x0000, which is also the handler, so the first instruction goes to main until r9 is set.
+const cVectorZeroProgram = `
+timer_ctr = 253
+timer_ctrl = 254
+timer_status = 255
+
+bnz r9 handler
+jal r0 main
+handler: addi r6 1
+xor r7 r7 r7
+addi r7 timer_status
+xor r8 r8 r8
+addi r8 2
+sw r7 r8
+reti
+main: addi r9 1
+xor r1 r1 r1
+addi r1 timer_ctr
+xor r2 r2 r2
+addi r2 5
+sw r1 r2
+addi r1 1
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+ei
+count: addi r5 1
+jal r0 count
+`
+
+func TestInterruptVectorZero(t *testing.T) {
+	mem := easybustest.NewMemory(t, cTestMemSize, easybustest.Assemble(t, cVectorZeroProgram))
+	vector := isa.Register(0x0000)
+	opts := easybustest.Opts()
+	opts.InterruptVector = &vector
+	sys := easybustest.NewSystem(t, opts, easybus.MapDevice(0, mem), easybus.MapDevice(cTestTimerBase, &timer.Timer{}))
+
+	easybustest.Run(t, sys, 50)
+
+	if regs := sys.GetCore().Registers; (regs[6] != 1) || (regs[5] == 0) {
+		t.Fatalf("expected a single interrupt handled at 0000, got r5 = %d, r6 = %d", regs[5], regs[6])
+	}
+}
+
+// Every JALR function without an instruction of its own is a plain jump, like in the RTL.
+func TestReservedJalrFunctionsJump(t *testing.T) {
+	program := `
+xor r1 r1 r1
+addi r1 target
+jalr r2 r1
+xor r3 r3 r3
+target: addi r3 1
+`
+
+	for function := isa.Register(0x4); function <= 0xF; function++ {
+		image := easybustest.Assemble(t, program)
+		image[5] |= byte(function) // The low byte of the 'jalr'
+		mem := easybustest.NewMemory(t, cTestMemSize, image)
+		sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem))
+
+		easybustest.Run(t, sys, 4)
+
+		if regs := sys.GetCore().Registers; (regs[2] != 0x0006) || (regs[3] != 1) {
+			t.Fatalf("expected JALR function %X to jump, got r2 = %04X, r3 = %d", function, regs[2], regs[3])
+		}
+	}
+}
+
+// Enables the interrupts, masks the timer with DI until it has expired, and takes it after EI.
+const cMaskedTimerProgram = `
+timer_ctr = 253
+timer_ctrl = 254
+timer_status = 255
+
+jal r0 main
+handler: addi r6 1
+xor r7 r7 r7
+addi r7 timer_status
+xor r8 r8 r8
+addi r8 2
+sw r7 r8
+reti
+main: ei
+xor r1 r1 r1
+addi r1 timer_ctr
+xor r2 r2 r2
+addi r2 20
+sw r1 r2
+addi r1 1
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+di
+xor r3 r3 r3
+addi r3 1
+xor r4 r4 r4
+addi r4 40
+masked: sub r4 r4 r3
+bnz r4 masked
+ei
+count: addi r5 1
+jal r0 count
+`
+
+const (
+	cMaskedTimerReti isa.Register = 0x000E
+	cMaskedTimerEi   isa.Register = 0x0032
+	cMaskedTimerLoop isa.Register = 0x0034
+)
+
+func stepUntil(t *testing.T, sys *easybus.EasyBusSystem, done func() bool) {
+	t.Helper()
+
+	for i := 0; i < 200; i++ {
+		if done() {
+			return
+		}
+
+		easybustest.Run(t, sys, 1)
+	}
+
+	t.Fatalf("condition not reached, PC = %04X", sys.GetCore().Pc)
+}
+
+func TestInterruptMaskedUntilEi(t *testing.T) {
+	tmr := &timer.Timer{}
+	mem := easybustest.NewMemory(t, cTestMemSize, easybustest.Assemble(t, cMaskedTimerProgram))
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem), easybus.MapDevice(cTestTimerBase, tmr))
+	c := sys.GetCore()
+
+	stepUntil(t, sys, func() bool { return c.Pc == cMaskedTimerEi })
+
+	if !tmr.InterruptPending() || c.InterruptsEnabled() || (c.Registers[6] != 0) {
+		t.Fatalf("expected the expired timer to be masked by DI, got pending = %v, enabled = %v, r6 = %d",
+			tmr.InterruptPending(), c.InterruptsEnabled(), c.Registers[6])
+	}
+
+	stepUntil(t, sys, func() bool { return c.Pc < cMaskedTimerReti })
+
+	if (c.Epc != cMaskedTimerLoop) || c.InterruptsEnabled() {
+		t.Fatalf("expected the interrupt after EI with EPC = %04X and the interrupts disabled, got EPC = %04X, enabled = %v",
+			cMaskedTimerLoop, c.Epc, c.InterruptsEnabled())
+	}
+
+	stepUntil(t, sys, func() bool { return c.Pc >= cMaskedTimerLoop })
+
+	if (c.Pc != cMaskedTimerLoop) || !c.InterruptsEnabled() || (c.Registers[6] != 1) || tmr.InterruptPending() {
+		t.Fatalf("expected RETI to %04X with the interrupts enabled, got PC = %04X, enabled = %v, r6 = %d",
+			cMaskedTimerLoop, c.Pc, c.InterruptsEnabled(), c.Registers[6])
+	}
+}
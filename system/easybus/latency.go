@@ -0,0 +1,53 @@
+package easybus
+
+import (
+	"slices"
+
+	"mrav/core"
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// waitStates returns the extra cycles the device at the address takes for the transaction.
+func (sys *EasyBusSystem) waitStates(address isa.Register, write bool) int {
+	region, offset, found := sys.memoryMap.Lookup(address)
+
+	if !found {
+		return 0
+	}
+
+	if latency, ok := region.Device.(device.Latency); ok {
+		return latency.WaitStates(offset, write)
+	}
+
+	return 0
+}
+
+// stallBus runs the wait states of the bus access, the cycles before the one that completes it.
+func (sys *EasyBusSystem) stallBus(busAccess *isa.BusAccess, signals []core.ExecutionSignal) error {
+	cycle := waveBusCycle{waiting: true}
+
+	if busAccess.Write != nil {
+		cycle.state = cWaveCoreSwWrite
+		cycle.address = busAccess.Write.Address
+		cycle.value = busAccess.Write.Value
+	} else if busAccess.Read != nil {
+		cycle.state = cWaveCoreReady
+		cycle.address = busAccess.Read.Address
+
+		if slices.Contains(signals, core.SIGNAL_LOADING_DATA) {
+			cycle.state = cWaveCoreLwRead
+		}
+	}
+
+	for i := sys.waitStates(cycle.address, busAccess.Write != nil); i > 0; i-- {
+		sys.tickCycle()
+		sys.sampleWaveform()
+
+		if err := sys.recordWaveform(&cycle); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+// The wait states only delay the data accesses, the load still reads what the store wrote.
+func TestWaitStatesKeepTheData(t *testing.T) {
+	paths := map[string]func(testing.TB, *easybus.EasyBusSystem, int){
+		"multiturn": easybustest.Run,
+		"fast":      easybustest.RunFast,
+	}
+
+	for path, run := range paths {
+		t.Run(path, func(t *testing.T) {
+			sys := newTestSystemWithWaitStates(t, easybustest.Assemble(t, cDataAccessProgram), 2)
+
+			run(t, sys, 4)
+
+			if got := sys.GetCore().Registers[4]; got != 200 {
+				t.Fatalf("expected r4 = 200, got %d", got)
+			}
+		})
+	}
+}
+
+// The timer keeps counting during the wait states, so the interrupts come in after fewer instructions.
+func TestWaitStatesRunFastMatchesMultiturn(t *testing.T) {
+	image := easybustest.Assemble(t, cInterruptProgram)
+	multiturn := newTestSystemWithWaitStates(t, image, 3)
+	fast := newTestSystemWithWaitStates(t, image, 3)
+
+	for i := 0; i < 500; i++ {
+		easybustest.Run(t, multiturn, 1)
+		easybustest.RunFast(t, fast, 1)
+
+		requireSameState(t, multiturn, fast)
+	}
+
+	if regs := fast.GetCore().Registers; regs[6] == 0 {
+		t.Fatalf("expected the timer interrupts to be taken, got r6 = %d", regs[6])
+	}
+}
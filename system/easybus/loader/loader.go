@@ -0,0 +1,259 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"mrav/isa"
+	"mrav/system"
+	"mrav/system/description"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device"
+	"mrav/system/easybus/device/busfault"
+	"mrav/system/easybus/device/exit"
+	"mrav/system/easybus/device/gpio"
+	"mrav/system/easybus/device/hartid"
+	"mrav/system/easybus/device/memory"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/device/uart"
+)
+
+// The image parameter of a memory with this value loads the software binary given to NewSystem.
+const SOFTWARE_IMAGE = "software"
+
+// NewSystem builds the system with the simulated devices from the description, placed at their base addresses. The
+// device types are:
+//
+//   - memory: RAM of the given size, with the "image" parameter naming the binary to preload, either SOFTWARE_IMAGE or
+//     a file path relative to the description, and the "wait_states" for the extra cycles of every access
+//   - rom: read-only memory with the same parameters, and the "write_policy", fault (the default) or ignore
+//   - uart: with the "backend" parameter (none by default, stdio, pty or file), the "input" and "output" files
+//     for the file backend, and the "divider", the backend is closed by the Close of the system
+//   - gpio: with the "inputs" script and the "log" file for the output changes, both optional, the log is closed by
+//     the Close of the system
+//   - timer, exit, busfault, hartid: the peripherals of the same names
+//
+// The software binary is optional, but some memory has to load it when it's given.
+func NewSystem(desc *description.System, opts *system.SystemOpts, software []byte) (*easybus.EasyBusSystem, error) {
+	var regions []easybus.Region
+	softwareLoaded := false
+
+	for _, devDesc := range desc.Devices {
+		if !devDesc.In(description.TARGET_SIMULATION) {
+			continue
+		}
+
+		dev, loadsSoftware, err := newDevice(desc, devDesc, opts, software)
+
+		if err != nil {
+			closeDevices(regions)
+			return nil, fmt.Errorf("cannot create the device '%s': %w", devDesc.Id, err)
+		}
+
+		softwareLoaded = softwareLoaded || loadsSoftware
+
+		regions = append(regions, easybus.Region{
+			Base:   isa.Register(devDesc.Base),
+			Size:   devDesc.Size,
+			Device: dev,
+		})
+	}
+
+	if (software != nil) && !softwareLoaded {
+		closeDevices(regions)
+		return nil, fmt.Errorf("none of the memories in the system description loads the software image")
+	}
+
+	sys, err := easybus.NewEasyBusSystem(opts, regions)
+
+	if err != nil {
+		closeDevices(regions)
+		return nil, err
+	}
+
+	return sys, nil
+}
+
+// closeDevices releases the files and the other resources the devices created so far hold, when there is no system
+// to close them.
+func closeDevices(regions []easybus.Region) {
+	for _, region := range regions {
+		if closer, ok := region.Device.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+func newDevice(desc *description.System, devDesc *description.Device, opts *system.SystemOpts, software []byte) (device.Device, bool, error) {
+	switch devDesc.Type {
+	case "memory":
+		image, loadsSoftware, err := memoryImage(desc, devDesc, software)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		mem, err := memory.NewMem(devDesc.Size, image)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		waitStates, err := memoryWaitStates(devDesc)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		mem.SetWaitStates(waitStates)
+
+		return mem, loadsSoftware, nil
+	case "rom":
+		rom, loadsSoftware, err := newRom(desc, devDesc, software)
+		return rom, loadsSoftware, err
+	case "timer":
+		return &timer.Timer{}, false, nil
+	case "exit":
+		return exit.NewExitDevice(), false, nil
+	case "busfault":
+		return busfault.NewBusFaultUnit(), false, nil
+	case "hartid":
+		return hartid.NewHartIdDevice(), false, nil
+	case "uart":
+		dev, err := newUart(desc, devDesc, opts)
+		return dev, false, err
+	case "gpio":
+		dev, err := newGpio(desc, devDesc)
+		return dev, false, err
+	}
+
+	return nil, false, fmt.Errorf("the simulator has no device of type '%s', it can be marked for the RTL target only", devDesc.Type)
+}
+
+func memoryImage(desc *description.System, devDesc *description.Device, software []byte) ([]byte, bool, error) {
+	imagePath, found := devDesc.Param("image")
+
+	if !found {
+		return nil, false, nil
+	}
+
+	if imagePath == SOFTWARE_IMAGE {
+		return software, true, nil
+	}
+
+	image, err := os.ReadFile(desc.Path(imagePath))
+
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot load the memory image: %w", err)
+	}
+
+	return image, false, nil
+}
+
+func memoryWaitStates(devDesc *description.Device) (int, error) {
+	waitStatesParam, found := devDesc.Param("wait_states")
+
+	if !found {
+		return 0, nil
+	}
+
+	waitStates, err := strconv.ParseUint(waitStatesParam, 0, 16)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid wait states: %w", err)
+	}
+
+	return int(waitStates), nil
+}
+
+func newRom(desc *description.System, devDesc *description.Device, software []byte) (*memory.Rom, bool, error) {
+	image, loadsSoftware, err := memoryImage(desc, devDesc, software)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	policy := memory.ROM_WRITE_FAULT
+
+	if policyParam, found := devDesc.Param("write_policy"); found {
+		policy, err = memory.ParseRomWritePolicy(policyParam)
+
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	rom, err := memory.NewRom(devDesc.Size, image, policy)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	waitStates, err := memoryWaitStates(devDesc)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	rom.SetWaitStates(waitStates)
+
+	return rom, loadsSoftware, nil
+}
+
+func newUart(desc *description.System, devDesc *description.Device, opts *system.SystemOpts) (*uart.Uart, error) {
+	divider := uint64(0)
+
+	if dividerParam, found := devDesc.Param("divider"); found {
+		value, err := strconv.ParseUint(dividerParam, 0, 16)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid divider: %w", err)
+		}
+
+		divider = value
+	}
+
+	kind, found := devDesc.Param("backend")
+
+	if !found {
+		kind = "none"
+	}
+
+	var inputPath, outputPath string
+
+	if input, found := devDesc.Param("input"); found {
+		inputPath = desc.Path(input)
+	}
+
+	if output, found := devDesc.Param("output"); found {
+		outputPath = desc.Path(output)
+	}
+
+	backend, err := uart.OpenBackend(kind, inputPath, outputPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pty, ok := backend.(*uart.PtyBackend); ok {
+		opts.Logger.Info("[System] UART connected to a pseudo-terminal", "device", devDesc.Id, "path", pty.Path)
+	}
+
+	return uart.NewUart(backend, isa.Register(divider)), nil
+}
+
+func newGpio(desc *description.System, devDesc *description.Device) (*gpio.Gpio, error) {
+	var scriptPath, logPath string
+
+	if inputs, found := devDesc.Param("inputs"); found {
+		scriptPath = desc.Path(inputs)
+	}
+
+	if log, found := devDesc.Param("log"); found {
+		logPath = desc.Path(log)
+	}
+
+	return gpio.NewGpioFromFiles(scriptPath, logPath)
+}
@@ -0,0 +1,153 @@
+package loader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mrav/system/description"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/easybustest"
+)
+
+const cExitProgram = `
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xFE
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+forever: jal r0 forever
+`
+
+func TestMemonlySystem(t *testing.T) {
+	desc, err := description.ReadFromFile("../../binaries/memonly/memonly_system.json")
+
+	if err != nil {
+		t.Fatalf("cannot load the description: %v", err)
+	}
+
+	sys, err := NewSystem(desc, easybustest.Opts(), easybustest.Assemble(t, cExitProgram))
+
+	if err != nil {
+		t.Fatalf("cannot create the system: %v", err)
+	}
+
+	if len(sys.MemoryMap().Regions()) != len(desc.Devices) {
+		t.Fatalf("expected %d devices on the bus, got %d", len(desc.Devices), len(sys.MemoryMap().Regions()))
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if halt := sys.Halted(); (halt == nil) || (halt.ExitCode != 3) {
+		t.Fatalf("expected the program to exit with code 3, got %v", halt)
+	}
+}
+
+func TestRtlOnlyDevices(t *testing.T) {
+	text := `{"devices": [
+  {"id": "mem", "type": "memory", "base": 0, "size": 96, "params": {"image": "software"}},
+  {"id": "gpio", "type": "led_driver", "base": "0x70", "size": 1, "targets": ["rtl"]}
+]}`
+
+	desc, err := description.Parse([]byte(text))
+
+	if err != nil {
+		t.Fatalf("cannot parse the description: %v", err)
+	}
+
+	sys, err := NewSystem(desc, easybustest.Opts(), nil)
+
+	if err != nil {
+		t.Fatalf("cannot create the system: %v", err)
+	}
+
+	if len(sys.MemoryMap().Regions()) != 1 {
+		t.Fatalf("expected only the memory to be simulated")
+	}
+
+	desc.Devices[1].Targets = nil
+
+	if _, err := NewSystem(desc, easybustest.Opts(), nil); (err == nil) || !strings.Contains(err.Error(), "led_driver") {
+		t.Fatalf("expected the unknown device type to be rejected, got %v", err)
+	}
+}
+
+type closerDevice struct {
+	timer.Timer
+	closed bool
+}
+
+func (d *closerDevice) Close() error {
+	d.closed = true
+	return nil
+}
+
+// The devices holding resources are closed when the system can't be built, nothing else would close them.
+func TestCloseDevicesOnError(t *testing.T) {
+	dev := &closerDevice{}
+	closeDevices([]easybus.Region{easybus.MapDevice(0, &timer.Timer{}), easybus.MapDevice(0x10, dev)})
+
+	if !dev.closed {
+		t.Fatalf("expected the device to be closed")
+	}
+}
+
+// Runs from the ROM, tries to overwrite it, and exits with the value stored in the RAM.
+const cRomProgram = `
+xor r1 r1 r1
+ldhi r1 0x04
+xor r2 r2 r2
+addi r2 3
+sw r1 r2
+xor r3 r3 r3
+sw r3 r2
+lw r4 r1
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xFE
+sw r1 r4
+forever: jal r0 forever
+`
+
+func TestRomAndRam(t *testing.T) {
+	text := `{"devices": [
+  {"id": "rom", "type": "rom", "base": 0, "size": 64, "params": {"image": "software", "write_policy": "ignore"}},
+  {"id": "ram", "type": "memory", "base": "0x0400", "size": 256, "params": {"wait_states": "1"}},
+  {"id": "exit", "type": "exit", "base": "0xFFFE", "size": 1}
+]}`
+
+	desc, err := description.Parse([]byte(text))
+
+	if err != nil {
+		t.Fatalf("cannot parse the description: %v", err)
+	}
+
+	image := easybustest.Assemble(t, cRomProgram)
+	sys, err := NewSystem(desc, easybustest.Opts(), image)
+
+	if err != nil {
+		t.Fatalf("cannot create the system: %v", err)
+	}
+
+	if _, err := sys.RunFastUntilHalt(100); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if halt := sys.Halted(); (halt == nil) || (halt.ExitCode != 3) {
+		t.Fatalf("expected the program to exit with code 3, got %v", halt)
+	}
+
+	rom, err := sys.ReadMemory(0, 2)
+
+	if err != nil {
+		t.Fatalf("cannot read the ROM: %v", err)
+	}
+
+	if !bytes.Equal(rom, image[:2]) {
+		t.Fatalf("expected the ROM to keep the image, got %v", rom)
+	}
+}
@@ -0,0 +1,174 @@
+package easybus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// Region places a device on the bus. The device sees the addresses in the region as the offsets from the base.
+type Region struct {
+	Base   isa.Register
+	Size   int
+	Device device.Device
+}
+
+// MapDevice is the region covering the whole device at the base address.
+func MapDevice(base isa.Register, dev device.Device) Region {
+	return Region{
+		Base:   base,
+		Size:   dev.Size(),
+		Device: dev,
+	}
+}
+
+// Last is the highest bus address in the region.
+func (r *Region) Last() isa.Register {
+	return r.Base + isa.Register(r.Size-1)
+}
+
+func (r *Region) String() string {
+	return fmt.Sprintf("%s [%04X-%04X]", r.Device.Name(), r.Base, r.Last())
+}
+
+// Gap is a range of the bus addresses without a device.
+type Gap struct {
+	Base isa.Register
+	Size int
+}
+
+// MemoryMap is the layout of the devices on the bus, checked when the system is built.
+type MemoryMap struct {
+	regions []Region // Sorted by the base address
+}
+
+// NewMemoryMap validates the regions: every one of them must fit on the bus and within the addresses its device
+// decodes, and none of them can overlap.
+func NewMemoryMap(regions []Region) (*MemoryMap, error) {
+	sorted := slices.Clone(regions)
+
+	for i := range sorted {
+		region := &sorted[i]
+
+		if region.Device == nil {
+			return nil, fmt.Errorf("no device in the region at %04X", region.Base)
+		}
+
+		if region.Size <= 0 {
+			return nil, fmt.Errorf("region of %s at %04X has no addresses, size %d", region.Device.Name(), region.Base, region.Size)
+		}
+
+		if region.Size > region.Device.Size() {
+			return nil, fmt.Errorf("region %s is larger than the %d addresses of the device", region.String(), region.Device.Size())
+		}
+
+		if int(region.Base)+region.Size > cBusAddresses {
+			return nil, fmt.Errorf("region of %s at %04X with %d addresses doesn't fit on the bus", region.Device.Name(), region.Base, region.Size)
+		}
+	}
+
+	slices.SortStableFunc(sorted, func(a, b Region) int {
+		return int(a.Base) - int(b.Base)
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Base <= sorted[i-1].Last() {
+			return nil, fmt.Errorf("regions %s and %s overlap", sorted[i-1].String(), sorted[i].String())
+		}
+	}
+
+	return &MemoryMap{
+		regions: sorted,
+	}, nil
+}
+
+// Regions returns the regions sorted by the base address.
+func (m *MemoryMap) Regions() []Region {
+	return m.regions
+}
+
+// Lookup finds the region with the address, and the offset of the address within it.
+func (m *MemoryMap) Lookup(address isa.Register) (*Region, isa.BusValue, bool) {
+	idx, found := m.lookupIndex(address)
+
+	if !found {
+		return nil, 0, false
+	}
+
+	region := &m.regions[idx]
+
+	return region, isa.BusValue(address - region.Base), true
+}
+
+func (m *MemoryMap) lookupIndex(address isa.Register) (int, bool) {
+	return slices.BinarySearchFunc(m.regions, address, func(r Region, target isa.Register) int {
+		if r.Last() < target {
+			return -1
+		}
+
+		if r.Base > target {
+			return 1
+		}
+
+		return 0
+	})
+}
+
+// Gaps returns the ranges of the bus addresses that no device decodes, accessing them is a bus fault.
+func (m *MemoryMap) Gaps() []Gap {
+	var gaps []Gap
+	next := 0
+
+	for _, region := range m.regions {
+		if int(region.Base) > next {
+			gaps = append(gaps, Gap{Base: isa.Register(next), Size: int(region.Base) - next})
+		}
+
+		next = int(region.Base) + region.Size
+	}
+
+	if next < cBusAddresses {
+		gaps = append(gaps, Gap{Base: isa.Register(next), Size: cBusAddresses - next})
+	}
+
+	return gaps
+}
+
+// CheckMapped fails if any of the addresses from lo to hi is in a gap. The memory map itself allows the gaps, the same
+// as the RTL bus leaves the addresses without a device unconnected, and the accesses to them are handled by the bus
+// fault policy. The systems that expect a range to be fully decoded check it here.
+func (m *MemoryMap) CheckMapped(lo isa.Register, hi isa.Register) error {
+	for _, gap := range m.Gaps() {
+		last := gap.Base + isa.Register(gap.Size-1)
+
+		if (gap.Base <= hi) && (last >= lo) {
+			return fmt.Errorf("addresses %04X-%04X are not mapped", max(gap.Base, lo), min(last, hi))
+		}
+	}
+
+	return nil
+}
+
+// String lists the regions and the gaps between them, one per line.
+func (m *MemoryMap) String() string {
+	var sb strings.Builder
+	gaps := m.Gaps()
+
+	for _, region := range m.regions {
+		for (len(gaps) > 0) && (gaps[0].Base < region.Base) {
+			fmt.Fprintf(&sb, "%04X-%04X  (unmapped)\n", gaps[0].Base, int(gaps[0].Base)+gaps[0].Size-1)
+			gaps = gaps[1:]
+		}
+
+		fmt.Fprintf(&sb, "%04X-%04X  %s\n", region.Base, region.Last(), region.Device.Name())
+	}
+
+	for _, gap := range gaps {
+		fmt.Fprintf(&sb, "%04X-%04X  (unmapped)\n", gap.Base, int(gap.Base)+gap.Size-1)
+	}
+
+	return sb.String()
+}
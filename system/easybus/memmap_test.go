@@ -0,0 +1,122 @@
+package easybus_test
+
+import (
+	"strings"
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/exit"
+	"mrav/system/easybus/device/timer"
+	"mrav/system/easybus/easybustest"
+)
+
+func TestMemoryMapRejectsOverlaps(t *testing.T) {
+	mem := easybustest.NewMemory(t, 1024, nil)
+
+	_, err := easybus.NewMemoryMap([]easybus.Region{easybus.MapDevice(0, mem), easybus.MapDevice(cTestTimerBase, &timer.Timer{})})
+
+	if (err == nil) || !strings.Contains(err.Error(), "overlap") {
+		t.Fatalf("expected the timer inside the memory to be rejected, got %v", err)
+	}
+}
+
+func TestMemoryMapRejectsBadRegions(t *testing.T) {
+	regions := map[string]easybus.Region{
+		"past the end of the bus": easybus.MapDevice(0xFFFE, &timer.Timer{}),
+		"larger than the device":  {Base: 0x100, Size: 16, Device: &timer.Timer{}},
+		"empty":                   {Base: 0x100, Size: 0, Device: &timer.Timer{}},
+	}
+
+	for name, region := range regions {
+		if _, err := easybus.NewMemoryMap([]easybus.Region{region}); err == nil {
+			t.Errorf("expected the region %s to be rejected", name)
+		}
+	}
+}
+
+func TestMemoryMapGaps(t *testing.T) {
+	mem := easybustest.NewMemory(t, cTestMemSize, nil)
+
+	memoryMap, err := easybus.NewMemoryMap([]easybus.Region{
+		easybus.MapDevice(exit.DEFAULT_ADDRESS, exit.NewExitDevice()),
+		easybus.MapDevice(0, mem),
+		easybus.MapDevice(0x200, &timer.Timer{}),
+	})
+
+	if err != nil {
+		t.Fatalf("cannot create the memory map: %v", err)
+	}
+
+	expected := []easybus.Gap{
+		{Base: cTestMemSize, Size: 0x200 - cTestMemSize},
+		{Base: 0x206, Size: int(exit.DEFAULT_ADDRESS) - 0x206},
+		{Base: 0xFFFF, Size: 1},
+	}
+	gaps := memoryMap.Gaps()
+
+	if len(gaps) != len(expected) {
+		t.Fatalf("expected %d gaps, got %v", len(expected), gaps)
+	}
+
+	for i := range expected {
+		if gaps[i] != expected[i] {
+			t.Fatalf("expected gap %d to be %v, got %v", i, expected[i], gaps[i])
+		}
+	}
+
+	region, offset, found := memoryMap.Lookup(0x202)
+
+	if !found || (region.Device.Name() != "Timer") || (offset != 2) {
+		t.Fatalf("expected the timer status register at 0202, got %v, offset %d", region, offset)
+	}
+
+	if _, _, found := memoryMap.Lookup(0x206); found {
+		t.Fatalf("expected 0206 to be unmapped")
+	}
+}
+
+func TestRelocatedTimer(t *testing.T) {
+	program := `
+xor r1 r1 r1
+ldhi r1 0x01
+xor r2 r2 r2
+addi r2 42
+sw r1 r2
+lw r3 r1
+forever: jal r0 forever
+`
+
+	mem := easybustest.NewMemory(t, cTestMemSize, easybustest.Assemble(t, program))
+
+	tim := &timer.Timer{}
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem), easybus.MapDevice(0x100, tim))
+
+	easybustest.RunFast(t, sys, 6)
+
+	if sys.GetCore().Registers[3] != 42 {
+		t.Fatalf("expected to read back the counter of the timer at 0100, got %d", sys.GetCore().Registers[3])
+	}
+}
+
+func TestMemoryMapCheckMapped(t *testing.T) {
+	mem := easybustest.NewMemory(t, cTestMemSize, nil)
+
+	memoryMap, err := easybus.NewMemoryMap([]easybus.Region{
+		easybus.MapDevice(0, mem),
+		easybus.MapDevice(0x200, &timer.Timer{}),
+	})
+
+	if err != nil {
+		t.Fatalf("cannot create the memory map: %v", err)
+	}
+
+	if err := memoryMap.CheckMapped(0, cTestMemSize-1); err != nil {
+		t.Fatalf("expected the memory to be mapped, got %v", err)
+	}
+
+	err = memoryMap.CheckMapped(0x00F0, 0x0201)
+
+	if (err == nil) || !strings.Contains(err.Error(), "00FD-01FF") {
+		t.Fatalf("expected the gap between the memory and the timer to be reported, got %v", err)
+	}
+}
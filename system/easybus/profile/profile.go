@@ -0,0 +1,352 @@
+package profile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"mrav/isa"
+	"mrav/software/symbols"
+	"mrav/system/easybus"
+	"mrav/system/easybus/profile/proto"
+)
+
+// Deeper calls are treated as plain jumps, so the code that never returns doesn't grow the stack forever.
+const cMaxDepth = 64
+
+type counts struct {
+	instructions int64
+	cycles       int64
+}
+
+type callKey struct {
+	callSite isa.Register
+	entry    isa.Register
+}
+
+// node is a distinct call stack, the counts are kept for every PC run with that stack.
+type node struct {
+	parent   *node
+	callSite isa.Register // PC of the call in the parent, or of the interrupted instruction
+	entry    isa.Register // Where the function was entered
+	children map[callKey]*node
+	counts   map[isa.Register]*counts
+}
+
+func newNode(parent *node, callSite isa.Register, entry isa.Register) *node {
+	return &node{
+		parent:   parent,
+		callSite: callSite,
+		entry:    entry,
+		children: make(map[callKey]*node),
+		counts:   make(map[isa.Register]*counts),
+	}
+}
+
+type frame struct {
+	node     *node
+	returnPc isa.Register // Unused for the root frame
+}
+
+// Profiler collects the instruction and cycle counts per PC and call stack, for 'go tool pprof'.
+//
+// The call stacks are reconstructed from the link register usage: a jump that keeps the return address (jal or jalr
+// with rd other than r0) is a call, and a jump to the return address of a call on the stack, usually 'jalr r0 r15',
+// returns from it. Interrupt and trap handlers are called from the interrupted instruction and return with 'reti'.
+type Profiler struct {
+	syms   *symbols.SymbolMap
+	roots  []*node   // Per hart
+	stacks [][]frame // Per hart, the root frame first
+}
+
+// NewProfiler creates a profiler that names the functions after the labels from the symbol map. The symbol map is
+// optional, the addresses are used instead without it.
+func NewProfiler(syms *symbols.SymbolMap) *Profiler {
+	return &Profiler{
+		syms: syms,
+	}
+}
+
+func (p *Profiler) stack(hart int, pc isa.Register) []frame {
+	for len(p.stacks) <= hart {
+		p.roots = append(p.roots, nil)
+		p.stacks = append(p.stacks, nil)
+	}
+
+	// The root is the function the hart started from.
+	if p.roots[hart] == nil {
+		p.roots[hart] = newNode(nil, 0, pc)
+		p.stacks[hart] = []frame{{node: p.roots[hart]}}
+	}
+
+	return p.stacks[hart]
+}
+
+func push(stack []frame, callSite isa.Register, entry isa.Register, returnPc isa.Register) []frame {
+	if len(stack) >= cMaxDepth {
+		return stack
+	}
+
+	parent := stack[len(stack)-1].node
+	key := callKey{callSite: callSite, entry: entry}
+	child, found := parent.children[key]
+
+	if !found {
+		child = newNode(parent, callSite, entry)
+		parent.children[key] = child
+	}
+
+	return append(stack, frame{node: child, returnPc: returnPc})
+}
+
+// Profile implements easybus.Profiler.
+func (p *Profiler) Profile(instr *easybus.ExecutedInstruction) {
+	stack := p.stack(instr.Hart, instr.Pc)
+
+	if instr.Interrupted {
+		stack = push(stack, instr.ReturnPc, instr.Pc, instr.ReturnPc)
+	}
+
+	current := stack[len(stack)-1].node
+	pcCounts, found := current.counts[instr.Pc]
+
+	if !found {
+		pcCounts = &counts{}
+		current.counts[instr.Pc] = pcCounts
+	}
+
+	pcCounts.instructions++
+	pcCounts.cycles += int64(instr.Cycles)
+
+	spec := instr.Instruction.Spec
+	isJump := spec.Semantics == isa.SEMANTICS_JUMP
+	returned := false
+
+	if isJump || ((spec.Opcode == isa.JALR) && (spec.Function == isa.JALR_RETI)) {
+		for i := len(stack) - 1; i > 0; i-- {
+			if stack[i].returnPc == instr.NextPc {
+				stack = stack[:i]
+				returned = true
+
+				break
+			}
+		}
+	}
+
+	// Jumping in place to halt is not a call, even with the link kept.
+	if isJump && !returned && (instr.Instruction.Rd != 0) && (instr.NextPc != instr.Pc) {
+		stack = push(stack, instr.Pc, instr.NextPc, instr.Pc+isa.INSTRUCTION_SIZE)
+	}
+
+	p.stacks[instr.Hart] = stack
+}
+
+// builder assigns the IDs of the functions, the locations and the strings while the profile is put together.
+type builder struct {
+	syms      *symbols.SymbolMap
+	profile   *proto.Profile
+	strings   map[string]int64
+	functions map[string]uint64
+	locations map[callKey]uint64 // By the PC and the function entry
+}
+
+func (b *builder) str(s string) int64 {
+	if idx, found := b.strings[s]; found {
+		return idx
+	}
+
+	idx := int64(len(b.profile.StringTable))
+	b.profile.StringTable = append(b.profile.StringTable, s)
+	b.strings[s] = idx
+
+	return idx
+}
+
+func (b *builder) function(name string) uint64 {
+	if id, found := b.functions[name]; found {
+		return id
+	}
+
+	id := uint64(len(b.profile.Function) + 1)
+	b.profile.Function = append(b.profile.Function, &proto.Function{
+		Id:         id,
+		Name:       b.str(name),
+		SystemName: b.str(name),
+	})
+	b.functions[name] = id
+
+	return id
+}
+
+func (b *builder) functionName(entry isa.Register) string {
+	if b.syms != nil {
+		if name, found := b.syms.LabelAt(entry); found {
+			return name
+		}
+
+		if description := b.syms.Describe(entry); description != "" {
+			return description
+		}
+	}
+
+	return fmt.Sprintf("%04X", entry)
+}
+
+// location is the PC within the function entered at the entry address. The label right before the PC, like the one
+// of a loop, is shown as a function inlined into it.
+func (b *builder) location(pc isa.Register, entry isa.Register) uint64 {
+	key := callKey{callSite: pc, entry: entry}
+
+	if id, found := b.locations[key]; found {
+		return id
+	}
+
+	var lines []*proto.Line
+	functionName := b.functionName(entry)
+
+	if b.syms != nil {
+		if label, found := b.syms.Enclosing(pc); found && (label.Name != functionName) && (isa.Register(label.Address) > entry) {
+			lines = append(lines, &proto.Line{FunctionId: b.function(label.Name)})
+		}
+	}
+
+	lines = append(lines, &proto.Line{FunctionId: b.function(functionName)})
+
+	id := uint64(len(b.profile.Location) + 1)
+	b.profile.Location = append(b.profile.Location, &proto.Location{
+		Id:        id,
+		MappingId: 1,
+		Address:   uint64(pc),
+		Line:      lines,
+	})
+	b.locations[key] = id
+
+	return id
+}
+
+func (b *builder) addSamples(n *node, hart int) {
+	// The leaf is filled in for every PC, the callers are the same for all of them.
+	callers := []uint64{0}
+
+	for caller := n; caller.parent != nil; caller = caller.parent {
+		callers = append(callers, b.location(caller.callSite, caller.parent.entry))
+	}
+
+	pcs := make([]isa.Register, 0, len(n.counts))
+
+	for pc := range n.counts {
+		pcs = append(pcs, pc)
+	}
+
+	slices.Sort(pcs)
+
+	for _, pc := range pcs {
+		locationIds := slices.Clone(callers)
+		locationIds[0] = b.location(pc, n.entry)
+
+		b.profile.Sample = append(b.profile.Sample, &proto.Sample{
+			LocationId: locationIds,
+			Value:      []int64{n.counts[pc].instructions, n.counts[pc].cycles},
+			Label:      []*proto.Label{{Key: b.str("hart"), Num: int64(hart)}},
+		})
+	}
+
+	children := make([]callKey, 0, len(n.children))
+
+	for key := range n.children {
+		children = append(children, key)
+	}
+
+	slices.SortFunc(children, func(a, b callKey) int {
+		if a.callSite != b.callSite {
+			return int(a.callSite) - int(b.callSite)
+		}
+
+		return int(a.entry) - int(b.entry)
+	})
+
+	for _, key := range children {
+		b.addSamples(n.children[key], hart)
+	}
+}
+
+// Build puts together the profile collected so far.
+func (p *Profiler) Build() *proto.Profile {
+	b := &builder{
+		syms:      p.syms,
+		profile:   &proto.Profile{StringTable: []string{""}},
+		strings:   map[string]int64{"": 0},
+		functions: make(map[string]uint64),
+		locations: make(map[callKey]uint64),
+	}
+
+	b.profile.SampleType = []*proto.ValueType{
+		{Type: b.str("instructions"), Unit: b.str("count")},
+		{Type: b.str("cycles"), Unit: b.str("count")},
+	}
+	b.profile.PeriodType = &proto.ValueType{Type: b.str("cycles"), Unit: b.str("count")}
+	b.profile.Period = 1
+	b.profile.DefaultSampleType = b.str("cycles")
+
+	// The functions are already known, pprof shouldn't try to symbolize the addresses.
+	b.profile.Mapping = []*proto.Mapping{{
+		Id:           1,
+		MemoryStart:  0,
+		MemoryLimit:  1 << 16,
+		Filename:     b.str("mrav"),
+		HasFunctions: true,
+	}}
+
+	for hart, root := range p.roots {
+		if root != nil {
+			b.addSamples(root, hart)
+		}
+	}
+
+	return b.profile
+}
+
+// Encode writes the gzipped profile, the format 'go tool pprof' reads.
+func (p *Profiler) Encode(w io.Writer) error {
+	profileBytes, err := protobuf.Marshal(p.Build())
+
+	if err != nil {
+		return fmt.Errorf("cannot encode the profile, proto error: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+
+	if _, err := gz.Write(profileBytes); err != nil {
+		return fmt.Errorf("cannot compress the profile: %w", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("cannot compress the profile: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Profiler) WriteToFile(filePath string) error {
+	profileFile, err := os.Create(filePath)
+
+	if err != nil {
+		return fmt.Errorf("cannot create the profile file: %w", err)
+	}
+
+	defer profileFile.Close()
+
+	if err := p.Encode(profileFile); err != nil {
+		return err
+	}
+
+	if err := profileFile.Close(); err != nil {
+		return fmt.Errorf("cannot write the profile file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package profile
+
+import (
+	"bytes"
+	"testing"
+
+	"mrav/software/symbols"
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+	"mrav/system/easybus/profile/proto"
+)
+
+const cCallsProgram = `
+start: xor r1 r1 r1
+addi r1 3
+jal r15 add
+jal r15 add
+jal r15 spin
+forever: jal r0 forever
+add: addi r2 1
+jalr r0 r15
+spin: xor r3 r3 r3
+addi r3 6
+spin_loop: sub r3 r3 r1
+bnz r3 spin_loop
+jalr r0 r15
+`
+
+func profileProgram(t *testing.T, source string, instructions int) *proto.Profile {
+	t.Helper()
+
+	program, image := easybustest.AssembleModule(t, source)
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, easybustest.NewMemory(t, 256, image)))
+
+	profiler := NewProfiler(symbols.FromModule(program, nil))
+	sys.SetProfiler(profiler)
+
+	easybustest.RunFast(t, sys, instructions)
+
+	return profiler.Build()
+}
+
+// stacks sums up the instructions per call stack, written as the function names from the leaf to the root.
+func stacks(prof *proto.Profile) map[string]int64 {
+	functionNames := make(map[uint64]string)
+
+	for _, function := range prof.Function {
+		functionNames[function.Id] = prof.StringTable[function.Name]
+	}
+
+	locationNames := make(map[uint64]string)
+
+	for _, location := range prof.Location {
+		name := ""
+
+		for _, line := range location.Line {
+			if name != "" {
+				name += ";"
+			}
+
+			name += functionNames[line.FunctionId]
+		}
+
+		locationNames[location.Id] = name
+	}
+
+	result := make(map[string]int64)
+
+	for _, sample := range prof.Sample {
+		stack := ""
+
+		for _, locationId := range sample.LocationId {
+			if stack != "" {
+				stack += " <- "
+			}
+
+			stack += locationNames[locationId]
+		}
+
+		result[stack] += sample.Value[0]
+	}
+
+	return result
+}
+
+func TestProfileCallStacks(t *testing.T) {
+	got := stacks(profileProgram(t, cCallsProgram, 40))
+
+	// The loop label is shown as inlined into the function that was called.
+	expected := map[string]int64{
+		"start":                   5,
+		"forever;start":           40 - 5 - 2*2 - 2 - 5,
+		"add <- start":            2 * 2,
+		"spin <- start":           2,
+		"spin_loop;spin <- start": 2*2 + 1,
+	}
+
+	for stack, instructions := range expected {
+		if got[stack] != instructions {
+			t.Errorf("expected %d instructions in '%s', got %d", instructions, stack, got[stack])
+		}
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected stacks: %v", got)
+	}
+}
+
+func TestProfileEncodes(t *testing.T) {
+	program, _ := easybustest.AssembleModule(t, cCallsProgram)
+
+	var buf bytes.Buffer
+	profiler := NewProfiler(symbols.FromModule(program, nil))
+
+	if err := profiler.Encode(&buf); err != nil {
+		t.Fatalf("cannot encode an empty profile: %v", err)
+	}
+
+	// Gzip magic.
+	if (buf.Len() < 2) || (buf.Bytes()[0] != 0x1F) || (buf.Bytes()[1] != 0x8B) {
+		t.Fatalf("the profile is not gzipped")
+	}
+}
@@ -0,0 +1,69 @@
+package easybus
+
+import (
+	"mrav/core"
+	"mrav/isa"
+)
+
+// ExecutedInstruction describes an instruction once it's done, for the profilers.
+type ExecutedInstruction struct {
+	Hart        int
+	Pc          isa.Register
+	Instruction core.DecodedInstruction
+	NextPc      isa.Register
+	Cycles      uint64 // Clock cycles the instruction took, with the fetch
+
+	// The interrupt or the trap was taken right before the instruction, so it's the first one of the handler.
+	// ReturnPc is where the interrupted code goes on after 'reti'.
+	Interrupted bool
+	ReturnPc    isa.Register
+}
+
+// Profiler is told about every instruction run by the system. Unlike a tracer, it doesn't slow down RunFast.
+type Profiler interface {
+	Profile(instr *ExecutedInstruction)
+}
+
+// SetProfiler starts profiling the instructions, nil stops it.
+func (sys *EasyBusSystem) SetProfiler(profiler Profiler) {
+	sys.profiler = profiler
+}
+
+// beginProfile captures the state before the instruction, right after the interrupts are delivered.
+func (sys *EasyBusSystem) beginProfile(interrupted bool) {
+	if sys.profiler == nil {
+		return
+	}
+
+	sys.executed = ExecutedInstruction{
+		Hart:        sys.current,
+		Pc:          sys.core.Pc,
+		Interrupted: interrupted,
+		Cycles:      sys.cycles,
+	}
+
+	if interrupted {
+		sys.executed.ReturnPc = sys.core.ReturnPc()
+	}
+}
+
+func (sys *EasyBusSystem) finishProfile(instr *core.DecodedInstruction) {
+	if sys.profiler == nil {
+		return
+	}
+
+	sys.executed.Instruction = *instr
+	sys.executed.NextPc = sys.core.Pc
+	sys.executed.Cycles = sys.cycles - sys.executed.Cycles
+
+	sys.profiler.Profile(&sys.executed)
+}
+
+// Profilers lets several profilers see the same instructions.
+type Profilers []Profiler
+
+func (ps Profilers) Profile(instr *ExecutedInstruction) {
+	for _, profiler := range ps {
+		profiler.Profile(instr)
+	}
+}
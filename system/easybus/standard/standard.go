@@ -0,0 +1,56 @@
+// Package standard has the EasyBus system the simulator binaries run the programs on.
+package standard
+
+import (
+	"fmt"
+
+	"mrav/isa"
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/busfault"
+	"mrav/system/easybus/device/exit"
+	"mrav/system/easybus/device/hartid"
+	"mrav/system/easybus/device/memory"
+	"mrav/system/easybus/device/timer"
+)
+
+// RAM_SIZE is the default size of the RAM in bytes, the software binary is loaded at its start.
+const RAM_SIZE = 1024
+
+// Opts are where the devices are on the bus, DefaultOpts has the addresses the programs expect.
+type Opts struct {
+	RamBase       isa.Register
+	RamSize       int
+	RamWaitStates int
+	TimerBase     isa.Register
+	ExitAddress   isa.Register
+}
+
+func DefaultOpts() *Opts {
+	return &Opts{
+		RamBase:     0x0000,
+		RamSize:     RAM_SIZE,
+		TimerBase:   timer.DEFAULT_BASE,
+		ExitAddress: exit.DEFAULT_ADDRESS,
+	}
+}
+
+// Regions creates the devices of the system and places them on the bus, with the software in the RAM.
+func Regions(opts *Opts, software []byte) ([]easybus.Region, error) {
+	mem, err := memory.NewMem(opts.RamSize, software)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the memory: %w", err)
+	}
+
+	mem.SetWaitStates(opts.RamWaitStates)
+
+	regions := []easybus.Region{
+		easybus.MapDevice(opts.RamBase, mem),
+		easybus.MapDevice(opts.TimerBase, &timer.Timer{}),
+		easybus.MapDevice(opts.ExitAddress, exit.NewExitDevice()),
+		easybus.MapDevice(busfault.DEFAULT_BASE, busfault.NewBusFaultUnit()),
+		easybus.MapDevice(hartid.DEFAULT_ADDRESS, hartid.NewHartIdDevice()),
+	}
+
+	return regions, nil
+}
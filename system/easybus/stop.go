@@ -0,0 +1,377 @@
+package easybus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mrav/core"
+	"mrav/isa"
+	"mrav/software/asm/parsing"
+)
+
+type DataAccess struct {
+	Address isa.Register
+	Value   isa.Register
+	Write   bool // Read otherwise
+}
+
+// LastDataAccesses returns the data accesses done by the last instruction, instruction fetches are not included.
+func (sys *EasyBusSystem) LastDataAccesses() []DataAccess {
+	return slices.Clone(sys.dataAccesses)
+}
+
+// StopCondition is checked after every instruction run with RunUntilStop.
+//
+// Check returns a non-empty description of what happened if the simulation should stop.
+type StopCondition interface {
+	Describe() string
+	Check(check *StopCheck) string
+}
+
+// StopCheck holds everything that the stop conditions can look at after an instruction is done.
+type StopCheck struct {
+	Hart             int // The hart that ran the instruction
+	Core             *core.Core
+	PreviousRegs     isa.GeneralRegisters
+	PreviousPc       isa.Register
+	DataAccesses     []DataAccess
+	InstructionsDone int
+	Halt             *Halt
+}
+
+// Stops when the next instruction to run is at the given address. It's not checked before the first instruction, so
+// the simulation can be continued after stopping at a breakpoint. It's also checked right after an interrupt is
+// delivered, which stops at the vector before the handler runs.
+type PcBreakpoint struct {
+	Pc isa.Register
+}
+
+func (b *PcBreakpoint) Describe() string {
+	return fmt.Sprintf("breakpoint at %04X", b.Pc)
+}
+
+func (b *PcBreakpoint) Check(check *StopCheck) string {
+	if check.Core.Pc != b.Pc {
+		return ""
+	}
+
+	return fmt.Sprintf("reached %04X", b.Pc)
+}
+
+// Stops after a data access to any address in the [Lo, Hi] range. LW and SW move a word, so an access at A also
+// touches A+1 (wrapping at the end of the bus), and either byte in the range stops.
+type AddressWatchpoint struct {
+	Lo      isa.Register
+	Hi      isa.Register
+	OnRead  bool
+	OnWrite bool
+}
+
+func (w *AddressWatchpoint) Describe() string {
+	var kinds []string
+
+	if w.OnRead {
+		kinds = append(kinds, "read")
+	}
+
+	if w.OnWrite {
+		kinds = append(kinds, "write")
+	}
+
+	return fmt.Sprintf("watch %s of %04X-%04X", strings.Join(kinds, "/"), w.Lo, w.Hi)
+}
+
+func (w *AddressWatchpoint) Check(check *StopCheck) string {
+	for _, access := range check.DataAccesses {
+		if !w.contains(access.Address) && !w.contains(access.Address+1) {
+			continue
+		}
+
+		if access.Write && w.OnWrite {
+			return fmt.Sprintf("write of %04X to %04X at PC %04X", access.Value, access.Address, check.PreviousPc)
+		}
+
+		if !access.Write && w.OnRead {
+			return fmt.Sprintf("read of %04X from %04X at PC %04X", access.Value, access.Address, check.PreviousPc)
+		}
+	}
+
+	return ""
+}
+
+func (w *AddressWatchpoint) contains(address isa.Register) bool {
+	return (address >= w.Lo) && (address <= w.Hi)
+}
+
+// ParseAddressRange parses either a single address or an inclusive 'lo-hi' range.
+func ParseAddressRange(spec string) (isa.Register, isa.Register, error) {
+	loSpec, hiSpec, isRange := strings.Cut(spec, "-")
+
+	lo, err := parsing.NumberValue(strings.TrimSpace(loSpec))
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse the address: %w", err)
+	}
+
+	if !isRange {
+		return isa.Register(lo), isa.Register(lo), nil
+	}
+
+	hi, err := parsing.NumberValue(strings.TrimSpace(hiSpec))
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse the high address: %w", err)
+	}
+
+	if hi < lo {
+		return 0, 0, fmt.Errorf("low address %04X is above the high address %04X", lo, hi)
+	}
+
+	return isa.Register(lo), isa.Register(hi), nil
+}
+
+// Stops when the register changes its value.
+type RegisterWatchpoint struct {
+	Register isa.RegisterId
+}
+
+func (w *RegisterWatchpoint) Describe() string {
+	return fmt.Sprintf("watch r%d", w.Register)
+}
+
+func (w *RegisterWatchpoint) Check(check *StopCheck) string {
+	oldValue := check.PreviousRegs[w.Register]
+	newValue := check.Core.Registers[w.Register]
+
+	if oldValue == newValue {
+		return ""
+	}
+
+	return fmt.Sprintf("r%d changed %04X -> %04X at PC %04X", w.Register, oldValue, newValue, check.PreviousPc)
+}
+
+type CompareOp string
+
+const (
+	COMPARE_EQ CompareOp = "=="
+	COMPARE_NE CompareOp = "!="
+	COMPARE_LT CompareOp = "<"
+	COMPARE_LE CompareOp = "<="
+	COMPARE_GT CompareOp = ">"
+	COMPARE_GE CompareOp = ">="
+)
+
+// Stops when the register compares to the value as given, values are compared as unsigned.
+type RegisterCondition struct {
+	Register isa.RegisterId
+	Op       CompareOp
+	Value    isa.Register
+}
+
+func (c *RegisterCondition) Describe() string {
+	return fmt.Sprintf("r%d %s %04X", c.Register, c.Op, c.Value)
+}
+
+func (c *RegisterCondition) Check(check *StopCheck) string {
+	regValue := check.Core.Registers[c.Register]
+	var holds bool
+
+	switch c.Op {
+	case COMPARE_EQ:
+		holds = regValue == c.Value
+	case COMPARE_NE:
+		holds = regValue != c.Value
+	case COMPARE_LT:
+		holds = regValue < c.Value
+	case COMPARE_LE:
+		holds = regValue <= c.Value
+	case COMPARE_GT:
+		holds = regValue > c.Value
+	case COMPARE_GE:
+		holds = regValue >= c.Value
+	}
+
+	if !holds {
+		return ""
+	}
+
+	return fmt.Sprintf("r%d = %04X", c.Register, regValue)
+}
+
+// ParseRegisterCondition parses conditions like 'r3 == 0x10', the value can be in any format the assembler accepts.
+func ParseRegisterCondition(expr string) (*RegisterCondition, error) {
+	// Two character operators first, so '<=' is not taken for '<'.
+	ops := []CompareOp{COMPARE_EQ, COMPARE_NE, COMPARE_LE, COMPARE_GE, COMPARE_LT, COMPARE_GT}
+
+	for _, op := range ops {
+		regSpec, valueSpec, found := strings.Cut(expr, string(op))
+
+		if !found {
+			continue
+		}
+
+		reg, err := parsing.ParseRegister(strings.TrimSpace(regSpec))
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse the condition register: %w", err)
+		}
+
+		value, err := parsing.NumberValue(strings.TrimSpace(valueSpec))
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse the condition value: %w", err)
+		}
+
+		return &RegisterCondition{
+			Register: reg,
+			Op:       op,
+			Value:    isa.Register(value),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("condition should be in the 'rN op value' format, got '%s'", expr)
+}
+
+// Stops when the predicate holds, for conditions that are easier to express in Go.
+type PredicateCondition struct {
+	Description string
+	Predicate   func(c *core.Core) bool
+}
+
+func (c *PredicateCondition) Describe() string {
+	return c.Description
+}
+
+func (c *PredicateCondition) Check(check *StopCheck) string {
+	if !c.Predicate(check.Core) {
+		return ""
+	}
+
+	return c.Description
+}
+
+type StopEvent struct {
+	Id        int
+	Condition StopCondition
+	Details   string
+}
+
+func (e *StopEvent) String() string {
+	return fmt.Sprintf("#%d (%s): %s", e.Id, e.Condition.Describe(), e.Details)
+}
+
+// AddStopCondition registers the condition and returns its ID, used for removing it later.
+func (sys *EasyBusSystem) AddStopCondition(cond StopCondition) int {
+	if sys.stopConditions == nil {
+		sys.stopConditions = make(map[int]StopCondition)
+	}
+
+	sys.nextStopConditionId++
+	sys.stopConditions[sys.nextStopConditionId] = cond
+
+	return sys.nextStopConditionId
+}
+
+func (sys *EasyBusSystem) RemoveStopCondition(id int) error {
+	if _, found := sys.stopConditions[id]; !found {
+		return fmt.Errorf("no stop condition with ID %d", id)
+	}
+
+	delete(sys.stopConditions, id)
+
+	return nil
+}
+
+func (sys *EasyBusSystem) StopConditions() map[int]StopCondition {
+	conditions := make(map[int]StopCondition, len(sys.stopConditions))
+
+	for id, cond := range sys.stopConditions {
+		conditions[id] = cond
+	}
+
+	return conditions
+}
+
+// RunUntilStop runs up to maxInstructions instructions, stopping early if any of the stop conditions fires.
+//
+// Returns the events for all the conditions that fired after the last instruction, none if the limit was reached
+// instead. The number of instructions run is returned in both cases.
+func (sys *EasyBusSystem) RunUntilStop(maxInstructions int) ([]*StopEvent, int, error) {
+	for i := 0; i < maxInstructions; i++ {
+		sys.arbitrate()
+
+		// The interrupt is delivered ahead of the instruction, so a breakpoint at the vector stops before the first
+		// instruction of the handler runs.
+		if sys.deliverInterrupts() {
+			if events := sys.checkBreakpoints(i); len(events) > 0 {
+				return events, i, nil
+			}
+		}
+
+		if err := sys.runInstruction(); err != nil {
+			return nil, i, err
+		}
+
+		// The previous state is taken after the interrupt delivery, so the jump to the vector isn't a step of its own.
+		check := &StopCheck{
+			Hart:             sys.current,
+			Core:             sys.core,
+			PreviousRegs:     sys.previousRegs,
+			PreviousPc:       sys.previousPc,
+			DataAccesses:     sys.dataAccesses,
+			InstructionsDone: i + 1,
+			Halt:             sys.Halted(),
+		}
+
+		events := sys.checkStopConditions(check, false)
+
+		if len(events) > 0 {
+			return events, i + 1, nil
+		}
+	}
+
+	return nil, maxInstructions, nil
+}
+
+// checkBreakpoints checks only the PC breakpoints, at the PC the interrupt delivery jumped to.
+func (sys *EasyBusSystem) checkBreakpoints(instructionsDone int) []*StopEvent {
+	check := &StopCheck{
+		Hart:             sys.current,
+		Core:             sys.core,
+		PreviousRegs:     sys.core.Registers,
+		PreviousPc:       sys.core.Pc,
+		InstructionsDone: instructionsDone,
+	}
+
+	return sys.checkStopConditions(check, true)
+}
+
+func (sys *EasyBusSystem) checkStopConditions(check *StopCheck, onlyBreakpoints bool) []*StopEvent {
+	var events []*StopEvent
+
+	for id, cond := range sys.stopConditions {
+		if _, isBreakpoint := cond.(*PcBreakpoint); onlyBreakpoints && !isBreakpoint {
+			continue
+		}
+
+		details := cond.Check(check)
+
+		if details == "" {
+			continue
+		}
+
+		events = append(events, &StopEvent{
+			Id:        id,
+			Condition: cond,
+			Details:   details,
+		})
+	}
+
+	// Map iteration is random, keep the report stable.
+	slices.SortFunc(events, func(a, b *StopEvent) int {
+		return a.Id - b.Id
+	})
+
+	return events
+}
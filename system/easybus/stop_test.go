@@ -0,0 +1,182 @@
+package easybus_test
+
+import (
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+// 4 instructions with 6 bus transactions, the fetches and the data accesses.
+const cDataAccessProgram = `
+xor r3 r3 r3
+addi r3 200
+sw r3 r3
+lw r4 r3
+`
+
+// The first instruction of the handler is reported at its own PC, not at the one the interrupt came in at.
+func TestWatchpointInInterruptHandler(t *testing.T) {
+	sys := newTestSystem(t, easybustest.Assemble(t, cMaskedTimerProgram))
+	sys.AddStopCondition(&easybus.RegisterWatchpoint{Register: 6})
+
+	events, done, err := sys.RunUntilStop(500)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected the watchpoint to fire, got %d events after %d instructions", len(events), done)
+	}
+
+	if want := "r6 changed 0000 -> 0001 at PC 0002"; events[0].Details != want {
+		t.Fatalf("expected %q, got %q", want, events[0].Details)
+	}
+}
+
+// The breakpoint at the vector stops after the interrupt is taken, before the first instruction of the handler.
+func TestPcBreakpointAtInterruptVector(t *testing.T) {
+	sys := newTestSystem(t, easybustest.Assemble(t, cMaskedTimerProgram))
+	sys.AddStopCondition(&easybus.PcBreakpoint{Pc: 0x0002})
+	c := sys.GetCore()
+
+	events, done, err := sys.RunUntilStop(500)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if (len(events) != 1) || (c.Pc != 0x0002) || (c.Epc != cMaskedTimerLoop) || (c.Registers[6] != 0) {
+		t.Fatalf("expected to stop at the vector before the handler, got %d events after %d instructions at %04X, EPC = %04X, r6 = %d",
+			len(events), done, c.Pc, c.Epc, c.Registers[6])
+	}
+
+	// Continuing runs the handler, the interrupt isn't taken again.
+	events, done, err = sys.RunUntilStop(1)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if (len(events) != 0) || (done != 1) || (c.Registers[6] != 1) || (c.Epc != cMaskedTimerLoop) {
+		t.Fatalf("expected the first instruction of the handler to run, got %d events after %d instructions, r6 = %d, EPC = %04X",
+			len(events), done, c.Registers[6], c.Epc)
+	}
+}
+
+func TestPcBreakpoint(t *testing.T) {
+	sys := newTestSystem(t, easybustest.Assemble(t, cDataAccessProgram))
+	sys.AddStopCondition(&easybus.PcBreakpoint{Pc: 0x0004})
+
+	events, done, err := sys.RunUntilStop(10)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if (len(events) != 1) || (done != 2) || (sys.GetCore().Pc != 0x0004) {
+		t.Fatalf("expected to stop at 0004 after 2 instructions, got %d events after %d at %04X", len(events), done, sys.GetCore().Pc)
+	}
+
+	// Continuing from the breakpoint runs its instruction.
+	events, done, err = sys.RunUntilStop(2)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if (len(events) != 0) || (done != 2) {
+		t.Fatalf("expected to continue past the breakpoint, got %d events after %d instructions", len(events), done)
+	}
+}
+
+func TestAddressWatchpoint(t *testing.T) {
+	watchpoints := []struct {
+		name      string
+		watch     *easybus.AddressWatchpoint
+		wantDone  int
+		wantEvent string
+	}{
+		{"write", &easybus.AddressWatchpoint{Lo: 200, Hi: 200, OnWrite: true}, 3, "write of 00C8 to 00C8 at PC 0004"},
+		{"read", &easybus.AddressWatchpoint{Lo: 200, Hi: 200, OnRead: true}, 4, "read of 00C8 from 00C8 at PC 0006"},
+		{"range", &easybus.AddressWatchpoint{Lo: 190, Hi: 210, OnRead: true, OnWrite: true}, 3, "write of 00C8 to 00C8 at PC 0004"},
+		{"second byte", &easybus.AddressWatchpoint{Lo: 201, Hi: 201, OnWrite: true}, 3, "write of 00C8 to 00C8 at PC 0004"},
+		{"range from the second byte", &easybus.AddressWatchpoint{Lo: 201, Hi: 210, OnRead: true}, 4, "read of 00C8 from 00C8 at PC 0006"},
+		{"outside", &easybus.AddressWatchpoint{Lo: 202, Hi: 210, OnRead: true, OnWrite: true}, 4, ""},
+	}
+
+	for _, w := range watchpoints {
+		sys := newTestSystem(t, easybustest.Assemble(t, cDataAccessProgram))
+		sys.AddStopCondition(w.watch)
+
+		events, done, err := sys.RunUntilStop(4)
+
+		if err != nil {
+			t.Fatalf("%s: run failed: %v", w.name, err)
+		}
+
+		if done != w.wantDone {
+			t.Fatalf("%s: expected %d instructions, got %d", w.name, w.wantDone, done)
+		}
+
+		if w.wantEvent == "" {
+			if len(events) != 0 {
+				t.Fatalf("%s: expected no events, got %v", w.name, events)
+			}
+
+			continue
+		}
+
+		if (len(events) != 1) || (events[0].Details != w.wantEvent) {
+			t.Fatalf("%s: expected %q, got %v", w.name, w.wantEvent, events)
+		}
+	}
+}
+
+// The word at the end of the bus wraps around, its second byte is at 0x0000.
+func TestAddressWatchpointWraps(t *testing.T) {
+	watch := &easybus.AddressWatchpoint{Lo: 0x0000, Hi: 0x0001, OnWrite: true}
+	check := &easybus.StopCheck{DataAccesses: []easybus.DataAccess{{Address: 0xFFFF, Value: 1, Write: true}}}
+
+	if details := watch.Check(check); details == "" {
+		t.Fatalf("expected the write at FFFF to touch 0000")
+	}
+}
+
+func TestRegisterCondition(t *testing.T) {
+	cond, err := easybus.ParseRegisterCondition("r3 >= 0x64")
+
+	if err != nil {
+		t.Fatalf("cannot parse the condition: %v", err)
+	}
+
+	if cond.Op != easybus.COMPARE_GE {
+		t.Fatalf("expected '>=', got %q", cond.Op)
+	}
+
+	sys := newTestSystem(t, easybustest.Assemble(t, cDataAccessProgram))
+	sys.AddStopCondition(cond)
+
+	events, done, err := sys.RunUntilStop(4)
+
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	if (len(events) != 1) || (done != 2) || (events[0].Details != "r3 = 00C8") {
+		t.Fatalf("expected to stop once r3 is set, got %v after %d instructions", events, done)
+	}
+}
+
+func TestParseAddressRange(t *testing.T) {
+	lo, hi, err := easybus.ParseAddressRange("0x10-0x20")
+
+	if (err != nil) || (lo != 0x10) || (hi != 0x20) {
+		t.Fatalf("expected 0010-0020, got %04X-%04X (%v)", lo, hi, err)
+	}
+
+	if _, _, err := easybus.ParseAddressRange("0x20-0x10"); err == nil {
+		t.Fatalf("expected an error for a reversed range")
+	}
+}
@@ -0,0 +1,82 @@
+package easybus
+
+import (
+	"strings"
+
+	"mrav/core/proto"
+	"mrav/isa"
+	"mrav/software/disasm"
+)
+
+// Tracer receives a record for every instruction run by the system, once the instruction is done.
+type Tracer interface {
+	Trace(record *proto.TraceRecord) error
+}
+
+// SetTracer starts tracing the instructions, nil stops it. Nothing is collected while there is no tracer.
+func (sys *EasyBusSystem) SetTracer(tracer Tracer) {
+	sys.tracer = tracer
+}
+
+type traceBuilder struct {
+	record     *proto.TraceRecord
+	regsBefore isa.GeneralRegisters
+}
+
+func (sys *EasyBusSystem) newTraceBuilder(interrupted bool) *traceBuilder {
+	if sys.tracer == nil {
+		return nil
+	}
+
+	return &traceBuilder{
+		record: &proto.TraceRecord{
+			Cycle:     sys.cycles,
+			Pc:        uint32(sys.core.Pc),
+			Interrupt: interrupted,
+			Hart:      uint32(sys.current),
+		},
+		regsBefore: sys.core.Registers,
+	}
+}
+
+func (tb *traceBuilder) addBusAccess(kind proto.BusAccessKind, address isa.Register, value isa.Register) {
+	if tb == nil {
+		return
+	}
+
+	if kind == proto.BusAccessKind_BUS_ACCESS_KIND_FETCH {
+		tb.record.Instruction = uint32(value)
+	}
+
+	tb.record.BusAccesses = append(tb.record.BusAccesses, &proto.TraceBusAccess{
+		Kind:    kind,
+		Address: uint32(address),
+		Value:   uint32(value),
+	})
+}
+
+func (sys *EasyBusSystem) finishTrace(tb *traceBuilder) error {
+	if tb == nil {
+		return nil
+	}
+
+	word := isa.Register(tb.record.Instruction)
+
+	if text, err := disasm.Disassemble(word, nil); err == nil {
+		tb.record.Mnemonic = strings.Fields(text)[0]
+		tb.record.Disassembly = text
+	}
+
+	// The rd write is traced even if the value stays the same.
+	if spec, err := isa.DecodeSpec(word); err == nil && spec.WritesRd {
+		rd := isa.ParseRd(word)
+
+		tb.record.RegisterWrites = append(tb.record.RegisterWrites, &proto.TraceRegisterWrite{
+			Register: uint32(rd),
+			OldValue: uint32(tb.regsBefore[rd]),
+			NewValue: uint32(sys.core.Registers[rd]),
+		})
+	}
+
+	return sys.tracer.Trace(tb.record)
+}
@@ -0,0 +1,208 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+
+	"mrav/core/proto"
+	"mrav/isa"
+	"mrav/software/disasm"
+)
+
+type DiffOpts struct {
+	// Records to drop from the start of each trace before aligning them, e.g. for a trace that starts earlier.
+	LeftSkip  int
+	RightSkip int
+
+	// Cycles are compared relative to the first aligned record, so the traces don't need to start at the same cycle.
+	IgnoreCycles bool
+}
+
+// Divergence is the first pair of aligned records that don't match.
+type Divergence struct {
+	Index       int // Position after the alignment, the same for both traces
+	Left        *proto.TraceRecord
+	Right       *proto.TraceRecord
+	Differences []string
+}
+
+// Diff aligns the traces and returns the first divergence, nil if the traces agree for as long as both of them go.
+//
+// Register writes are compared by their effect, a write that keeps the value is the same as no write. That's all
+// that can be seen from the register file of the RTL core.
+func Diff(left []*proto.TraceRecord, right []*proto.TraceRecord, opts *DiffOpts) (*Divergence, error) {
+	if (opts.LeftSkip > len(left)) || (opts.RightSkip > len(right)) {
+		return nil, fmt.Errorf("cannot skip more records than the traces have (%d and %d)", len(left), len(right))
+	}
+
+	left = left[opts.LeftSkip:]
+	right = right[opts.RightSkip:]
+
+	for i := 0; i < min(len(left), len(right)); i++ {
+		var diffs []string
+
+		if !opts.IgnoreCycles {
+			leftCycle := left[i].Cycle - left[0].Cycle
+			rightCycle := right[i].Cycle - right[0].Cycle
+
+			if leftCycle != rightCycle {
+				diffs = append(diffs, fmt.Sprintf("cycle (relative): %d vs %d", leftCycle, rightCycle))
+			}
+		}
+
+		diffs = append(diffs, compareRecords(left[i], right[i])...)
+
+		if len(diffs) > 0 {
+			return &Divergence{
+				Index:       i,
+				Left:        left[i],
+				Right:       right[i],
+				Differences: diffs,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Align finds where the traces start running the same code, for traces that start at different points, like an RTL
+// trace with the reset cycles in it. It looks for the first pair of records with the same hart, PC and instruction
+// within the window from the start of each trace, trying the pairs closer to the starts first, so the fewest records
+// are dropped. Returns the number of records to skip in each trace.
+func Align(left []*proto.TraceRecord, right []*proto.TraceRecord, window int) (int, int, error) {
+	for total := 0; total <= 2*(window-1); total++ {
+		for leftSkip := max(total-(window-1), 0); leftSkip <= min(total, window-1); leftSkip++ {
+			rightSkip := total - leftSkip
+
+			if (leftSkip >= len(left)) || (rightSkip >= len(right)) {
+				continue
+			}
+
+			l := left[leftSkip]
+			r := right[rightSkip]
+
+			if (l.Hart == r.Hart) && (l.Pc == r.Pc) && (l.Instruction == r.Instruction) {
+				return leftSkip, rightSkip, nil
+			}
+		}
+	}
+
+	return 0, 0, fmt.Errorf("no records with the same PC and instruction in the first %d records of the traces", window)
+}
+
+func compareRecords(left *proto.TraceRecord, right *proto.TraceRecord) []string {
+	var diffs []string
+
+	if left.Hart != right.Hart {
+		diffs = append(diffs, fmt.Sprintf("hart: %d vs %d", left.Hart, right.Hart))
+	}
+
+	if left.Pc != right.Pc {
+		diffs = append(diffs, fmt.Sprintf("PC: %04X vs %04X", left.Pc, right.Pc))
+	}
+
+	if left.Instruction != right.Instruction {
+		diffs = append(diffs, fmt.Sprintf("instruction: %04X (%s) vs %04X (%s)", left.Instruction, disassemble(left), right.Instruction, disassemble(right)))
+	}
+
+	if left.Interrupt != right.Interrupt {
+		diffs = append(diffs, fmt.Sprintf("interrupt taken: %t vs %t", left.Interrupt, right.Interrupt))
+	}
+
+	leftRegs := registerChanges(left)
+	rightRegs := registerChanges(right)
+
+	for reg := uint32(0); reg < uint32(isa.RegsNumber); reg++ {
+		leftValue, leftChanged := leftRegs[reg]
+		rightValue, rightChanged := rightRegs[reg]
+
+		if (leftChanged == rightChanged) && (leftValue == rightValue) {
+			continue
+		}
+
+		diffs = append(diffs, fmt.Sprintf("r%d: %s vs %s", reg, describeChange(leftValue, leftChanged), describeChange(rightValue, rightChanged)))
+	}
+
+	for i := 0; i < max(len(left.BusAccesses), len(right.BusAccesses)); i++ {
+		leftAccess := describeBusAccess(left.BusAccesses, i)
+		rightAccess := describeBusAccess(right.BusAccesses, i)
+
+		if leftAccess != rightAccess {
+			diffs = append(diffs, fmt.Sprintf("bus access %d: %s vs %s", i, leftAccess, rightAccess))
+		}
+	}
+
+	return diffs
+}
+
+func registerChanges(record *proto.TraceRecord) map[uint32]uint32 {
+	changes := make(map[uint32]uint32)
+
+	for _, regWrite := range record.RegisterWrites {
+		if regWrite.OldValue != regWrite.NewValue {
+			changes[regWrite.Register] = regWrite.NewValue
+		}
+	}
+
+	return changes
+}
+
+func describeChange(value uint32, changed bool) string {
+	if !changed {
+		return "unchanged"
+	}
+
+	return fmt.Sprintf("%04X", value)
+}
+
+func describeBusAccess(accesses []*proto.TraceBusAccess, i int) string {
+	if i >= len(accesses) {
+		return "none"
+	}
+
+	return fmt.Sprintf("%s %04X = %04X", busAccessKindNames[accesses[i].Kind], accesses[i].Address, accesses[i].Value)
+}
+
+// The RTL traces don't carry the disassembly.
+func disassemble(record *proto.TraceRecord) string {
+	if record.Disassembly != "" {
+		return record.Disassembly
+	}
+
+	text, err := disasm.Disassemble(isa.Register(record.Instruction), nil)
+
+	if err != nil {
+		return "?"
+	}
+
+	return text
+}
+
+// FormatRecord prints the record in one line, for the reports.
+func FormatRecord(record *proto.TraceRecord) string {
+	var regs []string
+
+	for _, regWrite := range record.RegisterWrites {
+		regs = append(regs, fmt.Sprintf("r%d %04X->%04X", regWrite.Register, regWrite.OldValue, regWrite.NewValue))
+	}
+
+	var accesses []string
+
+	for i := range record.BusAccesses {
+		accesses = append(accesses, describeBusAccess(record.BusAccesses, i))
+	}
+
+	interrupt := ""
+
+	if record.Interrupt {
+		interrupt = " (interrupt)"
+	}
+
+	hart := ""
+
+	if record.Hart != 0 {
+		hart = fmt.Sprintf("hart %d  ", record.Hart)
+	}
+
+	return fmt.Sprintf("%scycle %d  PC %04X  %04X  %-16s [%s] [%s]%s", hart, record.Cycle, record.Pc, record.Instruction, disassemble(record), strings.Join(regs, ", "), strings.Join(accesses, ", "), interrupt)
+}
@@ -0,0 +1,191 @@
+package trace
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"mrav/core/proto"
+	"mrav/system/easybus"
+	"mrav/system/easybus/easybustest"
+)
+
+const cProgram = `
+xor r3 r3 r3
+addi r3 200
+sw r3 r3
+lw r4 r3
+addi r4 1
+`
+
+// Traces the program in the format, and reads the trace back.
+func traceProgram(t *testing.T, format string) []*proto.TraceRecord {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(format, &buf)
+
+	if err != nil {
+		t.Fatalf("cannot create the writer: %v", err)
+	}
+
+	mem := easybustest.NewMemory(t, 256, easybustest.Assemble(t, cProgram))
+	sys := easybustest.NewSystem(t, easybustest.Opts(), easybus.MapDevice(0, mem))
+	sys.SetTracer(writer)
+	easybustest.Run(t, sys, 5)
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("cannot flush the trace: %v", err)
+	}
+
+	records, err := ReadRecords(format, &buf)
+
+	if err != nil {
+		t.Fatalf("cannot read the trace: %v", err)
+	}
+
+	if len(records) != 5 {
+		t.Fatalf("expected 5 records, got %d", len(records))
+	}
+
+	return records
+}
+
+func cloneRecords(records []*proto.TraceRecord) []*proto.TraceRecord {
+	clones := make([]*proto.TraceRecord, 0, len(records))
+
+	for _, record := range records {
+		clones = append(clones, protobuf.Clone(record).(*proto.TraceRecord))
+	}
+
+	return clones
+}
+
+func TestDiffSameProgram(t *testing.T) {
+	binary := traceProgram(t, FORMAT_BINARY)
+	jsonl := traceProgram(t, FORMAT_JSONL)
+
+	// Like the RTL trace: no disassembly, only the writes that change the value, and a later first cycle.
+	rtl := cloneRecords(binary)
+
+	for _, record := range rtl {
+		record.Mnemonic = ""
+		record.Disassembly = ""
+		record.Cycle += 100
+		record.RegisterWrites = slices.DeleteFunc(record.RegisterWrites, func(w *proto.TraceRegisterWrite) bool {
+			return w.OldValue == w.NewValue
+		})
+	}
+
+	for _, right := range [][]*proto.TraceRecord{jsonl, rtl} {
+		divergence, err := Diff(binary, right, &DiffOpts{})
+
+		if err != nil {
+			t.Fatalf("cannot diff: %v", err)
+		}
+
+		if divergence != nil {
+			t.Fatalf("expected no divergence, got %v", divergence.Differences)
+		}
+	}
+}
+
+func TestDiffDivergence(t *testing.T) {
+	left := traceProgram(t, FORMAT_BINARY)
+	right := cloneRecords(left)
+
+	// The 'lw' reads a different value.
+	right[3].RegisterWrites[0].NewValue = 0x00C9
+	right[3].BusAccesses[1].Value = 0x00C9
+
+	divergence, err := Diff(left, right, &DiffOpts{})
+
+	if err != nil {
+		t.Fatalf("cannot diff: %v", err)
+	}
+
+	if (divergence == nil) || (divergence.Index != 3) {
+		t.Fatalf("expected a divergence at the 'lw', got %v", divergence)
+	}
+
+	expected := []string{
+		"r4: 00C8 vs 00C9",
+		"bus access 1: read 00C8 = 00C8 vs read 00C8 = 00C9",
+	}
+
+	if !slices.Equal(divergence.Differences, expected) {
+		t.Fatalf("expected the differences %q, got %q", expected, divergence.Differences)
+	}
+}
+
+func TestDiffAlignment(t *testing.T) {
+	left := traceProgram(t, FORMAT_BINARY)
+	right := cloneRecords(left)
+	right[2].Cycle++
+
+	if divergence, err := Diff(left, right, &DiffOpts{}); (err != nil) || (divergence == nil) || (divergence.Index != 2) {
+		t.Fatalf("expected the cycles to diverge at 2, got %v (%v)", divergence, err)
+	}
+
+	if divergence, err := Diff(left, right, &DiffOpts{IgnoreCycles: true}); (err != nil) || (divergence != nil) {
+		t.Fatalf("expected no divergence ignoring the cycles, got %v (%v)", divergence, err)
+	}
+
+	// The right trace starts one instruction later.
+	if divergence, err := Diff(left, right[1:], &DiffOpts{LeftSkip: 1, IgnoreCycles: true}); (err != nil) || (divergence != nil) {
+		t.Fatalf("expected no divergence after skipping, got %v (%v)", divergence, err)
+	}
+
+	if _, err := Diff(left, right, &DiffOpts{LeftSkip: len(left) + 1}); err == nil {
+		t.Fatalf("expected an error skipping more records than the trace has")
+	}
+}
+
+func TestAlign(t *testing.T) {
+	records := traceProgram(t, FORMAT_BINARY)
+
+	// Like an RTL trace with two extra instructions before the program, and a trace that misses the first one.
+	extra := cloneRecords(records[3:5])
+
+	for _, record := range extra {
+		record.Pc += 0x80
+	}
+
+	tests := []struct {
+		name      string
+		left      []*proto.TraceRecord
+		right     []*proto.TraceRecord
+		leftSkip  int
+		rightSkip int
+	}{
+		{"same start", records, records, 0, 0},
+		{"right starts later", records, append(extra, records...), 0, 2},
+		{"left starts later", records[1:], records, 0, 1},
+	}
+
+	for _, tc := range tests {
+		leftSkip, rightSkip, err := Align(tc.left, tc.right, 10)
+
+		if err != nil {
+			t.Fatalf("%s: cannot align: %v", tc.name, err)
+		}
+
+		if (leftSkip != tc.leftSkip) || (rightSkip != tc.rightSkip) {
+			t.Fatalf("%s: expected the skips %d and %d, got %d and %d", tc.name, tc.leftSkip, tc.rightSkip, leftSkip, rightSkip)
+		}
+
+		if divergence, err := Diff(tc.left, tc.right, &DiffOpts{LeftSkip: leftSkip, RightSkip: rightSkip, IgnoreCycles: true}); (err != nil) || (divergence != nil) {
+			t.Fatalf("%s: expected no divergence after the alignment, got %v (%v)", tc.name, divergence, err)
+		}
+	}
+
+	if _, _, err := Align(records, extra, 10); err == nil {
+		t.Fatalf("expected an error without any common instruction")
+	}
+
+	if _, _, err := Align(records[2:], records, 2); err == nil {
+		t.Fatalf("expected an error with the common instruction outside of the window")
+	}
+}
@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"mrav/core/proto"
+)
+
+// FormatFromPath guesses the trace format from the file extension, everything but '.jsonl' is taken as binary.
+func FormatFromPath(path string) string {
+	if strings.HasSuffix(path, ".jsonl") {
+		return FORMAT_JSONL
+	}
+
+	return FORMAT_BINARY
+}
+
+func ReadRecords(format string, r io.Reader) ([]*proto.TraceRecord, error) {
+	switch format {
+	case FORMAT_JSONL:
+		return ReadJsonLines(r)
+	case FORMAT_BINARY:
+		return ReadBinary(r)
+	}
+
+	return nil, fmt.Errorf("unknown trace format '%s', should be %s or %s", format, FORMAT_JSONL, FORMAT_BINARY)
+}
+
+func ReadFile(path string, format string) ([]*proto.TraceRecord, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the trace: %w", err)
+	}
+
+	defer f.Close()
+
+	return ReadRecords(format, f)
+}
+
+func busAccessKindFromName(name string) (proto.BusAccessKind, error) {
+	for kind, kindName := range busAccessKindNames {
+		if kindName == name {
+			return kind, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown bus access kind '%s'", name)
+}
+
+func fromJsonRecord(jr *jsonRecord) (*proto.TraceRecord, error) {
+	record := &proto.TraceRecord{
+		Cycle:       jr.Cycle,
+		Pc:          jr.Pc,
+		Instruction: jr.Instruction,
+		Mnemonic:    jr.Mnemonic,
+		Disassembly: jr.Disassembly,
+		Interrupt:   jr.Interrupt,
+		Hart:        jr.Hart,
+	}
+
+	for _, regWrite := range jr.RegisterWrites {
+		record.RegisterWrites = append(record.RegisterWrites, &proto.TraceRegisterWrite{
+			Register: regWrite.Register,
+			OldValue: regWrite.Old,
+			NewValue: regWrite.New,
+		})
+	}
+
+	for _, access := range jr.BusAccesses {
+		kind, err := busAccessKindFromName(access.Kind)
+
+		if err != nil {
+			return nil, err
+		}
+
+		record.BusAccesses = append(record.BusAccesses, &proto.TraceBusAccess{
+			Kind:    kind,
+			Address: access.Address,
+			Value:   access.Value,
+		})
+	}
+
+	return record, nil
+}
+
+func ReadJsonLines(r io.Reader) ([]*proto.TraceRecord, error) {
+	var records []*proto.TraceRecord
+	dec := json.NewDecoder(r)
+
+	for {
+		var jr jsonRecord
+
+		if err := dec.Decode(&jr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+
+			return nil, fmt.Errorf("cannot read trace record %d: %w", len(records), err)
+		}
+
+		record, err := fromJsonRecord(&jr)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trace record %d: %w", len(records), err)
+		}
+
+		records = append(records, record)
+	}
+}
+
+func ReadBinary(r io.Reader) ([]*proto.TraceRecord, error) {
+	var records []*proto.TraceRecord
+	br := bufio.NewReader(r)
+
+	for {
+		record := &proto.TraceRecord{}
+
+		if err := protodelim.UnmarshalFrom(br, record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+
+			return nil, fmt.Errorf("cannot read trace record %d: %w", len(records), err)
+		}
+
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,148 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"mrav/core/proto"
+)
+
+const (
+	FORMAT_JSONL  = "jsonl"
+	FORMAT_BINARY = "binary"
+)
+
+// Writer is a tracer for the system that writes the records out in one of the formats. Flush must be called once the
+// tracing is done.
+type Writer interface {
+	Trace(record *proto.TraceRecord) error
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FORMAT_JSONL:
+		return NewJsonLinesWriter(w), nil
+	case FORMAT_BINARY:
+		return NewBinaryWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unknown trace format '%s', should be %s or %s", format, FORMAT_JSONL, FORMAT_BINARY)
+}
+
+type jsonBusAccess struct {
+	Kind    string `json:"kind"`
+	Address uint32 `json:"address"`
+	Value   uint32 `json:"value"`
+}
+
+type jsonRegisterWrite struct {
+	Register uint32 `json:"register"`
+	Old      uint32 `json:"old"`
+	New      uint32 `json:"new"`
+}
+
+// JSON form of the record, plain numbers are easier to post-process than what protojson produces.
+type jsonRecord struct {
+	Cycle          uint64              `json:"cycle"`
+	Pc             uint32              `json:"pc"`
+	Instruction    uint32              `json:"instruction"`
+	Mnemonic       string              `json:"mnemonic"`
+	Disassembly    string              `json:"disassembly"`
+	RegisterWrites []jsonRegisterWrite `json:"register_writes"`
+	BusAccesses    []jsonBusAccess     `json:"bus_accesses"`
+	Interrupt      bool                `json:"interrupt,omitempty"`
+	Hart           uint32              `json:"hart,omitempty"`
+}
+
+var busAccessKindNames = map[proto.BusAccessKind]string{
+	proto.BusAccessKind_BUS_ACCESS_KIND_FETCH: "fetch",
+	proto.BusAccessKind_BUS_ACCESS_KIND_READ:  "read",
+	proto.BusAccessKind_BUS_ACCESS_KIND_WRITE: "write",
+}
+
+func toJsonRecord(record *proto.TraceRecord) *jsonRecord {
+	jr := &jsonRecord{
+		Cycle:          record.Cycle,
+		Pc:             record.Pc,
+		Instruction:    record.Instruction,
+		Mnemonic:       record.Mnemonic,
+		Disassembly:    record.Disassembly,
+		RegisterWrites: make([]jsonRegisterWrite, 0, len(record.RegisterWrites)),
+		BusAccesses:    make([]jsonBusAccess, 0, len(record.BusAccesses)),
+		Interrupt:      record.Interrupt,
+		Hart:           record.Hart,
+	}
+
+	for _, regWrite := range record.RegisterWrites {
+		jr.RegisterWrites = append(jr.RegisterWrites, jsonRegisterWrite{
+			Register: regWrite.Register,
+			Old:      regWrite.OldValue,
+			New:      regWrite.NewValue,
+		})
+	}
+
+	for _, access := range record.BusAccesses {
+		jr.BusAccesses = append(jr.BusAccesses, jsonBusAccess{
+			Kind:    busAccessKindNames[access.Kind],
+			Address: access.Address,
+			Value:   access.Value,
+		})
+	}
+
+	return jr
+}
+
+// Writes one JSON object per line.
+type JsonLinesWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewJsonLinesWriter(w io.Writer) *JsonLinesWriter {
+	bw := bufio.NewWriter(w)
+
+	return &JsonLinesWriter{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+	}
+}
+
+func (jw *JsonLinesWriter) Trace(record *proto.TraceRecord) error {
+	if err := jw.enc.Encode(toJsonRecord(record)); err != nil {
+		return fmt.Errorf("cannot write the trace record: %w", err)
+	}
+
+	return nil
+}
+
+func (jw *JsonLinesWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+// Writes the TraceRecord protos, each prefixed with its size as a varint.
+type BinaryWriter struct {
+	w *bufio.Writer
+}
+
+func NewBinaryWriter(w io.Writer) *BinaryWriter {
+	return &BinaryWriter{
+		w: bufio.NewWriter(w),
+	}
+}
+
+func (bw *BinaryWriter) Trace(record *proto.TraceRecord) error {
+	if _, err := protodelim.MarshalTo(bw.w, record); err != nil {
+		return fmt.Errorf("cannot write the trace record: %w", err)
+	}
+
+	return nil
+}
+
+func (bw *BinaryWriter) Flush() error {
+	return bw.w.Flush()
+}
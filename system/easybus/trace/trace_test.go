@@ -0,0 +1,120 @@
+package trace_test
+
+import (
+	"bytes"
+	"testing"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"mrav/core/proto"
+	"mrav/system/easybus/trace"
+)
+
+// Records with every field set, including the interrupt and each kind of bus access.
+var testRecords = []*proto.TraceRecord{
+	{
+		Cycle:       0,
+		Pc:          0x0000,
+		Instruction: 0x7164,
+		Mnemonic:    "addi",
+		Disassembly: "addi r1 0x64",
+		RegisterWrites: []*proto.TraceRegisterWrite{
+			{Register: 1, OldValue: 0x0000, NewValue: 0x0064},
+		},
+		BusAccesses: []*proto.TraceBusAccess{
+			{Kind: proto.BusAccessKind_BUS_ACCESS_KIND_FETCH, Address: 0x0000, Value: 0x7164},
+		},
+	},
+	{
+		Cycle:       1,
+		Pc:          0x0002,
+		Instruction: 0x3120,
+		Mnemonic:    "sw",
+		Disassembly: "sw r1 r2",
+		BusAccesses: []*proto.TraceBusAccess{
+			{Kind: proto.BusAccessKind_BUS_ACCESS_KIND_FETCH, Address: 0x0002, Value: 0x3120},
+			{Kind: proto.BusAccessKind_BUS_ACCESS_KIND_WRITE, Address: 0x0064, Value: 0xBEEF},
+		},
+	},
+	{
+		Cycle:       3,
+		Pc:          0x0004,
+		Instruction: 0x2310,
+		Mnemonic:    "lw",
+		Disassembly: "lw r3 r1",
+		RegisterWrites: []*proto.TraceRegisterWrite{
+			{Register: 3, OldValue: 0x1234, NewValue: 0xBEEF},
+		},
+		BusAccesses: []*proto.TraceBusAccess{
+			{Kind: proto.BusAccessKind_BUS_ACCESS_KIND_FETCH, Address: 0x0004, Value: 0x2310},
+			{Kind: proto.BusAccessKind_BUS_ACCESS_KIND_READ, Address: 0x0064, Value: 0xBEEF},
+		},
+		Interrupt: true,
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{trace.FORMAT_JSONL, trace.FORMAT_BINARY} {
+		var buf bytes.Buffer
+		w, err := trace.NewWriter(format, &buf)
+
+		if err != nil {
+			t.Fatalf("%s: cannot create the writer: %v", format, err)
+		}
+
+		for _, record := range testRecords {
+			if err := w.Trace(record); err != nil {
+				t.Fatalf("%s: cannot write: %v", format, err)
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			t.Fatalf("%s: cannot flush: %v", format, err)
+		}
+
+		records, err := trace.ReadRecords(format, &buf)
+
+		if err != nil {
+			t.Fatalf("%s: cannot read: %v", format, err)
+		}
+
+		if len(records) != len(testRecords) {
+			t.Fatalf("%s: expected %d records, got %d", format, len(testRecords), len(records))
+		}
+
+		for i, record := range records {
+			if !protobuf.Equal(record, testRecords[i]) {
+				t.Fatalf("%s: record %d diverged\nexpected: %v\nactual: %v", format, i, testRecords[i], record)
+			}
+		}
+	}
+}
+
+func TestReadTruncatedBinary(t *testing.T) {
+	var buf bytes.Buffer
+	w := trace.NewBinaryWriter(&buf)
+
+	for _, record := range testRecords {
+		if err := w.Trace(record); err != nil {
+			t.Fatalf("cannot write: %v", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatalf("cannot flush: %v", err)
+	}
+
+	if _, err := trace.ReadBinary(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatalf("expected an error for the truncated last record")
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	if format := trace.FormatFromPath("run.jsonl"); format != trace.FORMAT_JSONL {
+		t.Fatalf("expected %s for .jsonl, got %s", trace.FORMAT_JSONL, format)
+	}
+
+	if format := trace.FormatFromPath("run.pb"); format != trace.FORMAT_BINARY {
+		t.Fatalf("expected %s for .pb, got %s", trace.FORMAT_BINARY, format)
+	}
+}
@@ -0,0 +1,140 @@
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"mrav/system/easybus"
+)
+
+// The top module, with a module under it for each of the scopes.
+const cTopScope = "mrav"
+
+// Writer records the waveforms of the system as a Value Change Dump, which the waveform viewers like GTKWave open
+// next to the ones from the RTL simulation. The timestamps are the clock cycles. Flush must be called once the
+// recording is done.
+type Writer struct {
+	w        *bufio.Writer
+	signals  []easybus.WaveSignal
+	ids      []string
+	last     []uint64
+	recorded bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// signalId makes the short identifier of the signal, from the printable characters.
+func signalId(index int) string {
+	const first, count = '!', '~' - '!' + 1
+
+	id := []byte{byte(first + index%count)}
+
+	for index /= count; index > 0; index /= count {
+		index--
+		id = append(id, byte(first+index%count))
+	}
+
+	return string(id)
+}
+
+func (vw *Writer) Declare(signals []easybus.WaveSignal) error {
+	if vw.signals != nil {
+		return fmt.Errorf("the signals are already declared")
+	}
+
+	vw.signals = signals
+	vw.ids = make([]string, len(signals))
+	vw.last = make([]uint64, len(signals))
+
+	fmt.Fprintf(vw.w, "$version Mrav simulator $end\n")
+	fmt.Fprintf(vw.w, "$timescale 1ns $end\n")
+	fmt.Fprintf(vw.w, "$scope module %s $end\n", cTopScope)
+
+	scope := ""
+
+	for i, signal := range signals {
+		if signal.Width <= 0 || signal.Width > 64 {
+			return fmt.Errorf("signal %s.%s has an invalid width: %d", signal.Scope, signal.Name, signal.Width)
+		}
+
+		if signal.Scope != scope {
+			if scope != "" {
+				fmt.Fprintf(vw.w, "$upscope $end\n")
+			}
+
+			scope = signal.Scope
+			fmt.Fprintf(vw.w, "$scope module %s $end\n", scope)
+		}
+
+		vw.ids[i] = signalId(i)
+		fmt.Fprintf(vw.w, "$var wire %d %s %s $end\n", signal.Width, vw.ids[i], signal.Name)
+	}
+
+	if scope != "" {
+		fmt.Fprintf(vw.w, "$upscope $end\n")
+	}
+
+	fmt.Fprintf(vw.w, "$upscope $end\n")
+	_, err := fmt.Fprintf(vw.w, "$enddefinitions $end\n")
+
+	return err
+}
+
+func (vw *Writer) writeValue(i int, value uint64) {
+	if vw.signals[i].Width == 1 {
+		fmt.Fprintf(vw.w, "%d%s\n", value&1, vw.ids[i])
+		return
+	}
+
+	fmt.Fprintf(vw.w, "b%s %s\n", strconv.FormatUint(value, 2), vw.ids[i])
+}
+
+// Record dumps all the values the first time, and only the changed ones after that.
+func (vw *Writer) Record(cycle uint64, values []uint64) error {
+	if len(values) != len(vw.signals) {
+		return fmt.Errorf("expected %d values, got %d", len(vw.signals), len(values))
+	}
+
+	if !vw.recorded {
+		vw.recorded = true
+
+		fmt.Fprintf(vw.w, "#%d\n$dumpvars\n", cycle)
+
+		for i, value := range values {
+			vw.writeValue(i, value)
+		}
+
+		copy(vw.last, values)
+		_, err := fmt.Fprintf(vw.w, "$end\n")
+
+		return err
+	}
+
+	timestamped := false
+
+	for i, value := range values {
+		if value == vw.last[i] {
+			continue
+		}
+
+		if !timestamped {
+			fmt.Fprintf(vw.w, "#%d\n", cycle)
+			timestamped = true
+		}
+
+		vw.writeValue(i, value)
+		vw.last[i] = value
+	}
+
+	return nil
+}
+
+func (vw *Writer) Flush() error {
+	return vw.w.Flush()
+}
@@ -0,0 +1,152 @@
+package vcd
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mrav/system/easybus"
+	"mrav/system/easybus/device/gpio"
+	"mrav/system/easybus/easybustest"
+)
+
+// The write to the GPIO is in cycle 7, after the fetch of 'sw' in cycle 6.
+const cTestProgram = `
+xor r1 r1 r1
+ldhi r1 0xFF
+addi r1 0xF3
+xor r2 r2 r2
+addi r2 0x5A
+sw r1 r2
+loop: jal r0 loop
+`
+
+// valueAt replays the dump up to the cycle, the signal is named with its scope, like "bus.write".
+func valueAt(t *testing.T, dump string, signal string, cycle uint64) uint64 {
+	t.Helper()
+
+	var id string
+	var value uint64
+	found := false
+	scopes := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(dump))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "$scope":
+			scopes = append(scopes, fields[2])
+		case fields[0] == "$upscope":
+			scopes = scopes[:len(scopes)-1]
+		case fields[0] == "$var":
+			if strings.Join(append(scopes[1:], fields[4]), ".") == signal {
+				id = fields[3]
+			}
+		case strings.HasPrefix(fields[0], "#"):
+			timestamp, err := strconv.ParseUint(fields[0][1:], 10, 64)
+
+			if err != nil {
+				t.Fatalf("invalid timestamp: %v", err)
+			}
+
+			if timestamp > cycle {
+				return value
+			}
+		case strings.HasPrefix(fields[0], "b") && (len(fields) == 2) && (fields[1] == id):
+			parsed, err := strconv.ParseUint(fields[0][1:], 2, 64)
+
+			if err != nil {
+				t.Fatalf("invalid value: %v", err)
+			}
+
+			value = parsed
+			found = true
+		case (id != "") && (len(fields[0]) > 1) && (fields[0][1:] == id) && (fields[0][0] == '0' || fields[0][0] == '1'):
+			value = uint64(fields[0][0] - '0')
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("no value of %s in the dump", signal)
+	}
+
+	return value
+}
+
+func TestGpioWrite(t *testing.T) {
+	g, err := gpio.NewGpio(nil, nil)
+
+	if err != nil {
+		t.Fatalf("cannot create the GPIO: %v", err)
+	}
+
+	sys := easybustest.NewProgramSystem(t, cTestProgram, easybus.MapDevice(gpio.DEFAULT_ADDRESS, g))
+
+	var dump bytes.Buffer
+	writer := NewWriter(&dump)
+
+	if err := sys.SetWaveform(writer); err != nil {
+		t.Fatalf("cannot set the waveform: %v", err)
+	}
+
+	easybustest.RunFast(t, sys, 10)
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("cannot flush the dump: %v", err)
+	}
+
+	text := dump.String()
+
+	// The instruction register latches the fetched 'sw'.
+	swInstruction := valueAt(t, text, "bus.data_in", 6)
+
+	expected := []struct {
+		signal string
+		cycle  uint64
+		value  uint64
+	}{
+		{"core.pc", 0, 0x0000},
+		{"bus.read", 1, 1},
+		{"core.pc", 6, 0x000A},
+		{"core.state", 6, 0},
+		{"core.state", 7, 2},
+		{"core.instruction", 7, swInstruction},
+		{"bus.read", 7, 0},
+		{"bus.write", 7, 1},
+		{"bus.addr", 7, 0xFFF3},
+		{"bus.data_out", 7, 0x5A},
+		{"core.r2", 7, 0x5A},
+		{"gpio.external_output", 7, 0x00},
+		{"gpio.external_output", 8, 0x5A},
+		{"core.pc", 8, 0x000C},
+		{"core.state", 8, 0},
+	}
+
+	for _, e := range expected {
+		if value := valueAt(t, text, e.signal, e.cycle); value != e.value {
+			t.Errorf("expected %s at cycle %d to be %X, got %X", e.signal, e.cycle, e.value, value)
+		}
+	}
+}
+
+func TestSignalIds(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 10000; i++ {
+		id := signalId(i)
+
+		if seen[id] {
+			t.Fatalf("duplicate id '%s' for the signal %d", id, i)
+		}
+
+		seen[id] = true
+	}
+}
@@ -0,0 +1,222 @@
+package easybus
+
+import (
+	"fmt"
+	"strings"
+
+	"mrav/isa"
+	"mrav/system/easybus/device"
+)
+
+// The encoding of the core.sv state machine.
+const (
+	cWaveCoreReady   uint64 = 0
+	cWaveCoreLwRead  uint64 = 1
+	cWaveCoreSwWrite uint64 = 2
+)
+
+// The core signals for each hart, named after the core.sv ones, then its registers.
+const (
+	cWavePc = iota
+	cWaveInstruction
+	cWaveState
+	cWaveRegisters
+	cWaveCoreSignals = cWaveRegisters + int(isa.RegsNumber)
+)
+
+// The bus signals, after the cores.
+const (
+	cWaveRead = iota
+	cWaveWrite
+	cWaveReadDone
+	cWaveWriteDone
+	cWaveAddr
+	cWaveDataOut
+	cWaveDataIn
+	cWaveBusSignals
+)
+
+// WaveSignal is a signal of the system in the waveforms.
+type WaveSignal struct {
+	Scope string // Module with the signal: core, bus or a device
+	Name  string
+	Width int // Bits
+}
+
+// WaveformRecorder receives the values of the signals on every clock cycle. Declare is called once, before any of the
+// records, and the values come in the same order as the declared signals.
+type WaveformRecorder interface {
+	Declare(signals []WaveSignal) error
+	Record(cycle uint64, values []uint64) error
+}
+
+type waveform struct {
+	recorder     WaveformRecorder
+	probes       []device.Probe
+	instructions []isa.Register // Last fetched by each hart, like the instruction_q of core.sv
+	values       []uint64
+	bus          int // Index of the first bus signal
+}
+
+// SetWaveform starts recording the signals on every clock cycle, nil stops it. The initial values are recorded at the
+// current cycle. Like with a tracer, RunFast simply runs the instructions one by one while recording.
+func (sys *EasyBusSystem) SetWaveform(recorder WaveformRecorder) error {
+	if recorder == nil {
+		sys.waveform = nil
+		return nil
+	}
+
+	wf := &waveform{
+		recorder:     recorder,
+		instructions: make([]isa.Register, len(sys.harts)),
+	}
+
+	var signals []WaveSignal
+
+	for id := range sys.harts {
+		scope := "core"
+
+		if len(sys.harts) > 1 {
+			scope = fmt.Sprintf("core%d", id)
+		}
+
+		signals = append(signals,
+			WaveSignal{Scope: scope, Name: "pc", Width: 16},
+			WaveSignal{Scope: scope, Name: "instruction", Width: 16},
+			WaveSignal{Scope: scope, Name: "state", Width: 2},
+		)
+
+		for reg := 0; reg < int(isa.RegsNumber); reg++ {
+			signals = append(signals, WaveSignal{Scope: scope, Name: fmt.Sprintf("r%d", reg), Width: 16})
+		}
+	}
+
+	wf.bus = len(signals)
+
+	signals = append(signals,
+		WaveSignal{Scope: "bus", Name: "read", Width: 1},
+		WaveSignal{Scope: "bus", Name: "write", Width: 1},
+		WaveSignal{Scope: "bus", Name: "read_done", Width: 1},
+		WaveSignal{Scope: "bus", Name: "write_done", Width: 1},
+		WaveSignal{Scope: "bus", Name: "addr", Width: 16},
+		WaveSignal{Scope: "bus", Name: "data_out", Width: 16},
+		WaveSignal{Scope: "bus", Name: "data_in", Width: 16},
+	)
+
+	scopes := map[string]bool{}
+
+	for _, region := range sys.memoryMap.Regions() {
+		probed, ok := region.Device.(device.Probed)
+
+		if !ok {
+			continue
+		}
+
+		scope := strings.ToLower(region.Device.Name())
+
+		// Several devices of the same kind are told apart by their base.
+		if scopes[scope] {
+			scope = fmt.Sprintf("%s_%04x", scope, region.Base)
+		}
+
+		scopes[scope] = true
+
+		for _, probe := range probed.Probes() {
+			wf.probes = append(wf.probes, probe)
+			signals = append(signals, WaveSignal{Scope: scope, Name: probe.Name, Width: probe.Width})
+		}
+	}
+
+	if err := recorder.Declare(signals); err != nil {
+		return fmt.Errorf("cannot declare the waveform signals: %w", err)
+	}
+
+	wf.values = make([]uint64, len(signals))
+	sys.waveform = wf
+
+	sys.sampleWaveform()
+
+	return sys.recordWaveform(nil)
+}
+
+// waveBusCycle is the bus transaction of the current hart in a clock cycle.
+type waveBusCycle struct {
+	state   uint64
+	address isa.Register
+	value   isa.Register
+	waiting bool // In a wait state of the device, the read value is not there yet
+}
+
+// sampleWaveform captures the registers of the cores and the devices at the start of the clock cycle, before the bus
+// transaction changes them, the same as the flip-flop outputs in the RTL.
+func (sys *EasyBusSystem) sampleWaveform() {
+	wf := sys.waveform
+
+	if wf == nil {
+		return
+	}
+
+	for id, h := range sys.harts {
+		values := wf.values[id*cWaveCoreSignals : (id+1)*cWaveCoreSignals]
+
+		values[cWavePc] = uint64(h.core.Pc)
+		values[cWaveInstruction] = uint64(wf.instructions[id])
+		values[cWaveState] = cWaveCoreReady
+
+		for reg, value := range h.core.Registers {
+			values[cWaveRegisters+reg] = uint64(value)
+		}
+	}
+
+	probes := wf.values[wf.bus+cWaveBusSignals:]
+
+	for i, probe := range wf.probes {
+		probes[i] = probe.Value()
+	}
+}
+
+// recordWaveform records the cycle once its bus transaction is done, nil for a cycle without one.
+func (sys *EasyBusSystem) recordWaveform(cycle *waveBusCycle) error {
+	wf := sys.waveform
+
+	if wf == nil {
+		return nil
+	}
+
+	bus := wf.values[wf.bus : wf.bus+cWaveBusSignals]
+
+	for i := range bus {
+		bus[i] = 0
+	}
+
+	if cycle != nil {
+		wf.values[sys.current*cWaveCoreSignals+cWaveState] = cycle.state
+		bus[cWaveAddr] = uint64(cycle.address)
+
+		if cycle.state == cWaveCoreSwWrite {
+			bus[cWaveWrite] = 1
+			bus[cWaveDataOut] = uint64(cycle.value)
+
+			if !cycle.waiting {
+				bus[cWaveWriteDone] = 1
+			}
+		} else {
+			bus[cWaveRead] = 1
+
+			if !cycle.waiting {
+				bus[cWaveReadDone] = 1
+				bus[cWaveDataIn] = uint64(cycle.value)
+			}
+		}
+
+		if (cycle.state == cWaveCoreReady) && !cycle.waiting {
+			wf.instructions[sys.current] = cycle.value
+		}
+	}
+
+	if err := wf.recorder.Record(sys.cycles, wf.values); err != nil {
+		return fmt.Errorf("cannot record the waveform: %w", err)
+	}
+
+	return nil
+}
@@ -2,9 +2,13 @@ package system
 
 import (
 	"log/slog"
+
+	"mrav/isa"
 )
 
 type SystemOpts struct {
-	Logger  *slog.Logger
-	Verbose bool
+	Logger          *slog.Logger
+	Verbose         bool
+	InterruptVector *isa.Register  // The default of the core if nil
+	ResetPcs        []isa.Register // One for each core, a single core starting from 0x0000 if empty.
 }